@@ -0,0 +1,73 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type accessLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+type accessLogSkip struct {
+	Target string `json:"target"`
+	Reason string `json:"reason"`
+	Error  string `json:"error,omitempty"`
+}
+
+type accessLogEntry struct {
+	Time    time.Time       `json:"time"`
+	Method  string          `json:"method"`
+	Path    string          `json:"path"`
+	Pushed  []string        `json:"pushed"`
+	Skipped []accessLogSkip `json:"skipped"`
+}
+
+func (l *accessLog) log(r *http.Request, events []PushEvent, now time.Time) error {
+	e := accessLogEntry{
+		Time:    now.UTC(),
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Pushed:  []string{},
+		Skipped: []accessLogSkip{},
+	}
+
+	for _, ev := range events {
+		if ev.Outcome == Pushed {
+			e.Pushed = append(e.Pushed, ev.Target)
+			continue
+		}
+
+		skip := accessLogSkip{
+			Target: ev.Target,
+			Reason: ev.Outcome.String(),
+		}
+
+		if ev.Err != nil {
+			skip.Error = ev.Err.Error()
+		}
+
+		e.Skipped = append(e.Skipped, skip)
+	}
+
+	b, err := json.Marshal(&e)
+	if err != nil {
+		return err
+	}
+
+	b = append(b, '\n')
+
+	l.mu.Lock()
+	_, err = l.w.Write(b)
+	l.mu.Unlock()
+	return err
+}
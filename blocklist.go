@@ -0,0 +1,187 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Blocklist stops pushing targets that clients consistently
+// cancel, as they are likely to already hold them or not
+// to want them. A pushed request is counted as cancelled if
+// its context is done, as it is when the client resets the
+// pushed stream, once the handler has served it. The push
+// handler must serve the pushed requests itself, as it does
+// when they are made to the same server.
+//
+// Targets are keyed by their path, without a query, in the
+// canonical form of a push target, as is the path of each
+// pushed request that is served. Blocked targets are
+// reported as NoPush. The zero value is ready
+// to use and is safe for concurrent use.
+type Blocklist struct {
+	// MinPushes is the number of pushes of a target that
+	// are served before it may be blocked. If it is zero,
+	// 20 are.
+	MinPushes int
+
+	// Threshold is the fraction of pushes of a target
+	// that must be cancelled for it to be blocked. If it
+	// is zero, half must be.
+	Threshold float64
+
+	mu        sync.Mutex
+	targets   map[string]*cancelCount
+	overrides map[string]bool
+}
+
+type cancelCount struct {
+	pushes, cancels int
+}
+
+func (b *Blocklist) minPushes() int {
+	if b.MinPushes > 0 {
+		return b.MinPushes
+	}
+
+	return 20
+}
+
+func (b *Blocklist) threshold() float64 {
+	if b.Threshold > 0 {
+		return b.Threshold
+	}
+
+	return 0.5
+}
+
+// Block blocks path regardless of how often it is
+// cancelled.
+func (b *Blocklist) Block(path string) {
+	b.override(path, true)
+}
+
+// Allow permits path to be pushed regardless of how often
+// it is cancelled.
+func (b *Blocklist) Allow(path string) {
+	b.override(path, false)
+}
+
+func (b *Blocklist) override(path string, blocked bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.overrides == nil {
+		b.overrides = make(map[string]bool)
+	}
+
+	b.overrides[blockKey(path)] = blocked
+}
+
+// Reset removes any override of path and forgets its
+// cancellations, so that it is pushed until it is blocked
+// again.
+func (b *Blocklist) Reset(path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	path = blockKey(path)
+	delete(b.overrides, path)
+	delete(b.targets, path)
+}
+
+// Blocked returns the paths that are blocked, in sorted
+// order.
+func (b *Blocklist) Blocked() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var paths []string
+	for path := range b.targets {
+		if _, ok := b.overrides[path]; !ok && b.blockedLocked(path) {
+			paths = append(paths, path)
+		}
+	}
+
+	for path, blocked := range b.overrides {
+		if blocked {
+			paths = append(paths, path)
+		}
+	}
+
+	slices.Sort(paths)
+	return paths
+}
+
+func (b *Blocklist) blocked(path string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.blockedLocked(path)
+}
+
+func (b *Blocklist) blockedLocked(path string) bool {
+	if blocked, ok := b.overrides[path]; ok {
+		return blocked
+	}
+
+	c := b.targets[path]
+	return c != nil && c.pushes >= b.minPushes() &&
+		float64(c.cancels) >= b.threshold()*float64(c.pushes)
+}
+
+// served counts the pushed request r, which has been
+// served, and whether the client cancelled it.
+func (b *Blocklist) served(r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.targets == nil {
+		b.targets = make(map[string]*cancelCount)
+	}
+
+	path := blockKey(r.URL.EscapedPath())
+
+	c := b.targets[path]
+	if c == nil {
+		c = new(cancelCount)
+		b.targets[path] = c
+	}
+
+	c.pushes++
+
+	if r.Context().Err() != nil {
+		c.cancels++
+	}
+}
+
+// blockKey returns the key of path in a Blocklist: the path
+// of the target as cleaned by cleanTarget, or path itself
+// if it is not a valid target.
+func blockKey(path string) string {
+	if clean, ok := cleanTarget(path); ok {
+		return targetPath(clean)
+	}
+
+	return path
+}
+
+// targetPath returns the path of a cleaned push target,
+// without its origin or query.
+func targetPath(target string) string {
+	if !strings.HasPrefix(target, "/") {
+		if i := strings.Index(target, "://"); i >= 0 {
+			if j := strings.IndexByte(target[i+3:], '/'); j >= 0 {
+				target = target[i+3+j:]
+			}
+		}
+	}
+
+	return locationPath(target)
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBlocklistKeys(t *testing.T) {
+	for _, tc := range []struct {
+		target string // as pushed
+		served string // as requested
+	}{
+		{"/a.css", "/a.css"},
+		{"/a.css?v=2", "/a.css?v=3"},
+		{"https://example.com/a.css", "/a.css"},
+		{"/a%20b.css", "/a%20b.css"},
+		{"/%7euser/a.css", "/~user/a.css"},
+		{"/~user/a.css", "/%7Euser/a.css"},
+		{"/caf%c3%a9.css", "/caf%C3%A9.css"},
+		{"/a/../b.css", "/b.css"},
+	} {
+		clean, ok := cleanTarget(tc.target)
+		if !ok {
+			t.Fatalf("cleanTarget(%q) failed", tc.target)
+		}
+
+		b := &Blocklist{MinPushes: 1}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		r := httptest.NewRequest(http.MethodGet, "https://example.com"+tc.served, nil)
+		b.served(r.WithContext(ctx))
+
+		if !b.blocked(targetPath(clean)) {
+			t.Errorf("cancelled push of %q served as %q did not block it", tc.target, tc.served)
+		}
+
+		b = new(Blocklist)
+		b.Block(tc.served)
+
+		if !b.blocked(targetPath(clean)) {
+			t.Errorf("Block(%q) did not block %q", tc.served, tc.target)
+		}
+
+		b.Reset(tc.target)
+		if b.blocked(targetPath(clean)) {
+			t.Errorf("Reset(%q) did not unblock %q", tc.target, tc.served)
+		}
+	}
+}
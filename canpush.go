@@ -0,0 +1,65 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import "net/http"
+
+// CanPush reports whether resources pushed in response to
+// r would reach the client. It requires an HTTP/2 request
+// that was not itself pushed, and an http.ResponseWriter
+// that supports push.
+//
+// If w is being served by the push handler, the handler's
+// options are also consulted: CanPush returns false in
+// observe only mode, after Disable has been called for r,
+// for a request not made over TLS unless
+// Options.AllowInsecure or TrustForwardedProto allows it,
+// if Options.SupportsPush
+// rejects r, for a client that Options.SkipServiceWorker
+// skips, on a connection slower than Options.MinThroughput,
+// for a client known to have disabled push, or for a visit
+// with the VisitPreload policy. It allows handlers to
+// choose between, for instance, inlining critical CSS and
+// pushing it, in agreement with the handler.
+//
+// A client may still refuse pushes by disabling them in
+// its HTTP/2 settings, which is not visible to handlers.
+func CanPush(w http.ResponseWriter, r *http.Request) bool {
+	if r.ProtoMajor != 2 {
+		return false
+	}
+
+	pw := unwrapPushResponseWriter(w)
+	if pw == nil {
+		return FindPusher(w) != nil && !DefaultSentinel.IsPush(r)
+	}
+
+	o := pw.opts
+	if o.observeOnly || pw.result.disabled || o.sentinel.IsPush(r) || o.insecure(r) ||
+		o.visitPolicy(r) == VisitPreload {
+		return false
+	}
+
+	if _, ok := pw.ResponseWriter.(http.Pusher); !ok {
+		return false
+	}
+
+	return o.clientSupportsPush(r)
+}
+
+// clientSupportsPush returns false if Options.SupportsPush
+// rejects r, r is from a client controlled by a service
+// worker that Options.SkipServiceWorker skips, r was made
+// on a connection slower than Options.MinThroughput, or
+// the client is known to have disabled push, as recorded
+// with Options.RememberNoPush.
+func (o *options) clientSupportsPush(r *http.Request) bool {
+	if o.serviceWorker(r) || o.slowConn(r) || o.knownNoPush(r) {
+		return false
+	}
+
+	return o.supportsPush == nil || o.supportsPush(r)
+}
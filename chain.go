@@ -0,0 +1,217 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Chain returns a Middleware that applies mws in order, the
+// first being the outermost.
+//
+// Pushed requests copy the Accept-Encoding header of the
+// response that pushed them and are served by the whole
+// server, so they are compressed as any other request. The
+// push handler must therefore be placed before, and not
+// inside, compression middleware, where it would see
+// neither the http.Pusher of the server nor the headers
+// of the response as sent.
+//
+// Each push handler in mws that follows other middleware
+// is watched for this as requests are served: the first
+// time a response it wrote without a Content-Encoding is
+// sent with one, a warning is logged through the standard
+// logger. Middleware that only decides whether to compress
+// once the handler has returned goes unnoticed; CheckChain
+// may be used to probe for it instead.
+func Chain(mws ...Middleware) Middleware {
+	return func(h http.Handler) http.Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](h)
+
+			switch h.(type) {
+			case *PushHandler, *HostHandler:
+				if i > 0 {
+					h = &compressionCheck{Handler: h, index: i}
+				}
+			}
+		}
+
+		return h
+	}
+}
+
+// compressionCheck wraps a push handler that Chain placed
+// after other middleware, and warns if one of them
+// compresses its responses.
+type compressionCheck struct {
+	http.Handler
+	index int
+	once  sync.Once
+}
+
+func (c *compressionCheck) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ew := &encodingResponseWriter{ResponseWriter: w}
+	c.Handler.ServeHTTP(wrapWriter(ew, w), r)
+
+	if ew.wroteHeader && !ew.encoded && w.Header().Get("Content-Encoding") != "" {
+		c.once.Do(func() {
+			log.Printf("go-server-push: push handler at %d of chain is inside compression middleware", c.index)
+		})
+	}
+}
+
+// encodingResponseWriter records whether the response
+// already had a Content-Encoding when its headers were
+// written.
+type encodingResponseWriter struct {
+	http.ResponseWriter
+
+	wroteHeader bool
+	encoded     bool
+}
+
+func (w *encodingResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader && !isInformational(code) {
+		w.wroteHeader = true
+		w.encoded = w.Header().Get("Content-Encoding") != ""
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *encodingResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *encodingResponseWriter) WriteString(s string) (n int, err error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return io.WriteString(w.ResponseWriter, s)
+}
+
+func (w *encodingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *encodingResponseWriter) Push(target string, opts *http.PushOptions) error {
+	return w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+func (w *encodingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *encodingResponseWriter) CloseNotify() <-chan bool {
+	return w.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
+func (w *encodingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		// The connection is no longer served over HTTP, so
+		// its headers are not checked.
+		w.wroteHeader, w.encoded = true, true
+	}
+
+	return conn, brw, err
+}
+
+func (w *encodingResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.(io.ReaderFrom).ReadFrom(r)
+}
+
+// CheckChain reports an error for each push handler in mws,
+// ordered as for Chain, that follows a compression
+// middleware. Unlike Chain, it finds them up front.
+//
+// It is not called by Chain, as it must construct and
+// serve each middleware: it may be called from a test or
+// at start up. A middleware is identified as a push
+// handler if it returns a *PushHandler or *HostHandler.
+// Each other middleware, up to the first that compresses,
+// is given a single probe request for / that accepts
+// compressed responses, and is identified as compressing
+// if the response carries a Content-Encoding header.
+func CheckChain(mws ...Middleware) error {
+	var errs []error
+
+	compressor := -1
+	for i, mw := range mws {
+		if isPushMiddleware(mw) {
+			if compressor >= 0 {
+				errs = append(errs, fmt.Errorf("go-server-push: push handler at %d of chain follows compression middleware at %d", i, compressor))
+			}
+
+			continue
+		}
+
+		if compressor < 0 && compresses(mw) {
+			compressor = i
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func isPushMiddleware(mw Middleware) bool {
+	switch mw(http.NotFoundHandler()).(type) {
+	case *PushHandler, *HostHandler:
+		return true
+	default:
+		return false
+	}
+}
+
+// probeBody is a compressible response body large enough
+// to exceed the minimum size of compression middleware.
+var probeBody = strings.Repeat("<p>go-server-push</p>\n", 512)
+
+func compresses(mw Middleware) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, probeBody)
+	}))
+
+	r, err := http.NewRequest(http.MethodGet, "/", nil)
+	if err != nil {
+		panic(err)
+	}
+
+	r.RequestURI = "/"
+	r.Header.Set("Accept-Encoding", "gzip, deflate, br, zstd")
+
+	rec := &discardRecorder{header: make(http.Header)}
+	h.ServeHTTP(rec, r)
+	return rec.header.Get("Content-Encoding") != ""
+}
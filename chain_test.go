@@ -0,0 +1,101 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeCompress marks responses with a body as gzip encoded
+// once the body is written, as compression middleware
+// does, without compressing them.
+func fakeCompress(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&fakeCompressWriter{ResponseWriter: w}, r)
+	})
+}
+
+type fakeCompressWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *fakeCompressWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *fakeCompressWriter) Write(p []byte) (int, error) {
+	if w.code != -1 {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.ResponseWriter.WriteHeader(max(w.code, http.StatusOK))
+		w.code = -1
+	}
+
+	return w.ResponseWriter.Write(p)
+}
+
+func passMiddleware(h http.Handler) http.Handler { return h }
+
+func TestChain(t *testing.T) {
+	push := func(h http.Handler) http.Handler {
+		return New(1<<16, 4, h, nil)
+	}
+
+	body := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/encoded" {
+			w.Header().Set("Content-Encoding", "br")
+		}
+
+		io.WriteString(w, "<p>hello</p>")
+	})
+
+	for _, tc := range []struct {
+		name string
+		mws  []Middleware
+		path string
+		warn bool
+	}{
+		{"push first", []Middleware{push, fakeCompress}, "/", false},
+		{"push only", []Middleware{push}, "/", false},
+		{"after other middleware", []Middleware{passMiddleware, push}, "/", false},
+		{"inside compression", []Middleware{fakeCompress, push}, "/", true},
+		{"inside later compression", []Middleware{passMiddleware, fakeCompress, push}, "/", true},
+		{"already encoded", []Middleware{fakeCompress, push}, "/encoded", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			defer log.SetOutput(log.Writer())
+			log.SetOutput(&buf)
+
+			h := Chain(tc.mws...)(body)
+			for i := 0; i < 3; i++ {
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+			}
+
+			want := 0
+			if tc.warn {
+				want = 1
+			}
+
+			n := strings.Count(buf.String(), "inside compression middleware")
+			if n != want {
+				t.Errorf("warned %d times, want %d: %s", n, want, buf.String())
+			}
+
+			if err := CheckChain(tc.mws...); (err != nil) != tc.warn && tc.path == "/" {
+				t.Errorf("CheckChain = %v, want error %t", err, tc.warn)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import "net/http"
+
+// filterParams returns the parameters of a new filter for
+// the client making r. They are chosen by
+// Options.ClassifyFilter, if set and valid, and are then
+// recorded in the cookie along with the filter, so that
+// the client keeps them on later requests.
+func (o *options) filterParams(r *http.Request) (m, k uint) {
+	if o.classifyFilter == nil {
+		return o.m, o.k
+	}
+
+	m, k = o.classifyFilter(r)
+	if m == 0 || m > o.m || k == 0 || k > m || k > 64 {
+		return o.m, o.k
+	}
+
+	return m, k
+}
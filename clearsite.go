@@ -0,0 +1,96 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/gddo/httputil/header"
+)
+
+// The kinds of data a Clear-Site-Data header clears that
+// invalidate the client's filter.
+const (
+	clearsCache uint8 = 1 << iota
+	clearsCookies
+)
+
+// parseClearSiteData returns the kinds of data cleared by
+// the Clear-Site-Data header of a response.
+func parseClearSiteData(h http.Header) uint8 {
+	var clears uint8
+	for _, v := range header.ParseList(h, "Clear-Site-Data") {
+		switch strings.Trim(v, `"`) {
+		case "cache":
+			clears |= clearsCache
+		case "cookies":
+			clears |= clearsCookies
+		case "*":
+			clears |= clearsCache | clearsCookies
+		}
+	}
+
+	return clears
+}
+
+// clearSiteData resets the client's filter if the response
+// clears its cache or cookies, as the filter no longer
+// reflects what the client holds. The new filter is saved
+// in place of the old one, even if nothing is pushed,
+// unless cookies are cleared, in which case the filter
+// cookies are deleted instead.
+func (w *pushResponseWriter) clearSiteData(h http.Header) {
+	clears := parseClearSiteData(h)
+	if clears == 0 {
+		return
+	}
+
+	w.releaseFilter()
+	w.resetFilter()
+	w.conn = nil
+	w.siteCleared = clears
+}
+
+// saveCleared saves the filter of a response that cleared
+// the client's cache or cookies, reporting false if there
+// was none.
+func (w *pushResponseWriter) saveCleared() bool {
+	switch {
+	case w.siteCleared&clearsCookies != 0:
+		w.deleteCookies()
+	case w.siteCleared != 0 && !w.dirty:
+		if err := w.saveBloomFilter(); err != nil {
+			w.opts.logError(w.req, "error saving bloom filter", err)
+		}
+	default:
+		return false
+	}
+
+	return true
+}
+
+// deleteCookies deletes the filter cookie, and those kept
+// alongside it, that the client sent.
+func (w *pushResponseWriter) deleteCookies() {
+	if w.opts.insecure(w.req) {
+		return
+	}
+
+	for _, suffix := range []string{"", refreshSuffix, pushTimeSuffix} {
+		if _, err := w.req.Cookie(w.opts.cookie.Name + suffix); err != nil {
+			continue
+		}
+
+		c := *w.opts.cookie
+		c.Name += suffix
+		c.Value = ""
+		c.MaxAge = -1
+		c.Expires = time.Time{}
+		http.SetCookie(w, &c)
+	}
+}
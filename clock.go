@@ -0,0 +1,30 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import "time"
+
+// Clock is the source of time used by the handler for
+// timestamps, durations and timers. It allows time based
+// behaviour to be tested deterministically.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// AfterFunc calls f in its own goroutine after d has
+	// elapsed.
+	AfterFunc(d time.Duration, f func())
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) { time.AfterFunc(d, f) }
+
+// SystemClock is the Clock backed by the time package. It
+// is used when Options.Clock is nil.
+var SystemClock Clock = systemClock{}
@@ -0,0 +1,56 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http/httputil"
+	"net/url"
+	"os"
+
+	"github.com/tmthrgd/go-server-push/pushmanifest"
+)
+
+func diff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	base := fs.String("url", "", "the base URL of the site serving the routes")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || *base == "" {
+		fmt.Fprintln(os.Stderr, "usage: pushctl diff -url base manifest [route ...]")
+		os.Exit(2)
+	}
+
+	m, err := pushmanifest.Load(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("pushctl: error loading manifest: %v", err)
+	}
+
+	u, err := url.Parse(*base)
+	if err != nil {
+		log.Fatalf("pushctl: invalid URL: %v", err)
+	}
+
+	diffs := m.Diff(httputil.NewSingleHostReverseProxy(u), fs.Args()[1:]...)
+	if len(diffs) == 0 {
+		fmt.Println("ok")
+		return
+	}
+
+	for _, d := range diffs {
+		for _, target := range d.Added {
+			fmt.Printf("%s\t+ %s\n", d.Route, target)
+		}
+
+		for _, target := range d.Removed {
+			fmt.Printf("%s\t- %s\n", d.Route, target)
+		}
+	}
+
+	os.Exit(1)
+}
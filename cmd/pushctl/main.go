@@ -0,0 +1,103 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Command pushctl inspects the bloom filter cookie set by
+// serverpush and validates push manifests.
+//
+// Usage:
+//
+//	pushctl [-cookie value] [path ...]
+//	pushctl validate (-url base | -dir dir) manifest
+//	pushctl diff -url base manifest [route ...]
+//
+// If -cookie is not given, the cookie value is read from
+// standard input. The value may be given as name=value,
+// as copied from a Cookie header. Each path argument is
+// tested for membership in the filter.
+//
+// The validate verb checks a JSON or YAML manifest with
+// Manifest.Validate, requesting each resource from the
+// site at the base URL or serving it from the directory.
+// It exits with a non-zero status if problems are found.
+//
+// The diff verb requests each route, or every route of the
+// manifest that is not a pattern, from the site at the
+// base URL and compares the preload Link headers of the
+// responses with the resources listed in the manifest,
+// printing targets that are linked but not listed with +
+// and those listed but not linked with -. It exits with a
+// non-zero status if any differ.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+
+	serverpush "github.com/tmthrgd/go-server-push"
+)
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			validate(os.Args[2:])
+			return
+		case "diff":
+			diff(os.Args[2:])
+			return
+		}
+	}
+
+	cookie := flag.String("cookie", "", "the cookie value to inspect")
+	flag.Parse()
+
+	value := *cookie
+	if value == "" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			log.Fatalf("pushctl: error reading cookie: %v", err)
+		}
+
+		value = line
+	}
+
+	value = strings.TrimSpace(value)
+	if idx := strings.IndexByte(value, '='); idx >= 0 {
+		value = value[idx+1:]
+	}
+
+	fi, err := serverpush.InspectCookie(value)
+	if err != nil {
+		log.Fatalf("pushctl: error decoding cookie: %v", err)
+	}
+
+	fmt.Printf("m:\t%d\n", fi.M)
+	fmt.Printf("k:\t%d\n", fi.K)
+	fmt.Printf("fill:\t%.2f%%\n", fi.FillRatio*100)
+
+	if fi.Generation != 0 {
+		fmt.Printf("gen:\t%x\n", fi.Generation)
+	}
+
+	if fi.K != 0 && fi.FillRatio < 1 {
+		// Swamidass & Baldi (2007) estimate of the number
+		// of items in the filter.
+		n := -float64(fi.M) / float64(fi.K) * math.Log(1-fi.FillRatio)
+		fmt.Printf("items:\t~%.0f\n", n)
+	}
+
+	for _, path := range flag.Args() {
+		if fi.Test(path) {
+			fmt.Printf("%s\tprobably pushed\n", path)
+		} else {
+			fmt.Printf("%s\tnot pushed\n", path)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+
+	"github.com/tmthrgd/go-server-push/pushmanifest"
+)
+
+func validate(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	base := fs.String("url", "", "the base URL of the site serving the resources")
+	dir := fs.String("dir", "", "the directory to serve the resources from")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || (*base == "") == (*dir == "") {
+		fmt.Fprintln(os.Stderr, "usage: pushctl validate (-url base | -dir dir) manifest")
+		os.Exit(2)
+	}
+
+	m, err := pushmanifest.Load(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("pushctl: error loading manifest: %v", err)
+	}
+
+	var h http.Handler
+	if *base != "" {
+		u, err := url.Parse(*base)
+		if err != nil {
+			log.Fatalf("pushctl: invalid URL: %v", err)
+		}
+
+		h = httputil.NewSingleHostReverseProxy(u)
+	} else {
+		h = http.FileServer(http.Dir(*dir))
+	}
+
+	err = m.Validate(h)
+	if err == nil {
+		fmt.Println("ok")
+		return
+	}
+
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		for _, err := range joined.Unwrap() {
+			fmt.Println(err)
+		}
+	} else {
+		fmt.Println(err)
+	}
+
+	os.Exit(1)
+}
@@ -0,0 +1,196 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	serverpush "github.com/tmthrgd/go-server-push"
+	"github.com/tmthrgd/go-server-push/pushmanifest"
+	"golang.org/x/net/html"
+)
+
+// crawl visits up to max pages of the site at start,
+// following same-origin links, and analyzes each of them.
+func crawl(start string, max int) (map[string][]serverpush.Resource, error) {
+	u, err := url.Parse(start)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL %q", start)
+	}
+
+	site := &siteFS{
+		origin: &url.URL{Scheme: u.Scheme, Host: u.Host},
+		client: &http.Client{Timeout: 30 * time.Second},
+		files:  make(map[string]*siteFile),
+	}
+
+	first, ok := pageName(u.EscapedPath())
+	if !ok {
+		return nil, fmt.Errorf("invalid page %q", u.Path)
+	}
+
+	pages := []string{first}
+	seen := map[string]bool{first: true}
+
+	for i := 0; i < len(pages) && i < max; i++ {
+		b, err := fs.ReadFile(site, pages[i])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, link := range links(b) {
+			ref, err := site.pageURL(pages[i]).Parse(link)
+			if err != nil || ref.Host != u.Host || ref.Scheme != u.Scheme {
+				continue
+			}
+
+			switch path.Ext(ref.Path) {
+			case "", ".html", ".htm":
+			default:
+				continue
+			}
+
+			name, ok := pageName(ref.EscapedPath())
+			if ok && !seen[name] {
+				seen[name] = true
+				pages = append(pages, name)
+			}
+		}
+	}
+
+	return pushmanifest.Analyze(site, "/", pages[:min(len(pages), max)]...)
+}
+
+// links returns the href of each anchor in an HTML page.
+func links(b []byte) []string {
+	var hrefs []string
+
+	z := html.NewTokenizer(bytes.NewReader(b))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return hrefs
+		case html.StartTagToken:
+			name, hasAttr := z.TagName()
+			if string(name) != "a" {
+				continue
+			}
+
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if string(key) == "href" {
+					hrefs = append(hrefs, string(val))
+				}
+			}
+		}
+	}
+}
+
+// siteFS is an fs.FS of the files of a remote site. Each
+// file is fetched at most once.
+type siteFS struct {
+	origin *url.URL
+	client *http.Client
+
+	mu    sync.Mutex
+	files map[string]*siteFile
+}
+
+// pageURL returns the URL of the file name, serving an
+// index.html as its directory.
+func (s *siteFS) pageURL(name string) *url.URL {
+	p := "/" + name
+	if path.Base(name) == "index.html" {
+		p = strings.TrimSuffix(p, "index.html")
+	}
+
+	return s.origin.ResolveReference(&url.URL{Path: p})
+}
+
+func (s *siteFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	s.mu.Lock()
+	f, ok := s.files[name]
+	s.mu.Unlock()
+
+	if !ok {
+		var err error
+		if f, err = s.fetch(name); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+
+		s.mu.Lock()
+		s.files[name] = f
+		s.mu.Unlock()
+	}
+
+	if f == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return &openFile{siteFile: f, Reader: bytes.NewReader(f.data)}, nil
+}
+
+// fetch returns the file name, or nil if it does not
+// exist.
+func (s *siteFS) fetch(name string) (*siteFile, error) {
+	resp, err := s.client.Get(s.pageURL(name).String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &siteFile{name: path.Base(name), data: data}, nil
+}
+
+type siteFile struct {
+	name string
+	data []byte
+}
+
+func (f *siteFile) Name() string       { return f.name }
+func (f *siteFile) Size() int64        { return int64(len(f.data)) }
+func (f *siteFile) Mode() fs.FileMode  { return 0o444 }
+func (f *siteFile) ModTime() time.Time { return time.Time{} }
+func (f *siteFile) IsDir() bool        { return false }
+func (f *siteFile) Sys() any           { return nil }
+
+type openFile struct {
+	*siteFile
+	*bytes.Reader
+}
+
+func (f *openFile) Stat() (fs.FileInfo, error) { return f.siteFile, nil }
+func (f *openFile) Close() error               { return nil }
@@ -0,0 +1,165 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Command pushgen generates a serverpush manifest.
+//
+// Usage:
+//
+//	pushgen -dir dist [-base /] [-o manifest.json] [entry ...]
+//	pushgen -url https://example.com/ [-max 50] [-o manifest.json]
+//	pushgen -vite dist/.vite/manifest.json -entry /=src/main.ts [-dir dist]
+//	pushgen -webpack dist/manifest.json -entry /=main [-dir dist]
+//	pushgen -esbuild meta.json -outdir dist -entry /=src/app.ts
+//
+// With -dir, the HTML entrypoints in the build output
+// directory, or those named as arguments, are analyzed
+// along with the stylesheets, scripts and fonts they
+// depend on. With -url, the site is crawled from the
+// given page, following same-origin links, and each page
+// found is analyzed in the same way.
+//
+// With -vite, -webpack or -esbuild, the manifest or
+// metafile written by the build tool is read instead, and
+// each -entry maps a request path to an entrypoint of the
+// build. -dir may be given as well to record the size of
+// each asset. -outdir is the esbuild output directory.
+//
+// The manifest is written to standard output, or to the
+// file named by -o, as JSON, or as YAML if -format is yaml
+// or the output file has a .yaml or .yml extension.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	serverpush "github.com/tmthrgd/go-server-push"
+	"github.com/tmthrgd/go-server-push/pushmanifest"
+	"gopkg.in/yaml.v3"
+)
+
+type entryFlags map[string][]string
+
+func (e entryFlags) String() string { return "" }
+
+func (e entryFlags) Set(v string) error {
+	route, entry, ok := strings.Cut(v, "=")
+	if !ok || !strings.HasPrefix(route, "/") || entry == "" {
+		return fmt.Errorf("entry %q is not of the form /route=name", v)
+	}
+
+	e[route] = append(e[route], entry)
+	return nil
+}
+
+func main() {
+	dir := flag.String("dir", "", "the build output directory to analyze")
+	site := flag.String("url", "", "the URL of a site to crawl")
+	maxPages := flag.Int("max", 50, "the maximum number of pages to crawl")
+	vite := flag.String("vite", "", "the path of a Vite manifest.json")
+	webpack := flag.String("webpack", "", "the path of a webpack manifest.json")
+	esbuild := flag.String("esbuild", "", "the path of an esbuild metafile")
+	outdir := flag.String("outdir", "", "the esbuild output directory")
+	base := flag.String("base", "/", "the URL path the build output is served beneath")
+	out := flag.String("o", "", "the file to write the manifest to")
+	format := flag.String("format", "", "the output format, json or yaml")
+
+	entries := make(entryFlags)
+	flag.Var(entries, "entry", "a /route=name mapping for -vite, -webpack or -esbuild; may be repeated")
+	flag.Parse()
+
+	var (
+		routes map[string][]serverpush.Resource
+		err    error
+	)
+
+	switch {
+	case *vite != "" || *webpack != "" || *esbuild != "":
+		if len(entries) == 0 {
+			log.Fatal("pushgen: -entry is required with -vite, -webpack and -esbuild")
+		}
+
+		var load pushmanifest.Loader
+		switch {
+		case *vite != "":
+			load = pushmanifest.ViteLoader(*base, entries)
+		case *webpack != "":
+			load = pushmanifest.WebpackLoader(*base, entries)
+		default:
+			load = pushmanifest.EsbuildLoader(*base, *outdir, entries)
+		}
+
+		if *dir != "" {
+			load = pushmanifest.WithSizes(load, os.DirFS(*dir), *base)
+		}
+
+		manifest := *vite + *webpack + *esbuild
+		routes, err = load(manifest)
+	case *dir != "":
+		routes, err = pushmanifest.Analyze(os.DirFS(*dir), *base, flag.Args()...)
+	case *site != "":
+		routes, err = crawl(*site, *maxPages)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatalf("pushgen: %v", err)
+	}
+
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(*out)) {
+		case ".yaml", ".yml":
+			*format = "yaml"
+		default:
+			*format = "json"
+		}
+	}
+
+	var buf bytes.Buffer
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "\t")
+		err = enc.Encode(routes)
+	case "yaml":
+		err = yaml.NewEncoder(&buf).Encode(routes)
+	default:
+		log.Fatalf("pushgen: unknown format %q", *format)
+	}
+
+	if err != nil {
+		log.Fatalf("pushgen: error encoding manifest: %v", err)
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+	} else {
+		err = os.WriteFile(*out, buf.Bytes(), 0o644)
+	}
+
+	if err != nil {
+		log.Fatalf("pushgen: error writing manifest: %v", err)
+	}
+}
+
+// pageName returns the name within a crawled site of the
+// page at the URL path p.
+func pageName(p string) (string, bool) {
+	name := strings.TrimPrefix(p, "/")
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += "index.html"
+	}
+
+	return name, fs.ValidPath(name)
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Command pushsim replays recorded requests against the
+// serverpush bloom filter logic for each combination of
+// the given parameters.
+//
+// Usage:
+//
+//	pushsim [-m 1024,2048] [-k 4,7] [-maxage 24h,2160h] [file]
+//
+// Requests are read from file, or standard input, as one
+// JSON object per line with client, time and targets
+// fields.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tmthrgd/go-server-push/simulate"
+)
+
+func main() {
+	ms := flag.String("m", "1024", "comma separated list of filter sizes in bits")
+	ks := flag.String("k", "4", "comma separated list of hash function counts")
+	ages := flag.String("maxage", "2160h", "comma separated list of cookie lifetimes")
+	flag.Parse()
+
+	var r io.Reader = os.Stdin
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	reqs, err := simulate.ReadRequests(r)
+	if err != nil {
+		log.Fatalf("pushsim: error reading requests: %v", err)
+	}
+
+	var params []simulate.Params
+	for _, m := range split(*ms) {
+		for _, k := range split(*ks) {
+			for _, age := range split(*ages) {
+				var p simulate.Params
+
+				mv, err := strconv.ParseUint(m, 10, 0)
+				if err != nil {
+					log.Fatalf("pushsim: invalid m %q: %v", m, err)
+				}
+
+				kv, err := strconv.ParseUint(k, 10, 0)
+				if err != nil {
+					log.Fatalf("pushsim: invalid k %q: %v", k, err)
+				}
+
+				if p.MaxAge, err = time.ParseDuration(age); err != nil {
+					log.Fatalf("pushsim: invalid maxage %q: %v", age, err)
+				}
+
+				p.M, p.K = uint(mv), uint(kv)
+				params = append(params, p)
+			}
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "m\tk\tmaxage\trequests\tclients\tpushes\trepushes\tfiltered\tfalse+\texpired\t")
+
+	for _, rep := range simulate.Run(reqs, params...) {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t\n",
+			rep.M, rep.K, rep.MaxAge, rep.Requests, rep.Clients,
+			rep.Pushes, rep.Repushes, rep.Filtered, rep.FalsePositives, rep.Expired)
+	}
+
+	tw.Flush()
+}
+
+func split(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+
+	return out
+}
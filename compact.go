@@ -0,0 +1,204 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+
+	"github.com/willf/bloom"
+)
+
+// compactPrefix marks a cookie value in the compact
+// encoding. It is not in the alphabet of either base64
+// encoding, so it cannot begin a DEFLATE encoded value.
+const compactPrefix = "~"
+
+// The compact encoding is compactPrefix followed by the
+// unpadded base64url encoding of m and k as uvarints, a
+// mode byte and the bits of the filter. compactRaw stores
+// the bits as bytes, least significant bit first, and
+// compactGaps stores the distance from each set bit to the
+// last as a uvarint, which is smaller for sparse filters.
+const (
+	compactRaw = iota
+	compactGaps
+)
+
+var errMalformedCompact = errors.New("go-server-push: malformed compact bloom filter")
+
+// filterWordsOf returns a copy of the words of the bitset
+// of f.
+func filterWordsOf(f *bloom.BloomFilter) ([]uint64, error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		bufferPool.Put(buf)
+	}()
+
+	if _, err := f.WriteTo(buf); err != nil {
+		return nil, err
+	}
+
+	// Skip the m, k and bitset length words.
+	b := buf.Bytes()[24:]
+
+	words := make([]uint64, len(b)/8)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint64(b[i*8:])
+	}
+
+	return words, nil
+}
+
+// encodeCompact encodes a bloom filter into a cookie value
+// with the compact encoding.
+func encodeCompact(f *bloom.BloomFilter) (string, error) {
+	words, err := filterWordsOf(f)
+	if err != nil {
+		return "", err
+	}
+
+	m := f.Cap()
+	rawLen := int(m+7) / 8
+
+	b := make([]byte, 0, 2*binary.MaxVarintLen64+1+rawLen)
+	b = binary.AppendUvarint(b, uint64(m))
+	b = binary.AppendUvarint(b, uint64(f.K()))
+	hdr := len(b)
+
+	b = append(b, compactGaps)
+
+	last := -1
+	for i, w := range words {
+		for ; w != 0; w &= w - 1 {
+			bit := i*64 + bits.TrailingZeros64(w)
+			b = binary.AppendUvarint(b, uint64(bit-last-1))
+			last = bit
+		}
+
+		if len(b)-hdr-1 >= rawLen {
+			break
+		}
+	}
+
+	if len(b)-hdr-1 >= rawLen {
+		b = append(b[:hdr], compactRaw)
+		for i := 0; i < rawLen; i++ {
+			b = append(b, byte(words[i/8]>>(8*(i%8))))
+		}
+	}
+
+	return compactPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCompact decodes a bloom filter from the compact
+// encoding, without compactPrefix, as for
+// decodeFilterPooled.
+func decodeCompact(value string, m, k uint) (*bloom.BloomFilter, *filterWords, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fm, n := binary.Uvarint(b)
+	if n <= 0 || fm == 0 || fm > maxBits(m) {
+		return nil, nil, errMalformedCompact
+	}
+
+	b = b[n:]
+
+	fk, n := binary.Uvarint(b)
+	if n <= 0 || fk == 0 || fk > 64 || len(b) == n {
+		return nil, nil, errMalformedCompact
+	}
+
+	mode, b := b[n], b[n+1:]
+
+	var fw *filterWords
+	var words []uint64
+	if poolable(uint(fm)) && uint(fm) == m && uint(fk) == k {
+		fw = getFilterWords(m)
+		words = fw.words
+		clear(words)
+	} else {
+		words = make([]uint64, (fm+63)/64)
+	}
+
+	if !decodeCompactBits(words, fm, mode, b) {
+		if fw != nil {
+			filterPool.Put(fw)
+		}
+
+		return nil, nil, errMalformedCompact
+	}
+
+	if fm%64 == 0 {
+		return bloom.From(words, uint(fk)), fw, nil
+	}
+
+	// bloom.From would round the filter up to a whole
+	// number of words, so it is read as written by WriteTo.
+	enc := make([]byte, 24+8*len(words))
+	binary.BigEndian.PutUint64(enc[0:], fm)
+	binary.BigEndian.PutUint64(enc[8:], fk)
+	binary.BigEndian.PutUint64(enc[16:], fm)
+	for i, w := range words {
+		binary.BigEndian.PutUint64(enc[24+8*i:], w)
+	}
+
+	f := new(bloom.BloomFilter)
+	if _, err := f.ReadFrom(bytes.NewReader(enc)); err != nil {
+		return nil, nil, err
+	}
+
+	return f, nil, nil
+}
+
+func decodeCompactBits(words []uint64, m uint64, mode byte, b []byte) bool {
+	switch mode {
+	case compactRaw:
+		if uint64(len(b)) != (m+7)/8 {
+			return false
+		}
+
+		if m%8 != 0 && b[len(b)-1]>>(m%8) != 0 {
+			return false
+		}
+
+		for i, c := range b {
+			words[i/8] |= uint64(c) << (8 * (i % 8))
+		}
+	case compactGaps:
+		bit := uint64(0)
+		for first := true; len(b) != 0; first = false {
+			gap, n := binary.Uvarint(b)
+			if n <= 0 {
+				return false
+			}
+
+			b = b[n:]
+
+			if !first {
+				bit++
+			}
+
+			if gap >= m || bit+gap >= m {
+				return false
+			}
+
+			bit += gap
+			words[bit/64] |= 1 << (bit % 64)
+		}
+	default:
+		return false
+	}
+
+	return true
+}
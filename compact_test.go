@@ -0,0 +1,113 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/willf/bloom"
+)
+
+// rawURL encodes b as the body of a compact or exact cookie
+// value.
+func rawURL(b ...byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestCompactRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		m, k uint
+		n    int
+		mode byte
+	}{
+		{"empty", 1024, 4, 0, compactGaps},
+		{"sparse", 1024, 4, 5, compactGaps},
+		{"dense", 1024, 4, 200, compactRaw},
+		{"full", 64, 4, 1000, compactRaw},
+		{"unaligned sparse", 100, 3, 2, compactGaps},
+		{"unaligned dense", 100, 3, 60, compactRaw},
+		{"single word", 64, 1, 1, compactGaps},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := bloom.New(tc.m, tc.k)
+			for i := 0; i < tc.n; i++ {
+				f.AddString("/static/" + strconv.Itoa(i) + ".js")
+			}
+
+			v, err := encodeCompact(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.HasPrefix(v, compactPrefix) {
+				t.Fatalf("encodeCompact = %q, missing %q prefix", v, compactPrefix)
+			}
+
+			b, err := base64.RawURLEncoding.DecodeString(v[len(compactPrefix):])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, n1 := binary.Uvarint(b)
+			_, n2 := binary.Uvarint(b[n1:])
+			if mode := b[n1+n2]; mode != tc.mode {
+				t.Errorf("mode = %d, want %d", mode, tc.mode)
+			}
+
+			for _, params := range [][2]uint{{tc.m, tc.k}, {0, 0}} {
+				got, _, err := decodeFilterPooled(v, params[0], params[1])
+				if err != nil {
+					t.Fatalf("decodeFilterPooled(%q, %d, %d): %v", v, params[0], params[1], err)
+				}
+
+				if got.Cap() != tc.m || got.K() != tc.k {
+					t.Errorf("decoded m, k = %d, %d, want %d, %d", got.Cap(), got.K(), tc.m, tc.k)
+				}
+
+				if !got.Equal(f) {
+					t.Error("decoded filter differs from encoded filter")
+				}
+			}
+		})
+	}
+}
+
+func TestCompactMalformed(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		value string
+		m     uint
+	}{
+		{"bad base64", "*", 0},
+		{"empty", "", 0},
+		{"truncated m", rawURL(0x80), 0},
+		{"zero m", rawURL(0, 4, compactGaps), 0},
+		{"m too large", rawURL(0x80, 0x01, 4, compactGaps), 64},
+		{"m above limit", rawURL(0x80, 0x80, 0x80, 0x10, 4, compactGaps), 0},
+		{"missing k", rawURL(64), 0},
+		{"zero k", rawURL(64, 0, compactGaps), 0},
+		{"k too large", rawURL(64, 65, compactGaps), 0},
+		{"missing mode", rawURL(64, 4), 0},
+		{"unknown mode", rawURL(64, 4, 2), 0},
+		{"raw too short", rawURL(64, 4, compactRaw, 0xff), 0},
+		{"raw too long", rawURL(64, 4, compactRaw, 0, 0, 0, 0, 0, 0, 0, 0, 0), 0},
+		{"raw padding set", rawURL(60, 4, compactRaw, 0, 0, 0, 0, 0, 0, 0, 0xf0), 0},
+		{"gap beyond m", rawURL(64, 4, compactGaps, 64), 0},
+		{"gaps beyond m", rawURL(64, 4, compactGaps, 63, 0), 0},
+		{"truncated gap", rawURL(64, 4, compactGaps, 0x80), 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := decodeCompact(tc.value, tc.m, 4); err == nil {
+				t.Errorf("decodeCompact(%q) succeeded", tc.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import "net/http"
+
+// Config is the complete configuration of a handler. Unlike
+// the positional m and k arguments of New, the bloom filter
+// parameters are named, so they cannot be silently swapped.
+type Config struct {
+	// FilterBits is the number of bits in the bloom
+	// filter, m.
+	FilterBits uint
+
+	// Hashes is the number of hash functions used by the
+	// bloom filter, k.
+	//
+	// If both FilterBits and Hashes are zero, the filter
+	// is sized for 200 resources with a 1% false positive
+	// rate, as for NewHandler.
+	Hashes uint
+
+	Options
+}
+
+func (c *Config) params() (m, k uint) {
+	if c.FilterBits == 0 && c.Hashes == 0 {
+		return defaultM, defaultK
+	}
+
+	return c.FilterBits, c.Hashes
+}
+
+// Validate reports whether c describes a handler that is
+// able to push. See the Validate function.
+func (c Config) Validate() error {
+	m, k := c.params()
+	return Validate(m, k, &c.Options)
+}
+
+// NewWithConfig wraps the given http.Handler in a push
+// aware handler configured by c. It returns an error,
+// rather than logging it and disabling the handler as New
+// does, if the configuration is invalid.
+func NewWithConfig(handler http.Handler, c Config) (*PushHandler, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	m, k := c.params()
+	return New(m, k, handler, &c.Options), nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/willf/bloom"
+)
+
+type connFiltersKey struct{}
+
+// connFilters accumulates the bloom filters of the
+// responses served on a single connection, by cookie name.
+// mu guards the map, and each filter is safe for
+// concurrent use.
+type connFilters struct {
+	mu      sync.Mutex
+	filters map[string]*sharedFilter
+
+	// deliveredBytes and deliveryNanos time the responses
+	// written on the connection. See ConnThroughput.
+	deliveredBytes atomic.Int64
+	deliveryNanos  atomic.Int64
+}
+
+// ConnContext may be used as, or called from, the
+// ConnContext function of an http.Server. It times the
+// responses written on the connection, as reported by
+// ConnThroughput, and, for handlers with
+// Options.ShareConnFilter set, shares the bloom filter
+// between the requests of a connection.
+//
+// A client that multiplexes a burst of requests over an
+// HTTP/2 connection sends each the same cookie, as none of
+// the responses have arrived. Without a shared filter,
+// every response pushes the same resources and sets a new
+// cookie. With it, each request also sees what was pushed
+// for the responses before it on the connection, so those
+// resources are not pushed again and usually no cookie
+// needs to be set. The cookies that are set hold every
+// resource pushed on the connection. Requests that are
+// served concurrently never push the same resource, as
+// each push is claimed on the connection before it is
+// made.
+//
+// A connection from a CDN or reverse proxy may carry the
+// requests of many clients, which would then share, and
+// set each other, a single filter, so ShareConnFilter must
+// only be set for servers that clients connect to
+// directly.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connFiltersKey{}, new(connFilters))
+}
+
+func connFiltersFromContext(ctx context.Context) *connFilters {
+	cf, _ := ctx.Value(connFiltersKey{}).(*connFilters)
+	return cf
+}
+
+// getOrCreate returns the accumulated filter for the
+// cookie name, or starts a new one from f if there is none
+// or it has other parameters or another generation.
+func (cf *connFilters) getOrCreate(name string, f *bloom.BloomFilter, gen uint64) (sf *sharedFilter, created bool) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	if sf := cf.filters[name]; sf != nil && sf.matches(f.Cap(), f.K(), gen) {
+		return sf, false
+	}
+
+	if cf.filters == nil {
+		cf.filters = make(map[string]*sharedFilter)
+	}
+
+	sf = newSharedFilter(f.Copy(), gen)
+	cf.filters[name] = sf
+	return sf, true
+}
+
+// loadConnFilter merges the filter accumulated on the
+// connection into the filter loaded from the cookie.
+func (w *pushResponseWriter) loadConnFilter() {
+	if !w.opts.shareConnFilter {
+		return
+	}
+
+	cf := connFiltersFromContext(w.req.Context())
+	if cf == nil {
+		return
+	}
+
+	sf, created := cf.getOrCreate(w.opts.cookie.Name, w.bloom, w.opts.generation())
+	if !created {
+		sf.MergeInto(w.bloom)
+	}
+
+	w.conn = sf
+}
+
+// pushedOnConn reports whether path has been pushed, or is
+// being pushed, for another response on the connection,
+// claiming it for this response if not. Targets are
+// claimed before they are pushed, so one whose push fails
+// is not pushed for the other responses either.
+func (w *pushResponseWriter) pushedOnConn(path string) bool {
+	return w.conn != nil && w.conn.TestAndAdd(path)
+}
+
+// saveConnFilter merges the filter of the response into
+// that accumulated on the connection, and the result back
+// into the filter of the response, before it is saved.
+func (w *pushResponseWriter) saveConnFilter() {
+	if w.conn != nil {
+		w.conn.Exchange(w.bloom)
+	}
+}
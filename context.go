@@ -0,0 +1,98 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"context"
+	"net/http"
+)
+
+type resultKey struct{}
+
+// Result records the push decisions made for a single
+// response. It is populated when the response headers
+// are written.
+type Result struct {
+	Events []PushEvent
+
+	disabled bool
+
+	// noPushRedirect is set once the header set by
+	// NoPushRedirect has been removed from the response.
+	noPushRedirect bool
+
+	// serves records the kinds of push made by the push
+	// handlers serving the request.
+	serves uint8
+}
+
+// Pushed returns the targets that were pushed.
+func (r *Result) Pushed() []string {
+	var pushed []string
+	for _, e := range r.Events {
+		if e.Outcome == Pushed {
+			pushed = append(pushed, e.Target)
+		}
+	}
+
+	return pushed
+}
+
+// WithResult returns a copy of ctx carrying an empty
+// Result. Middleware that runs before the push handler
+// can use it to inspect the push decisions once the
+// wrapped handler has returned.
+//
+// The push handler installs its own Result when none is
+// present, so handlers it wraps can always retrieve one
+// with ResultFromContext.
+func WithResult(ctx context.Context) context.Context {
+	return context.WithValue(ctx, resultKey{}, new(Result))
+}
+
+// ResultFromContext returns the Result carried by ctx, or
+// nil if there is none.
+func ResultFromContext(ctx context.Context) *Result {
+	r, _ := ctx.Value(resultKey{}).(*Result)
+	return r
+}
+
+// Disable suppresses pushing of the Link headers of the
+// response to r, leaving them for the client to preload.
+// It must be called by a handler wrapped by the push
+// handler before the response headers are written, and
+// reports whether r is being served by a push handler.
+func Disable(r *http.Request) bool {
+	res := ResultFromContext(r.Context())
+	if res == nil {
+		return false
+	}
+
+	res.disabled = true
+	return true
+}
+
+type pushOptionsKey struct{}
+
+// ContextWithPushOptions returns a copy of ctx carrying
+// opts. When a request with such a context reaches the
+// push handler, opts is merged over the handler's
+// PushOptions for that response: a non-empty Method
+// replaces the handler's, and each header in opts.Header
+// replaces the header of the same name.
+//
+// The header policy of the handler still applies to the
+// merged headers.
+func ContextWithPushOptions(ctx context.Context, opts *http.PushOptions) context.Context {
+	return context.WithValue(ctx, pushOptionsKey{}, opts)
+}
+
+// PushOptionsFromContext returns the PushOptions carried
+// by ctx, or nil if there are none.
+func PushOptionsFromContext(ctx context.Context) *http.PushOptions {
+	opts, _ := ctx.Value(pushOptionsKey{}).(*http.PushOptions)
+	return opts
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"time"
+)
+
+// pushWithDeadline pushes target with the write deadline of
+// the response set to Options.PushTimeout from now. If the
+// writer does not support deadlines, it pushes without.
+//
+// Time elapsed is measured by the clock of the options and
+// only converted to a wall clock deadline when it is set.
+func (w *pushResponseWriter) pushWithDeadline(target string, opts *http.PushOptions) error {
+	if w.opts.pushTimeout <= 0 {
+		return w.Push(target, opts)
+	}
+
+	now := time.Now()
+
+	var serverDeadline time.Time
+	timeout := w.opts.pushTimeout
+	if remaining, ok := w.serverRemaining(); ok {
+		serverDeadline = now.Add(remaining)
+		timeout = min(timeout, remaining)
+	}
+
+	rc := http.NewResponseController(w.ResponseWriter)
+	if rc.SetWriteDeadline(now.Add(timeout)) != nil {
+		return w.Push(target, opts)
+	}
+
+	err := w.Push(target, opts)
+
+	if derr := rc.SetWriteDeadline(serverDeadline); derr != nil {
+		w.opts.logError(w.req, "error restoring write deadline", derr)
+	}
+
+	return err
+}
+
+// serverRemaining returns how much of the WriteTimeout the
+// server set for the response is left, or false if there
+// is none.
+func (w *pushResponseWriter) serverRemaining() (time.Duration, bool) {
+	srv, _ := w.req.Context().Value(http.ServerContextKey).(*http.Server)
+	if srv == nil || srv.WriteTimeout <= 0 {
+		return 0, false
+	}
+
+	return srv.WriteTimeout - w.opts.clock.Now().Sub(w.started), true
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+type debugInfo struct {
+	Cookie    bool            `json:"cookie"`
+	Error     string          `json:"error,omitempty"`
+	M         uint            `json:"m,omitempty"`
+	K         uint            `json:"k,omitempty"`
+	FillRatio float64         `json:"fill_ratio,omitempty"`
+	Paths     map[string]bool `json:"paths,omitempty"`
+}
+
+// DebugHandler returns an http.Handler that decodes the
+// bloom filter cookie sent by the caller and reports its
+// parameters as JSON. Each path query parameter is tested
+// for membership in the filter, as by PushHandler.Inspect.
+// If Options.PartitionBySite is set, paths are looked up in
+// the partition of the site query parameter, such as
+// https://example.org or cross-site for an unknown site,
+// or else in that of the site that embeds the caller.
+//
+// It is intended to be mounted under /debug/serverpush and
+// only reveals the caller's own cookie. opts should match
+// the Options given to New.
+func DebugHandler(opts *Options) http.Handler {
+	o := New(defaultM, defaultK, nil, opts).opts.Load()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var info debugInfo
+
+		site := o.topLevelSite(r)
+		if v := r.URL.Query().Get("site"); v != "" && o.partitionBySite {
+			site = debugSite(v)
+		}
+
+		switch fi, err := o.inspect(r, site); {
+		case errors.Is(err, http.ErrNoCookie):
+		case err != nil:
+			info.Cookie = true
+			info.Error = err.Error()
+		default:
+			info.Cookie = true
+			info.M, info.K = fi.M, fi.K
+			info.FillRatio = fi.FillRatio
+
+			if paths := r.URL.Query()["path"]; len(paths) != 0 {
+				info.Paths = make(map[string]bool, len(paths))
+				for _, path := range paths {
+					info.Paths[path] = fi.Test(path)
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		enc.Encode(&info)
+	})
+}
+
+// debugSite returns the partition named by the site query
+// parameter of DebugHandler.
+func debugSite(v string) string {
+	if v == opaqueSite {
+		return opaqueSite
+	}
+
+	return siteOf(v)
+}
@@ -0,0 +1,51 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"hash/fnv"
+	"math/rand/v2"
+	"time"
+)
+
+// epochClock is the Clock of a handler with
+// Options.Deterministic set and no Options.Clock. Its time
+// is fixed at the Unix epoch.
+type epochClock struct{}
+
+func (epochClock) Now() time.Time { return time.Unix(0, 0).UTC() }
+
+func (epochClock) AfterFunc(d time.Duration, f func()) { time.AfterFunc(d, f) }
+
+// requestHash returns a hash of the method and URL of the
+// request, which seeds what would otherwise be random in
+// deterministic mode.
+func (w *pushResponseWriter) requestHash() uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(w.req.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(w.req.URL.String()))
+	return h.Sum64()
+}
+
+// sampleRand returns the source of randomness for
+// samplePushes, which is seeded by the request in
+// deterministic mode.
+func (w *pushResponseWriter) sampleRand() func() float64 {
+	if !w.opts.deterministic {
+		return rand.Float64
+	}
+
+	return rand.New(rand.NewPCG(w.requestHash(), 0)).Float64
+}
+
+// deterministicID returns the request ID used in place of
+// a random one in deterministic mode.
+func (w *pushResponseWriter) deterministicID() string {
+	return hex.EncodeToString(binary.BigEndian.AppendUint64(nil, w.requestHash()))
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/golang/gddo/httputil/header"
+)
+
+// RouteDiff describes how the preload links of a route
+// differ from the resources listed for it in a Manifest.
+type RouteDiff struct {
+	Route string
+
+	// Added lists the targets linked by the route that are
+	// not listed in the manifest.
+	Added []string
+
+	// Removed lists the resources listed in the manifest
+	// that the route does not link.
+	Removed []string
+}
+
+// DiffLinks compares the targets of the rel=preload Link
+// header values in links, as observed for a route, with
+// resources, as listed for it in a Manifest.
+func DiffLinks(resources []Resource, links []string) (added, removed []string) {
+	listed := make(map[string]bool, len(resources))
+	for _, res := range resources {
+		listed[res.Path] = true
+	}
+
+	linked := make(map[string]bool, len(links))
+	for _, link := range links {
+		target, ok := preloadTarget(link)
+		if !ok || linked[target] {
+			continue
+		}
+
+		linked[target] = true
+
+		if !listed[target] {
+			added = append(added, target)
+		}
+	}
+
+	for _, res := range resources {
+		if !linked[res.Path] {
+			removed = append(removed, res.Path)
+			linked[res.Path] = true
+		}
+	}
+
+	return added, removed
+}
+
+// Diff requests each of routes from h and compares the
+// preload Link headers of the responses with the resources
+// listed for them, so that drift between the build output
+// and the manifest may be caught. If no routes are given,
+// every route of the manifest that is not a pattern is
+// requested. Only routes that differ are returned.
+func (m *Manifest) Diff(h http.Handler, routes ...string) []RouteDiff {
+	if len(routes) == 0 {
+		for route := range m.Routes() {
+			if !isPattern(route) {
+				routes = append(routes, route)
+			}
+		}
+
+		slices.Sort(routes)
+	}
+
+	var diffs []RouteDiff
+	for _, route := range routes {
+		rec := serveResource(h, route)
+
+		added, removed := DiffLinks(m.Lookup(route), header.ParseList(rec.header, "Link"))
+		if len(added) != 0 || len(removed) != 0 {
+			diffs = append(diffs, RouteDiff{route, added, removed})
+		}
+	}
+
+	return diffs
+}
+
+// preloadTarget returns the target of a rel=preload Link
+// header value.
+func preloadTarget(link string) (string, bool) {
+	target, rest := nextField(link)
+	if len(target) < 2 || target[0] != '<' || target[len(target)-1] != '>' {
+		return "", false
+	}
+
+	for field, rest := nextField(rest); field != ""; field, rest = nextField(rest) {
+		switch field {
+		case "rel=preload", `rel="preload"`:
+			return target[1 : len(target)-1], true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,189 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// cacheDigestHeader is the request header in which a client
+// or intermediary sends digests of the responses it has
+// cached, as described by the HTTP Cache Digests draft.
+const cacheDigestHeader = "Cache-Digest"
+
+var errMalformedDigest = errors.New("go-server-push: malformed Cache-Digest")
+
+// cacheDigest is a decoded Golomb-coded set of the
+// truncated SHA-256 hashes of cached URLs.
+type cacheDigest struct {
+	values   []uint64
+	bits     uint
+	complete bool
+}
+
+// parseCacheDigests parses the fresh digests, without
+// validators, of each Cache-Digest header of r. Malformed
+// digests are skipped.
+func parseCacheDigests(r *http.Request) []cacheDigest {
+	var digests []cacheDigest
+	for _, v := range r.Header[cacheDigestHeader] {
+		for _, v := range strings.Split(v, ",") {
+			value, params, _ := strings.Cut(strings.TrimSpace(v), ";")
+
+			var complete, skip bool
+			for _, param := range strings.Split(params, ";") {
+				switch strings.ToLower(strings.TrimSpace(param)) {
+				case "complete":
+					complete = true
+				case "stale", "validators":
+					skip = true
+				}
+			}
+
+			if skip {
+				continue
+			}
+
+			d, err := decodeCacheDigest(strings.TrimRight(value, "="))
+			if err != nil {
+				continue
+			}
+
+			d.complete = complete
+			digests = append(digests, d)
+		}
+	}
+
+	return digests
+}
+
+// decodeCacheDigest decodes the unpadded base64url digest
+// value. It holds log2(N) and log2(P) in five bits each,
+// followed by the sorted hash values, of log2(N*P) bits,
+// as the Golomb-Rice coded differences between them.
+func decodeCacheDigest(value string) (cacheDigest, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cacheDigest{}, err
+	}
+
+	br := bitReader{b: b}
+
+	n, ok1 := br.readBits(5)
+	p, ok2 := br.readBits(5)
+	if !ok1 || !ok2 || n+p > 64 {
+		return cacheDigest{}, errMalformedDigest
+	}
+
+	d := cacheDigest{bits: uint(n + p)}
+
+	var next uint64
+	for {
+		// The zero bits that pad the digest to a whole
+		// byte end it before the terminating one bit of a
+		// quotient.
+		var q uint64
+		for {
+			bit, ok := br.readBits(1)
+			if !ok {
+				return d, nil
+			}
+
+			if bit == 1 {
+				break
+			}
+
+			q++
+		}
+
+		r, ok := br.readBits(uint(p))
+		if !ok {
+			return d, nil
+		}
+
+		v := next + (q<<p | r)
+		d.values = append(d.values, v)
+		next = v + 1
+	}
+}
+
+// contains reports whether the digest holds the URL with
+// the given SHA-256 hash.
+func (d *cacheDigest) contains(sum *[sha256.Size]byte) bool {
+	h := binary.BigEndian.Uint64(sum[:8])
+	if d.bits < 64 {
+		h >>= 64 - d.bits
+	}
+
+	_, ok := slices.BinarySearch(d.values, h)
+	return ok
+}
+
+type bitReader struct {
+	b   []byte
+	off uint
+}
+
+// readBits reads the next n bits, most significant first,
+// reporting false if there are too few left.
+func (br *bitReader) readBits(n uint) (uint64, bool) {
+	if br.off+n > uint(len(br.b))*8 {
+		return 0, false
+	}
+
+	var v uint64
+	for ; n > 0; n-- {
+		bit := br.b[br.off/8] >> (7 - br.off%8) & 1
+		v = v<<1 | uint64(bit)
+		br.off++
+	}
+
+	return v, true
+}
+
+// cached reports whether the target with the given path
+// and filter key is already cached by the client. If
+// Options.CacheDigest is set, the Cache-Digest header of
+// the request is consulted along with the bloom filter,
+// and in place of it if a digest is complete.
+func (w *pushResponseWriter) cached(path, key string) bool {
+	if !w.opts.cacheDigest {
+		return w.test(key)
+	}
+
+	if !w.digestsParsed {
+		w.digests = parseCacheDigests(w.req)
+		w.digestsParsed = true
+	}
+
+	if len(w.digests) == 0 {
+		return w.test(key)
+	}
+
+	scheme := "https://"
+	if w.req.TLS == nil {
+		scheme = "http://"
+	}
+
+	sum := sha256.Sum256([]byte(scheme + w.req.Host + path))
+
+	var complete bool
+	for i := range w.digests {
+		if w.digests[i].contains(&sum) {
+			return true
+		}
+
+		complete = complete || w.digests[i].complete
+	}
+
+	return !complete && w.test(key)
+}
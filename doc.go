@@ -13,7 +13,24 @@
 //
 // It uses a DEFLATE compressed bloom filter to store
 // a probabilistic view of resources that have already
-// been pushed to the client.
+// been pushed to the client. The filter is reset when a
+// response has a Clear-Site-Data header that clears the
+// client's cache or cookies.
+//
+// A handler is normally constructed with NewWithConfig,
+// which names the bloom filter parameters and returns an
+// error for an invalid configuration:
+//
+//	h, err := serverpush.NewWithConfig(handler, serverpush.Config{
+//		FilterBits: 1 << 11,
+//		Hashes:     7,
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//
+// New, with positional m and k arguments, is kept for
+// existing callers.
 package serverpush
 
 import "net/http"
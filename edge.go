@@ -0,0 +1,46 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+// edgeLinks returns the Link header of a response in edge
+// push mode: the pushed links and the links of pushed
+// Manifest resources, annotated for the edge, followed by
+// the remaining links marked nopush so that the edge does
+// not push a resource the client already has.
+func (w *pushResponseWriter) edgeLinks(pushed, rest []string) []string {
+	links := make([]string, 0, len(pushed)+len(w.edgePushed)+len(rest))
+	for _, link := range pushed {
+		links = append(links, w.opts.annotate(link))
+	}
+
+	for _, link := range w.edgePushed {
+		links = append(links, w.opts.annotate(link))
+	}
+
+	for _, link := range rest {
+		links = append(links, addNoPush(link))
+	}
+
+	return links
+}
+
+func (o *options) annotate(link string) string {
+	if o.edgeAnnotate == nil {
+		return link
+	}
+
+	return o.edgeAnnotate(link)
+}
+
+func addNoPush(link string) string {
+	for field, rest := nextField(link); field != ""; field, rest = nextField(rest) {
+		if field == "nopush" {
+			return link
+		}
+	}
+
+	return link + "; nopush"
+}
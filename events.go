@@ -0,0 +1,128 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event is a push decision delivered to subscribers.
+type Event struct {
+	PushEvent
+
+	// Time is when the decision was made.
+	Time time.Time
+	// Host and Path are taken from the request that
+	// carried the Link header.
+	Host, Path string
+}
+
+// Subscription receives the push decisions of a handler.
+type Subscription struct {
+	// C delivers events. It is closed by Close, or when
+	// the handler is shut down.
+	C <-chan Event
+
+	c       chan Event
+	hub     *eventHub
+	dropped uint64
+}
+
+// Dropped returns the number of events that were dropped
+// because C was full.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close stops delivery of events and closes C.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	if _, ok := s.hub.subs[s]; !ok {
+		return
+	}
+
+	delete(s.hub.subs, s)
+	atomic.AddInt32(&s.hub.n, -1)
+	close(s.c)
+}
+
+type eventHub struct {
+	n int32
+
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+func (h *eventHub) subscribe(buffer int) *Subscription {
+	c := make(chan Event, buffer)
+	s := &Subscription{
+		C: c,
+
+		c:   c,
+		hub: h,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// A handler that has been shut down delivers no more
+	// events.
+	if h.closed {
+		close(c)
+		return s
+	}
+
+	if h.subs == nil {
+		h.subs = make(map[*Subscription]struct{})
+	}
+	h.subs[s] = struct{}{}
+	atomic.AddInt32(&h.n, 1)
+
+	return s
+}
+
+// close closes every Subscription, and those made later.
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for s := range h.subs {
+		delete(h.subs, s)
+		atomic.AddInt32(&h.n, -1)
+		close(s.c)
+	}
+}
+
+func (h *eventHub) publish(r *http.Request, e PushEvent, now time.Time) {
+	if atomic.LoadInt32(&h.n) == 0 {
+		return
+	}
+
+	ev := Event{
+		PushEvent: e,
+
+		Time: now,
+		Host: r.Host,
+		Path: r.URL.Path,
+	}
+
+	h.mu.RLock()
+	for s := range h.subs {
+		select {
+		case s.c <- ev:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+	h.mu.RUnlock()
+}
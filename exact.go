@@ -0,0 +1,162 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"slices"
+
+	"github.com/willf/bloom"
+)
+
+// exactPrefix marks a cookie value holding an exact set. It
+// is in the alphabet of neither base64 encoding nor is it
+// compactPrefix.
+const exactPrefix = "!"
+
+// An exact set stores, for each target, the k bit
+// locations it sets in a bloom filter with m bits. Two
+// targets are only confused if all of their locations
+// match, and the bloom filter is rebuilt from the set when
+// it grows beyond Options.ExactThreshold.
+//
+// The encoding is exactPrefix followed by the unpadded
+// base64url encoding of m, k and then the locations of
+// each target, all as uvarints.
+
+var errMalformedExact = errors.New("go-server-push: malformed exact set")
+
+// exactLocations returns the k locations of path in a bloom
+// filter with m bits.
+func exactLocations(path string, m, k uint) []uint64 {
+	locs := bloom.Locations([]byte(path), k)
+	for i := range locs {
+		locs[i] %= uint64(m)
+	}
+
+	return locs
+}
+
+// test reports whether path is in the client's filter. While
+// the filter is an exact set, the set is consulted rather
+// than the bloom filter.
+func (w *pushResponseWriter) test(path string) bool {
+	if w.opts.targetTTL != nil && w.opts.ttlBucket > 0 {
+		return w.testBuckets(path)
+	}
+
+	if !w.exactMode {
+		return w.bloom.TestString(path)
+	}
+
+	k := int(w.opts.k)
+	locs := exactLocations(path, w.opts.m, w.opts.k)
+	for set := w.exact; len(set) != 0; set = set[k:] {
+		if slices.Equal(set[:k], locs) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// add adds path to the client's filter, upgrading an exact
+// set that grows beyond Options.ExactThreshold to a bloom
+// filter.
+func (w *pushResponseWriter) add(path string) {
+	w.bloom.AddString(path)
+
+	if w.opts.ttlBucket > 0 {
+		w.addBucket(path)
+	}
+
+	if !w.exactMode || w.test(path) {
+		return
+	}
+
+	if len(w.exact)/int(w.opts.k) >= w.opts.exactThreshold {
+		w.exactMode, w.exact = false, w.exact[:0]
+		return
+	}
+
+	w.exact = append(w.exact, exactLocations(path, w.opts.m, w.opts.k)...)
+}
+
+// encodeExact encodes the exact set of locations for a
+// bloom filter with m bits and k hash functions into a
+// cookie value.
+func encodeExact(m, k uint, set []uint64) string {
+	b := make([]byte, 0, 2*binary.MaxVarintLen64+3*len(set))
+	b = binary.AppendUvarint(b, uint64(m))
+	b = binary.AppendUvarint(b, uint64(k))
+	for _, loc := range set {
+		b = binary.AppendUvarint(b, loc)
+	}
+
+	return exactPrefix + base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeExact decodes an exact set, without exactPrefix, and
+// the bloom filter it describes, as for decodeFilterPooled.
+// The set is only returned if the filter has m bits and k
+// hash functions.
+func decodeExact(value string, m, k uint) (f *bloom.BloomFilter, fw *filterWords, set []uint64, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	fm, n := binary.Uvarint(b)
+	if n <= 0 || !poolable(uint(fm)) || fm > maxBits(m) {
+		return nil, nil, nil, errMalformedExact
+	}
+
+	b = b[n:]
+
+	fk, n := binary.Uvarint(b)
+	if n <= 0 || fk == 0 || fk > 64 {
+		return nil, nil, nil, errMalformedExact
+	}
+
+	b = b[n:]
+
+	for len(b) != 0 {
+		loc, n := binary.Uvarint(b)
+		if n <= 0 || loc >= fm {
+			return nil, nil, nil, errMalformedExact
+		}
+
+		b = b[n:]
+		set = append(set, loc)
+	}
+
+	if len(set)%int(fk) != 0 {
+		return nil, nil, nil, errMalformedExact
+	}
+
+	exact := uint(fm) == m && uint(fk) == k
+
+	var words []uint64
+	if exact {
+		fw = getFilterWords(m)
+		words = fw.words
+		clear(words)
+	} else {
+		words = make([]uint64, fm/64)
+	}
+
+	for _, loc := range set {
+		words[loc/64] |= 1 << (loc % 64)
+	}
+
+	if !exact {
+		set = nil
+	}
+
+	return bloom.From(words, uint(fk)), fw, set, nil
+}
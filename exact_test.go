@@ -0,0 +1,98 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/willf/bloom"
+)
+
+func TestExactRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		m, k uint
+		n    int
+	}{
+		{"empty", 1024, 4, 0},
+		{"one", 1024, 4, 1},
+		{"several", 2048, 7, 8},
+		{"single hash", 64, 1, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := bloom.New(tc.m, tc.k)
+
+			var set []uint64
+			for i := 0; i < tc.n; i++ {
+				path := "/static/" + strconv.Itoa(i) + ".css"
+				f.AddString(path)
+				set = append(set, exactLocations(path, tc.m, tc.k)...)
+			}
+
+			v := encodeExact(tc.m, tc.k, set)
+			if !strings.HasPrefix(v, exactPrefix) {
+				t.Fatalf("encodeExact = %q, missing %q prefix", v, exactPrefix)
+			}
+
+			got, _, gotSet, err := decodeExact(v[len(exactPrefix):], tc.m, tc.k)
+			if err != nil {
+				t.Fatalf("decodeExact(%q): %v", v, err)
+			}
+
+			if !slices.Equal(gotSet, set) {
+				t.Errorf("decoded set = %v, want %v", gotSet, set)
+			}
+
+			if !got.Equal(f) {
+				t.Error("decoded filter differs from the filter of the set")
+			}
+
+			// With other parameters, only the filter is
+			// returned, as the set cannot be extended.
+			got, _, gotSet, err = decodeExact(v[len(exactPrefix):], 0, 0)
+			if err != nil {
+				t.Fatalf("decodeExact(%q, 0, 0): %v", v, err)
+			}
+
+			if gotSet != nil {
+				t.Errorf("decoded set for other parameters = %v, want nil", gotSet)
+			}
+
+			if !got.Equal(f) {
+				t.Error("decoded filter differs from the filter of the set")
+			}
+		})
+	}
+}
+
+func TestExactMalformed(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		value string
+		m     uint
+	}{
+		{"bad base64", "*", 0},
+		{"empty", "", 0},
+		{"zero m", rawURL(0, 1), 0},
+		{"unaligned m", rawURL(100, 1), 0},
+		{"m too large", rawURL(0x80, 0x01, 1), 64},
+		{"missing k", rawURL(64), 0},
+		{"zero k", rawURL(64, 0), 0},
+		{"k too large", rawURL(64, 65), 0},
+		{"location beyond m", rawURL(64, 1, 64), 0},
+		{"partial target", rawURL(64, 2, 1, 2, 3), 0},
+		{"truncated location", rawURL(64, 1, 0x80), 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, _, err := decodeExact(tc.value, tc.m, 1); err == nil {
+				t.Errorf("decodeExact(%q) succeeded", tc.value)
+			}
+		})
+	}
+}
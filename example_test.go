@@ -0,0 +1,31 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush_test
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	serverpush "github.com/tmthrgd/go-server-push"
+)
+
+func ExampleNewWithConfig() {
+	files := http.FileServer(http.Dir("static"))
+
+	h, err := serverpush.NewWithConfig(files, serverpush.Config{
+		FilterBits: 1 << 11,
+		Hashes:     7,
+		Options: serverpush.Options{
+			CookieRefresh: 24 * time.Hour,
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Fatal(http.ListenAndServeTLS(":8443", "cert.pem", "key.pem", h))
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import "expvar"
+
+const (
+	pushesVar       = "pushes"
+	filterResetsVar = "filter_resets"
+	errorsVar       = "errors"
+	filteredVar     = "filtered"
+	observedVar     = "observed"
+	overBudgetVar   = "over_budget"
+	wastedVar       = "wasted"
+
+	redirectPushesVar   = "redirect_pushes"
+	oversizedCookiesVar = "oversized_cookies"
+
+	pushedTargetsVar   = "pushed_targets"
+	filteredTargetsVar = "filtered_targets"
+
+	filterLoadNsVar = "filter_load_ns"
+	filterSaveNsVar = "filter_save_ns"
+	pushNsVar       = "push_ns"
+)
+
+func (o *options) add(key string, delta int64) {
+	if o.vars != nil {
+		o.vars.Add(key, delta)
+	}
+}
+
+func (o *options) initVars(perTarget bool) {
+	if o.vars == nil || !perTarget {
+		return
+	}
+
+	o.pushedTargets = nestedMap(o.vars, pushedTargetsVar)
+	o.filteredTargets = nestedMap(o.vars, filteredTargetsVar)
+}
+
+// nestedMap returns the map held in vars under key, adding
+// one if there is none. The counts in an existing map are
+// kept, so they survive SetOptions.
+func nestedMap(vars *expvar.Map, key string) *expvar.Map {
+	if m, ok := vars.Get(key).(*expvar.Map); ok {
+		return m
+	}
+
+	m := new(expvar.Map).Init()
+	vars.Set(key, m)
+	return m
+}
+
+func (o *options) addOutcome(target string, outcome Outcome) {
+	if o.vars == nil {
+		return
+	}
+
+	switch outcome {
+	case Pushed:
+		o.vars.Add(pushesVar, 1)
+
+		if o.pushedTargets != nil {
+			o.pushedTargets.Add(target, 1)
+		}
+	case Filtered:
+		o.vars.Add(filteredVar, 1)
+
+		if o.filteredTargets != nil {
+			o.filteredTargets.Add(target, 1)
+		}
+	case Observed:
+		o.vars.Add(observedVar, 1)
+	case OverBudget:
+		o.vars.Add(overBudgetVar, 1)
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"expvar"
+	"fmt"
+	"testing"
+)
+
+func TestExpvarPerTargetSetOptions(t *testing.T) {
+	vars := new(expvar.Map).Init()
+	opts := &Options{Expvar: vars, ExpvarPerTarget: true}
+
+	s := New(1<<16, 4, nil, opts)
+	for i := 0; i < 3; i++ {
+		s.opts.Load().addOutcome("/a.css", Pushed)
+
+		if err := s.SetOptions(1<<16, 4, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pushed, _ := vars.Get(pushedTargetsVar).(*expvar.Map)
+	if pushed == nil {
+		t.Fatal("per-target map missing")
+	}
+
+	if got := fmt.Sprint(pushed.Get("/a.css")); got != "3" {
+		t.Errorf("per-target count = %s after SetOptions, want 3", got)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import "net/http"
+
+// Fallback is the behaviour of the handler when the client
+// has disabled server push or the connection, such as an
+// HTTP/1.1 connection, does not support it.
+type Fallback int
+
+const (
+	// FallbackLink leaves the Link headers in place for the
+	// client to preload. It is the default.
+	FallbackLink Fallback = iota
+	// FallbackEarlyHints additionally sends the Link
+	// headers in a 103 Early Hints response before the
+	// final response.
+	FallbackEarlyHints
+	// FallbackFunc calls Options.FallbackFunc.
+	FallbackFunc
+)
+
+var fallbackNames = [...]string{
+	FallbackLink:       "link",
+	FallbackEarlyHints: "early-hints",
+	FallbackFunc:       "func",
+}
+
+func (f Fallback) String() string {
+	if f < 0 || int(f) >= len(fallbackNames) {
+		return "unknown"
+	}
+
+	return fallbackNames[f]
+}
+
+// fallback is called with the links that were not pushed
+// because the client does not support push.
+func (w *pushResponseWriter) fallback(links []string) {
+	f := w.opts.fallbackFor(w.req)
+
+	switch f {
+	case FallbackEarlyHints:
+		w.earlyHints(links)
+	case FallbackFunc:
+		if w.opts.fallbackFunc != nil {
+			w.opts.fallbackFunc(w.ResponseWriter, w.req, links)
+		}
+	}
+
+	if hooks := w.opts.hooks; hooks != nil && hooks.Fallback != nil {
+		hooks.Fallback(w.req, f, links)
+	}
+}
+
+// fallbackFor returns the Fallback used for r.
+func (o *options) fallbackFor(r *http.Request) Fallback {
+	if o.http3EarlyHints && r.ProtoMajor == 3 {
+		return FallbackEarlyHints
+	}
+
+	return o.fallback
+}
+
+// earlyHints sends a 103 Early Hints response carrying only
+// the given links, without the other response headers.
+func (w *pushResponseWriter) earlyHints(links []string) {
+	h := w.Header()
+
+	saved := make(http.Header, len(h))
+	for k, v := range h {
+		saved[k] = v
+		delete(h, k)
+	}
+
+	h["Link"] = links
+	w.ResponseWriter.WriteHeader(http.StatusEarlyHints)
+
+	delete(h, "Link")
+	for k, v := range saved {
+		h[k] = v
+	}
+}
@@ -0,0 +1,410 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/willf/bloom"
+)
+
+var (
+	flateReaderPool sync.Pool
+	flateWriterPool sync.Pool
+
+	bufferPool = &sync.Pool{
+		New: func() interface{} {
+			return new(bytes.Buffer)
+		},
+	}
+)
+
+// filterWords holds the bitset of a bloom filter whose
+// size is a whole number of words. As bloom.From uses the
+// words it is given, they are reused through filterPool
+// for the filters of later requests.
+type filterWords struct {
+	words []uint64
+	buf   [512]byte
+}
+
+var filterPool sync.Pool
+
+func getFilterWords(m uint) *filterWords {
+	n := int(m / 64)
+	if fw, _ := filterPool.Get().(*filterWords); fw != nil && cap(fw.words) >= n {
+		fw.words = fw.words[:n]
+		return fw
+	}
+
+	return &filterWords{words: make([]uint64, n)}
+}
+
+// poolable reports whether filters with m bits may use
+// filterWords. bloom.From sizes the filter to its words,
+// so only then is it the same as bloom.New(m, k).
+func poolable(m uint) bool {
+	return m != 0 && m%64 == 0
+}
+
+// newFilter returns an empty bloom filter with m bits and
+// k hash functions. If fw is non-nil, it holds the bits of
+// the filter and may be returned to filterPool once the
+// filter is no longer used.
+func newFilter(m, k uint) (f *bloom.BloomFilter, fw *filterWords) {
+	if !poolable(m) {
+		return bloom.New(m, k), nil
+	}
+
+	fw = getFilterWords(m)
+	clear(fw.words)
+	return bloom.From(fw.words, k), fw
+}
+
+// maxCookieSize is the longest cookie value that is
+// decoded. It is the limit browsers place on the size of
+// a cookie.
+const maxCookieSize = 4096
+
+// maxFilterBits limits the size of the filters decoded when
+// the configured size is not known, as a cookie of a few
+// bytes may otherwise claim an arbitrarily large filter.
+const maxFilterBits = 1 << 24
+
+var (
+	errCookieTooLarge = errors.New("go-server-push: bloom filter cookie too large")
+	errFilterTooLarge = errors.New("go-server-push: bloom filter larger than configured")
+)
+
+// maxBits returns the largest filter accepted by a handler
+// with filters of m bits. Filters with fewer bits, as set
+// before m was increased, are still read.
+func maxBits(m uint) uint64 {
+	if m == 0 {
+		return maxFilterBits
+	}
+
+	return uint64(m)
+}
+
+// decodeFilter decodes a bloom filter from a cookie value.
+func decodeFilter(value string) (f *bloom.BloomFilter, err error) {
+	f, _, err = decodeFilterPooled(value, 0, 0)
+	return f, err
+}
+
+// decodeFilterPooled is like decodeFilter, but if the filter
+// has m bits and k hash functions, as it does when it was
+// set with the current options, and m is poolable, its
+// bits are read into filterWords from filterPool.
+func decodeFilterPooled(value string, m, k uint) (f *bloom.BloomFilter, fw *filterWords, err error) {
+	if len(value) > maxCookieSize {
+		return nil, nil, errCookieTooLarge
+	}
+
+	if compact, ok := strings.CutPrefix(value, compactPrefix); ok {
+		return decodeCompact(compact, m, k)
+	}
+
+	if set, ok := strings.CutPrefix(value, exactPrefix); ok {
+		f, fw, _, err = decodeExact(set, m, k)
+		return f, fw, err
+	}
+
+	// The union of all buckets is returned, as if none had
+	// expired.
+	if buckets, ok := strings.CutPrefix(value, bucketsPrefix); ok {
+		_, f, fw, err = decodeBuckets(buckets, m, k, -1, math.MaxInt)
+		return f, fw, err
+	}
+
+	sr := strings.NewReader(value)
+	b64r := base64.NewDecoder(base64.RawStdEncoding, sr)
+
+	fr, _ := flateReaderPool.Get().(io.ReadCloser)
+	if fr == nil {
+		fr = flate.NewReader(b64r)
+	} else if err := fr.(flate.Resetter).Reset(b64r, nil); err != nil {
+		panic(err)
+	}
+
+	// The m, k and bitset length words are followed by at
+	// most maxBits(m) bits.
+	limit := 24 + 8*int64((maxBits(m)+63)/64)
+	f, fw, err = readFilter(io.LimitReader(fr, limit), m, k)
+
+	if cerr := fr.Close(); err == nil {
+		err = cerr
+	}
+
+	flateReaderPool.Put(fr)
+
+	if err != nil {
+		if fw != nil {
+			filterPool.Put(fw)
+		}
+
+		return nil, nil, err
+	}
+
+	return f, fw, nil
+}
+
+// readFilter reads a filter in the format of
+// bloom.BloomFilter's WriteTo: the m, k and bitset length
+// as big-endian words, followed by the words of the set.
+func readFilter(r io.Reader, m, k uint) (*bloom.BloomFilter, *filterWords, error) {
+	var hdr [24]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, nil, err
+	}
+
+	// The bitset is allocated before its words are read,
+	// and each test of the filter takes k steps.
+	if binary.BigEndian.Uint64(hdr[0:]) > maxBits(m) ||
+		binary.BigEndian.Uint64(hdr[8:]) > 64 ||
+		binary.BigEndian.Uint64(hdr[16:]) > maxBits(m) {
+		return nil, nil, errFilterTooLarge
+	}
+
+	if !poolable(m) ||
+		binary.BigEndian.Uint64(hdr[0:]) != uint64(m) ||
+		binary.BigEndian.Uint64(hdr[8:]) != uint64(k) ||
+		binary.BigEndian.Uint64(hdr[16:]) != uint64(m) {
+		f := new(bloom.BloomFilter)
+		_, err := f.ReadFrom(io.MultiReader(bytes.NewReader(hdr[:]), r))
+		return f, nil, err
+	}
+
+	fw := getFilterWords(m)
+	for words := fw.words; len(words) != 0; {
+		n := min(len(words), len(fw.buf)/8)
+		if _, err := io.ReadFull(r, fw.buf[:n*8]); err != nil {
+			return nil, fw, err
+		}
+
+		for i := range words[:n] {
+			words[i] = binary.BigEndian.Uint64(fw.buf[i*8:])
+		}
+
+		words = words[n:]
+	}
+
+	return bloom.From(fw.words, k), fw, nil
+}
+
+// encodeFilter encodes a bloom filter into a cookie value.
+func encodeFilter(f *bloom.BloomFilter) (v string, err error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	b64w := base64.NewEncoder(base64.RawStdEncoding, buf)
+
+	fw, _ := flateWriterPool.Get().(*flate.Writer)
+	if fw != nil {
+		fw.Reset(b64w)
+	} else if fw, err = flate.NewWriter(b64w, flate.BestSpeed); err != nil {
+		return
+	}
+
+	if _, err = f.WriteTo(fw); err != nil {
+		return
+	}
+
+	if err = fw.Close(); err != nil {
+		return
+	}
+
+	flateWriterPool.Put(fw)
+
+	if err = b64w.Close(); err != nil {
+		return
+	}
+
+	v = buf.String()
+
+	buf.Reset()
+	bufferPool.Put(buf)
+	return
+}
+
+// releaseFilter returns the bits of the bloom filter to
+// filterPool once the response is complete.
+func (w *pushResponseWriter) releaseFilter() {
+	if w.filterWords == nil {
+		return
+	}
+
+	filterPool.Put(w.filterWords)
+	w.bloom, w.filterWords = nil, nil
+}
+
+// FilterInfo describes a decoded bloom filter cookie.
+type FilterInfo struct {
+	// M is the number of bits in the filter.
+	M uint
+	// K is the number of hash functions.
+	K uint
+	// FillRatio is the fraction of bits that are set.
+	FillRatio float64
+	// Generation is the Manifest Fingerprint the filter
+	// was saved with, or zero if ResetOnAssetChange was
+	// not set.
+	Generation uint64
+	// PushDisabled is true if the client was found to have
+	// disabled push. See Options.RememberNoPush.
+	PushDisabled bool
+
+	f *bloom.BloomFilter
+
+	// key, if non-nil, returns the key of a path in the
+	// filter, as set by PushHandler.Inspect.
+	key func(path string) string
+}
+
+// Test returns true if path is probably in the filter,
+// meaning it has already been pushed to the client.
+//
+// For a FilterInfo returned by InspectCookie, path must be
+// given as it is recorded in the filter. One returned by
+// PushHandler.Inspect looks path up as the handler would.
+func (fi *FilterInfo) Test(path string) bool {
+	if fi.key != nil {
+		path = fi.key(path)
+	}
+
+	return fi.f.TestString(path)
+}
+
+// ErrFilterMismatch is returned by FilterInfo.Union when
+// the filters have different parameters or generations.
+var ErrFilterMismatch = errors.New("go-server-push: bloom filters do not match")
+
+// Union adds the targets of other to fi, so that filters
+// learned for the same client by different servers, such
+// as those behind a load balancer without sticky sessions,
+// may be reconciled rather than one replacing the other.
+// Both filters must have the same M, K and Generation.
+func (fi *FilterInfo) Union(other *FilterInfo) error {
+	if fi.Generation != other.Generation || fi.f.Merge(other.f) != nil {
+		return ErrFilterMismatch
+	}
+
+	fi.FillRatio = fillRatio(fi.f)
+	return nil
+}
+
+// CookieValue encodes the filter as the value of a cookie
+// that may be set in place of that of the push handler.
+func (fi *FilterInfo) CookieValue() (string, error) {
+	v, err := encodeFilter(fi.f)
+	if err != nil {
+		return "", err
+	}
+
+	v = joinGeneration(fi.Generation, v)
+	if fi.PushDisabled {
+		v = noPushPrefix + v
+	}
+
+	return v, nil
+}
+
+// InspectCookie decodes the value of a cookie set by the
+// push handler.
+func InspectCookie(value string) (*FilterInfo, error) {
+	value, noPush := strings.CutPrefix(value, noPushPrefix)
+	gen, value := splitGeneration(value)
+
+	f, err := decodeFilter(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FilterInfo{
+		M:            f.Cap(),
+		K:            f.K(),
+		FillRatio:    fillRatio(f),
+		Generation:   gen,
+		PushDisabled: noPush,
+
+		f: f,
+	}, nil
+}
+
+// Inspect decodes the bloom filter cookie sent with r, as
+// InspectCookie does. The Test method of the FilterInfo
+// rewrites, cleans and canonicalises the query of each path
+// as the handler would before looking it up, in the
+// partition of the top-level site of r if
+// Options.PartitionBySite is set. It returns
+// http.ErrNoCookie if r has no cookie.
+func (s *PushHandler) Inspect(r *http.Request) (*FilterInfo, error) {
+	o := s.opts.Load()
+	return o.inspect(r, o.topLevelSite(r))
+}
+
+// inspect decodes the cookie sent with r, looking paths up
+// in the partition of site.
+func (o *options) inspect(r *http.Request, site string) (*FilterInfo, error) {
+	c, err := r.Cookie(o.cookie.Name)
+	if err == nil && c.Value == "" {
+		err = http.ErrNoCookie
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := InspectCookie(c.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	fi.key = func(path string) string {
+		return o.inspectKey(site, path)
+	}
+
+	return fi, nil
+}
+
+// inspectKey returns the key that target has in the
+// partition of site once it has been rewritten and cleaned
+// as pushTarget does.
+func (o *options) inspectKey(site, target string) string {
+	if rewritten, ok := o.rewrite(target); ok {
+		target = rewritten
+	}
+
+	if clean, ok := cleanTarget(target); ok {
+		target = clean
+	}
+
+	return o.siteFilterKey(site, target)
+}
+
+// fillRatio returns the fraction of bits set in the filter.
+func fillRatio(f *bloom.BloomFilter) float64 {
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil || f.Cap() == 0 {
+		return 0
+	}
+
+	// Skip the m, k and bitset length words.
+	var set int
+	for _, b := range buf.Bytes()[24:] {
+		set += bits.OnesCount8(b)
+	}
+
+	return float64(set) / float64(f.Cap())
+}
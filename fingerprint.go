@@ -0,0 +1,150 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"hash/fnv"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// LogicalName returns p with any content hash removed from
+// its file name, so that each build of an asset shares a
+// name: both /js/app.3fa9c1.js and /js/app-3fa9c1.js
+// become /js/app.js. Paths without a recognisable hash are
+// returned unchanged.
+//
+// A hash is a run of at least six hexadecimal digits, or
+// of at least eight letters, digits and underscores, that
+// contains a digit.
+func LogicalName(p string) string {
+	dir, file := path.Split(p)
+
+	parts := strings.Split(file, ".")
+	if len(parts) < 2 {
+		return p
+	}
+
+	out := parts[:1]
+	for _, part := range parts[1 : len(parts)-1] {
+		if !isHash(part) {
+			out = append(out, part)
+		}
+	}
+
+	out = append(out, parts[len(parts)-1])
+
+	if i := strings.LastIndexByte(out[0], '-'); i > 0 && isHash(out[0][i+1:]) {
+		out[0] = out[0][:i]
+	}
+
+	return dir + strings.Join(out, ".")
+}
+
+func isHash(s string) bool {
+	hex, digit := true, false
+	for _, c := range s {
+		switch {
+		case '0' <= c && c <= '9':
+			digit = true
+		case 'a' <= c && c <= 'f', 'A' <= c && c <= 'F':
+		case 'g' <= c && c <= 'z', 'G' <= c && c <= 'Z', c == '_':
+			hex = false
+		default:
+			return false
+		}
+	}
+
+	return digit && (hex && len(s) >= 6 || len(s) >= 8)
+}
+
+// logicalName returns the logical name of res.
+func (res Resource) logicalName() string {
+	if res.Name != "" {
+		return res.Name
+	}
+
+	return LogicalName(res.Path)
+}
+
+// assets returns the fingerprinted assets listed in
+// routes, mapping each logical name to its current path.
+func assets(routes map[string][]Resource) map[string]string {
+	a := make(map[string]string)
+	for _, resources := range routes {
+		for _, res := range resources {
+			if name := res.logicalName(); name != res.Path {
+				a[name] = res.Path
+			}
+		}
+	}
+
+	return a
+}
+
+// fingerprint returns a hash of the paths of the
+// fingerprinted assets in a, or zero if there are none. It
+// changes whenever the hash of any asset does.
+func fingerprint(a map[string]string) uint64 {
+	if len(a) == 0 {
+		return 0
+	}
+
+	paths := make([]string, 0, len(a))
+	for _, p := range a {
+		paths = append(paths, p)
+	}
+
+	slices.Sort(paths)
+
+	h := fnv.New64a()
+	for _, p := range paths {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+
+	if sum := h.Sum64(); sum != 0 {
+		return sum
+	}
+
+	return 1
+}
+
+// generation returns the generation of the bloom filter
+// that clients are expected to hold.
+func (o *options) generation() uint64 {
+	if !o.resetOnAssetChange || o.manifest == nil {
+		return 0
+	}
+
+	return o.manifest.Fingerprint()
+}
+
+// splitGeneration splits the generation prefix, which
+// cannot be confused with base64, from a cookie value.
+func splitGeneration(value string) (gen uint64, filter string) {
+	prefix, filter, ok := strings.Cut(value, ".")
+	if !ok {
+		return 0, value
+	}
+
+	gen, err := strconv.ParseUint(prefix, 36, 64)
+	if err != nil {
+		return 0, value
+	}
+
+	return gen, filter
+}
+
+func joinGeneration(gen uint64, filter string) string {
+	if gen == 0 {
+		return filter
+	}
+
+	return strconv.FormatUint(gen, 36) + "." + filter
+}
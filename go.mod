@@ -0,0 +1,16 @@
+module github.com/tmthrgd/go-server-push
+
+go 1.22
+
+require (
+	github.com/golang/gddo v0.0.0-20180823221919-9d8ff1c67be5
+	github.com/willf/bloom v2.0.3+incompatible
+	golang.org/x/net v0.35.0
+)
+
+require (
+	github.com/google/go-cmp v0.5.8 // indirect
+	github.com/spaolacci/murmur3 v1.1.0 // indirect
+	github.com/willf/bitset v1.1.11 // indirect
+	golang.org/x/text v0.22.0 // indirect
+)
@@ -0,0 +1,189 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Outcome is the result of considering a preload link
+// for push.
+type Outcome int
+
+const (
+	// Pushed means the resource was pushed to the client.
+	Pushed Outcome = iota
+	// Filtered means the resource was found in the bloom
+	// filter and was not pushed again.
+	Filtered
+	// NoPush means the link carried the nopush attribute,
+	// or its target is blocked by Options.Blocklist.
+	NoPush
+	// NotSupported means the connection does not support
+	// server push.
+	NotSupported
+	// Failed means the push returned an error.
+	Failed
+	// Observed means the resource would have been pushed,
+	// but the handler is in observe only mode.
+	Observed
+	// OverBudget means the resource was not pushed as its
+	// Size would have exceeded Options.PushBudget, or as
+	// Options.PushTimeBudget was spent.
+	OverBudget
+)
+
+var outcomeNames = [...]string{
+	Pushed:       "pushed",
+	Filtered:     "filtered",
+	NoPush:       "nopush",
+	NotSupported: "not-supported",
+	Failed:       "failed",
+	Observed:     "observed",
+	OverBudget:   "over-budget",
+}
+
+func (o Outcome) String() string {
+	if o < 0 || int(o) >= len(outcomeNames) {
+		return "unknown"
+	}
+
+	return outcomeNames[o]
+}
+
+// PushEvent describes a single push decision.
+type PushEvent struct {
+	// Target is the path of the linked resource.
+	Target string
+	// Outcome is the decision that was made.
+	Outcome Outcome
+	// Duration is the time taken to reach the decision,
+	// including any call to Push but excluding the time
+	// taken to load the bloom filter.
+	Duration time.Duration
+	// Err is the error returned by Push, if any.
+	Err error
+	// Redirect is true if Target is the Location of a
+	// redirect response rather than a preload link.
+	Redirect bool
+}
+
+// Hooks contains optional callbacks that are invoked by
+// the handler. Any of the fields may be nil.
+type Hooks struct {
+	// Push is called once for each preload link after a
+	// push decision has been made.
+	Push func(r *http.Request, e PushEvent)
+
+	// FilterLoad is called after the bloom filter has
+	// been decoded from the request cookie, with the time
+	// taken and any error that occurred.
+	FilterLoad func(r *http.Request, d time.Duration, err error)
+
+	// FilterSave is called after the bloom filter has
+	// been encoded into the response cookie, with the
+	// time taken and any error that occurred.
+	FilterSave func(r *http.Request, d time.Duration, err error)
+
+	// Fallback is called with the Link headers that were
+	// left unpushed because server push is not supported,
+	// after the configured fallback has run.
+	Fallback func(r *http.Request, f Fallback, links []string)
+
+	// Wasted is called when a client requests a target
+	// soon after it was pushed to it. See
+	// Options.WasteWindow.
+	Wasted func(r *http.Request, target string)
+
+	// Nested is called when the handler passes a request
+	// through because a push handler it is wrapped by
+	// already makes the same pushes, as happens when the
+	// middleware is applied twice.
+	Nested func(r *http.Request)
+
+	// PushTimeExceeded is called, at most once for each
+	// response, when Options.PushTimeBudget is spent with
+	// targets left to push, with the time spent.
+	PushTimeExceeded func(r *http.Request, elapsed time.Duration)
+
+	// ShadowDiverged is called when the targets pushed for
+	// a response differ from those the Options.Shadow
+	// would have pushed, with the targets only pushed by
+	// the handler and those only the Shadow would have
+	// pushed.
+	ShadowDiverged func(r *http.Request, liveOnly, shadowOnly []string)
+}
+
+func (o *options) filterLoaded(r *http.Request, d time.Duration, err error) {
+	o.add(filterLoadNsVar, int64(d))
+
+	if o.stats != nil {
+		o.stats.recordLoad(err)
+	}
+
+	if o.hooks != nil && o.hooks.FilterLoad != nil {
+		o.hooks.FilterLoad(r, d, err)
+	}
+}
+
+func (o *options) filterSaved(r *http.Request, d time.Duration, err error) {
+	o.add(filterSaveNsVar, int64(d))
+
+	if o.stats != nil {
+		o.stats.recordSave(err)
+	}
+
+	if o.hooks != nil && o.hooks.FilterSave != nil {
+		o.hooks.FilterSave(r, d, err)
+	}
+}
+
+func (w *pushResponseWriter) record(target string, outcome Outcome, start time.Time, err error) {
+	w.opts.logDecision(w.req, target, outcome, err)
+
+	w.opts.addOutcome(target, outcome)
+
+	if w.redirect && outcome == Pushed {
+		w.opts.add(redirectPushesVar, 1)
+	}
+
+	now := w.opts.clock.Now()
+
+	if w.opts.stats != nil {
+		w.opts.stats.record(target, outcome, now)
+	}
+
+	d := now.Sub(start)
+	if outcome == Pushed || outcome == Failed {
+		w.opts.add(pushNsVar, int64(d))
+	}
+
+	hooks := w.opts.hooks
+	if w.result == nil && (hooks == nil || hooks.Push == nil) &&
+		atomic.LoadInt32(&w.opts.events.n) == 0 {
+		return
+	}
+
+	e := PushEvent{
+		Target:   target,
+		Outcome:  outcome,
+		Duration: d,
+		Err:      err,
+		Redirect: w.redirect,
+	}
+
+	if w.result != nil {
+		w.result.Events = append(w.result.Events, e)
+	}
+
+	if hooks != nil && hooks.Push != nil {
+		hooks.Push(w.req, e)
+	}
+
+	w.opts.events.publish(w.req, e, now)
+}
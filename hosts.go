@@ -0,0 +1,75 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HostHandler is a push aware http.Handler that is
+// configured separately for each request Host. It is
+// returned by NewPerHost.
+type HostHandler struct {
+	def   *PushHandler
+	hosts map[string]*PushHandler
+}
+
+// NewPerHost wraps the given http.Handler in a push aware
+// handler that uses the Config in hosts matching the Host
+// of each request, ignoring any port and case, or def if
+// there is none. This allows the cookie domain, filter
+// parameters and push policy to vary by virtual host.
+//
+// Each host has its own handler, as returned by Host, so
+// Stats, Expvar and Hooks are only shared if the Configs
+// share them.
+func NewPerHost(handler http.Handler, def Config, hosts map[string]Config) (*HostHandler, error) {
+	dh, err := NewWithConfig(handler, def)
+	if err != nil {
+		return nil, err
+	}
+
+	hh := &HostHandler{
+		def:   dh,
+		hosts: make(map[string]*PushHandler, len(hosts)),
+	}
+
+	for host, c := range hosts {
+		ph, err := NewWithConfig(handler, c)
+		if err != nil {
+			return nil, err
+		}
+
+		hh.hosts[canonicalHost(host)] = ph
+	}
+
+	return hh, nil
+}
+
+// Host returns the handler used for host, which may be
+// used to update its options. If no Config was given for
+// host, the default handler is returned.
+func (hh *HostHandler) Host(host string) *PushHandler {
+	if ph, ok := hh.hosts[canonicalHost(host)]; ok {
+		return ph
+	}
+
+	return hh.def
+}
+
+func (hh *HostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	hh.Host(r.Host).ServeHTTP(w, r)
+}
+
+func canonicalHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
@@ -0,0 +1,36 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+// SetEnabled turns pushing by the handler on or off. While
+// it is off, every request is passed through to the wrapped
+// handler as with Options.Disabled. Unlike Options.Disabled
+// it is a single atomic store that is kept across calls to
+// SetOptions and Update, so that it may be wired to a
+// feature flag or an admin endpoint and used to stop
+// pushing during an incident. Requests that are already
+// being served are not affected.
+//
+// A handler is enabled when it is created.
+func (s *PushHandler) SetEnabled(enabled bool) {
+	s.off.Store(!enabled)
+}
+
+// Enabled reports whether pushing by the handler is turned
+// on. See SetEnabled.
+func (s *PushHandler) Enabled() bool {
+	return !s.off.Load()
+}
+
+// SetEnabled turns pushing on or off for the default
+// handler and that of every host. See
+// PushHandler.SetEnabled.
+func (hh *HostHandler) SetEnabled(enabled bool) {
+	hh.def.SetEnabled(enabled)
+	for _, ph := range hh.hosts {
+		ph.SetEnabled(enabled)
+	}
+}
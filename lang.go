@@ -0,0 +1,78 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/golang/gddo/httputil/header"
+)
+
+// selectLanguage returns resources with, of each set of
+// language variants, only the variant best matching the
+// Accept-Language header of r. Variants are resources with
+// a Lang and the same logical name. The first variant
+// listed is chosen if none match. If any resource has a
+// Lang, Accept-Language is added to the Vary header of the
+// response, h.
+func selectLanguage(h http.Header, r *http.Request, resources []Resource) []Resource {
+	if !slices.ContainsFunc(resources, func(res Resource) bool { return res.Lang != "" }) {
+		return resources
+	}
+
+	addVary(h, "Accept-Language")
+
+	accept := header.ParseAccept(r.Header, "Accept-Language")
+
+	best := make(map[string]int)
+	bestQ := make(map[string]float64)
+	for i, res := range resources {
+		if res.Lang == "" {
+			continue
+		}
+
+		name := res.logicalName()
+		q := languageQ(accept, res.Lang)
+		if _, ok := best[name]; !ok || q > bestQ[name] {
+			best[name], bestQ[name] = i, q
+		}
+	}
+
+	selected := make([]Resource, 0, len(resources))
+	for i, res := range resources {
+		if res.Lang == "" || best[res.logicalName()] == i {
+			selected = append(selected, res)
+		}
+	}
+
+	return selected
+}
+
+// languageQ returns the quality given to the language tag
+// lang by the Accept-Language ranges of accept. A range
+// matches a tag it equals or is a prefix of, as in RFC
+// 4647, and is matched by a tag that is a prefix of it,
+// so that a variant for "en" is chosen for "en-GB".
+func languageQ(accept []header.AcceptSpec, lang string) float64 {
+	var q float64
+	for _, spec := range accept {
+		if spec.Q > q && (spec.Value == "*" ||
+			langPrefix(spec.Value, lang) || langPrefix(lang, spec.Value)) {
+			q = spec.Q
+		}
+	}
+
+	return q
+}
+
+// langPrefix reports whether the language range or tag
+// prefix equals tag or is a prefix of it ending at a "-".
+func langPrefix(prefix, tag string) bool {
+	return len(tag) >= len(prefix) && strings.EqualFold(tag[:len(prefix)], prefix) &&
+		(len(tag) == len(prefix) || tag[len(prefix)] == '-')
+}
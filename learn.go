@@ -0,0 +1,312 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Learner builds a push manifest from live traffic. It
+// counts the documents served for each path and the
+// sub-resource requests that name those documents in their
+// Referer, so that resources that are fetched by most
+// visitors to a page can later be pushed with it.
+//
+// It is safe for concurrent use and the zero value is
+// ready to use.
+type Learner struct {
+	// MaxRoutes, if positive, limits the number of
+	// documents tracked. Documents seen once the limit is
+	// reached are ignored.
+	MaxRoutes int
+
+	// MaxResources, if positive, limits the number of
+	// sub-resources tracked for each document.
+	MaxResources int
+
+	mu     sync.Mutex
+	routes map[string]*learnedRoute
+}
+
+type learnedRoute struct {
+	views     int
+	resources map[string]*learnedResource
+}
+
+type learnedResource struct {
+	as    string
+	count int
+}
+
+// exportedRoute and exportedResource are the JSON form of
+// learnedRoute and learnedResource used by Export and
+// Import.
+type exportedRoute struct {
+	Views     int                         `json:"views"`
+	Resources map[string]exportedResource `json:"resources,omitempty"`
+}
+
+type exportedResource struct {
+	As    string `json:"as,omitempty"`
+	Count int    `json:"count"`
+}
+
+// Candidate is a sub-resource observed by a Learner.
+type Candidate struct {
+	Path string
+	As   string
+
+	// Confidence is the fraction of views of the document
+	// that were followed by a request for the resource,
+	// between 0 and 1.
+	Confidence float64
+}
+
+// Observe records r. Navigations are counted as views of
+// the request path. Other requests with a same-origin
+// Referer are counted as sub-resources of the referring
+// path.
+//
+// Requests are classified by their Sec-Fetch-Dest header,
+// falling back to the Accept header for clients that do
+// not send it.
+func (l *Learner) Observe(r *http.Request) {
+	if r.Method != http.MethodGet {
+		return
+	}
+
+	dest := r.Header.Get("Sec-Fetch-Dest")
+	if dest == "document" || dest == "" && acceptsHTML(r) {
+		l.view(r.URL.Path)
+		return
+	}
+
+	switch dest {
+	case "", "style", "script", "font", "image":
+	default:
+		return
+	}
+
+	ref, err := url.Parse(r.Header.Get("Referer"))
+	if err != nil || ref.Host != r.Host || ref.Path == "" {
+		return
+	}
+
+	l.resource(ref.Path, r.URL.Path, dest)
+}
+
+func acceptsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+func (l *Learner) view(path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if rt := l.route(path); rt != nil {
+		rt.views++
+	}
+}
+
+func (l *Learner) resource(doc, path, as string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if rt := l.route(doc); rt != nil {
+		l.add(rt, path, as, 1)
+	}
+}
+
+func (l *Learner) add(rt *learnedRoute, path, as string, n int) {
+	res, ok := rt.resources[path]
+	if !ok {
+		if l.MaxResources > 0 && len(rt.resources) >= l.MaxResources {
+			return
+		}
+
+		res = new(learnedResource)
+		rt.resources[path] = res
+	}
+
+	res.count += n
+	if as != "" {
+		res.as = as
+	}
+}
+
+func (l *Learner) route(path string) *learnedRoute {
+	if rt, ok := l.routes[path]; ok {
+		return rt
+	}
+
+	if l.MaxRoutes > 0 && len(l.routes) >= l.MaxRoutes {
+		return nil
+	}
+
+	if l.routes == nil {
+		l.routes = make(map[string]*learnedRoute)
+	}
+
+	rt := &learnedRoute{resources: make(map[string]*learnedResource)}
+	l.routes[path] = rt
+	return rt
+}
+
+// Handler returns an http.Handler that observes each
+// request before calling h. It may wrap a file server or
+// any other handler that is not wrapped by a push handler
+// with Options.Learner set.
+func (l *Learner) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.Observe(r)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Candidates returns the sub-resources observed for path,
+// ordered by descending confidence.
+func (l *Learner) Candidates(path string) []Candidate {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.candidates(l.routes[path])
+}
+
+func (l *Learner) candidates(rt *learnedRoute) []Candidate {
+	if rt == nil || rt.views == 0 {
+		return nil
+	}
+
+	out := make([]Candidate, 0, len(rt.resources))
+	for path, res := range rt.resources {
+		out = append(out, Candidate{
+			Path:       path,
+			As:         res.as,
+			Confidence: min(float64(res.count)/float64(rt.views), 1),
+		})
+	}
+
+	slices.SortFunc(out, func(a, b Candidate) int {
+		switch {
+		case a.Confidence > b.Confidence:
+			return -1
+		case a.Confidence < b.Confidence:
+			return 1
+		default:
+			return strings.Compare(a.Path, b.Path)
+		}
+	})
+
+	return out
+}
+
+// Manifest returns a Manifest listing, for each observed
+// document, the sub-resources with a confidence of at
+// least minConfidence. Documents with fewer than minViews
+// views are omitted, so that a handful of visits do not
+// decide what is pushed.
+func (l *Learner) Manifest(minConfidence float64, minViews int) *Manifest {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	routes := make(map[string][]Resource)
+	for path, rt := range l.routes {
+		if rt.views < minViews {
+			continue
+		}
+
+		var resources []Resource
+		for _, c := range l.candidates(rt) {
+			if c.Confidence < minConfidence {
+				break
+			}
+
+			resources = append(resources, Resource{
+				Path: c.Path,
+				As:   c.As,
+			})
+		}
+
+		if resources != nil {
+			routes[path] = resources
+		}
+	}
+
+	m := new(Manifest)
+	m.Replace(routes)
+	return m
+}
+
+// Reset discards everything the Learner has observed.
+func (l *Learner) Reset() {
+	l.mu.Lock()
+	l.routes = nil
+	l.mu.Unlock()
+}
+
+// Export writes the raw observations of the Learner to w
+// as JSON, so that they can be reviewed, versioned and
+// imported elsewhere. Unlike Manifest, nothing is
+// filtered out.
+func (l *Learner) Export(w io.Writer) error {
+	l.mu.Lock()
+	routes := make(map[string]exportedRoute, len(l.routes))
+	for path, rt := range l.routes {
+		er := exportedRoute{Views: rt.views}
+		if len(rt.resources) != 0 {
+			er.Resources = make(map[string]exportedResource, len(rt.resources))
+		}
+
+		for p, res := range rt.resources {
+			er.Resources[p] = exportedResource{As: res.as, Count: res.count}
+		}
+
+		routes[path] = er
+	}
+	l.mu.Unlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(routes)
+}
+
+// Import reads observations written by Export from r and
+// merges them into the Learner. View and request counts
+// are added to those already observed, so importing the
+// exports of several instances combines their traffic.
+// MaxRoutes and MaxResources still apply.
+//
+// Nothing is merged if r cannot be decoded.
+func (l *Learner) Import(r io.Reader) error {
+	var routes map[string]exportedRoute
+	if err := json.NewDecoder(r).Decode(&routes); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for path, er := range routes {
+		rt := l.route(path)
+		if rt == nil {
+			continue
+		}
+
+		rt.views += max(er.Views, 0)
+
+		for p, eres := range er.Resources {
+			l.add(rt, p, eres.As, max(eres.Count, 0))
+		}
+	}
+
+	return nil
+}
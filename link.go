@@ -0,0 +1,166 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"strings"
+)
+
+// AddLink adds a rel=preload Link header for target to the
+// response, registering it to be pushed by the handler.
+// target is percent-encoded as for Preload. Each of attrs
+// is appended as a link parameter, as is, for example
+// "as=style" or "nopush".
+//
+// It must be called before the response headers are
+// written.
+func AddLink(w http.ResponseWriter, target string, attrs ...string) {
+	Link{target: escapeTarget(target), params: attrs}.Add(w)
+}
+
+// Link builds a rel=preload Link header value. The zero
+// value is not useful; use Preload.
+//
+// Link values are immutable, each method returns a copy,
+// so a common prefix may be shared:
+//
+//	style := serverpush.Preload("/app.css").As("style")
+//	w.Header().Add("Link", style.String())
+type Link struct {
+	target string
+	params []string
+}
+
+// Preload returns a Link for target, which should be an
+// absolute path. Characters that are not permitted within
+// the angle brackets of a Link header are percent-encoded.
+func Preload(target string) Link {
+	return Link{target: escapeTarget(target)}
+}
+
+// As sets the as parameter, the destination of the
+// resource, such as "style", "script" or "font".
+func (l Link) As(dest string) Link {
+	return l.Param("as", dest)
+}
+
+// Type sets the type parameter to a MIME type.
+func (l Link) Type(mime string) Link {
+	return l.Param("type", mime)
+}
+
+// CrossOrigin sets the crossorigin parameter. If mode is
+// empty, the parameter is added without a value, which is
+// equivalent to "anonymous".
+func (l Link) CrossOrigin(mode string) Link {
+	if mode == "" {
+		return l.with("crossorigin")
+	}
+
+	return l.Param("crossorigin", mode)
+}
+
+// FetchPriority sets the fetchpriority parameter, the
+// relative priority of the resource: "high", "low" or
+// "auto". The handler pushes links marked high before, and
+// those marked low after, the other links of a response.
+func (l Link) FetchPriority(hint string) Link {
+	return l.Param("fetchpriority", hint)
+}
+
+// NoPush adds the nopush parameter, so the link is
+// preloaded by the client but not pushed by the handler.
+func (l Link) NoPush() Link {
+	return l.with("nopush")
+}
+
+// Param adds an arbitrary parameter. The value is quoted
+// if it is not a valid token.
+func (l Link) Param(name, value string) Link {
+	return l.with(name + "=" + quoteParam(value))
+}
+
+func (l Link) with(param string) Link {
+	l.params = append(l.params[:len(l.params):len(l.params)], param)
+	return l
+}
+
+// String returns the Link header value.
+func (l Link) String() string {
+	n := len("<>; rel=preload") + len(l.target)
+	for _, p := range l.params {
+		n += len("; ") + len(p)
+	}
+
+	var b strings.Builder
+	b.Grow(n)
+
+	b.WriteByte('<')
+	b.WriteString(l.target)
+	b.WriteString(">; rel=preload")
+
+	for _, p := range l.params {
+		b.WriteString("; ")
+		b.WriteString(p)
+	}
+
+	return b.String()
+}
+
+// Add adds the Link header to the response. It must be
+// called before the response headers are written.
+func (l Link) Add(w http.ResponseWriter) {
+	w.Header().Add("Link", l.String())
+}
+
+func escapeTarget(target string) string {
+	const hex = "0123456789ABCDEF"
+
+	if strings.IndexFunc(target, needsEscape) < 0 {
+		return target
+	}
+
+	var b strings.Builder
+	b.Grow(len(target) + 8)
+
+	for _, c := range []byte(target) {
+		if needsEscape(rune(c)) {
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0xf])
+		} else {
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+func needsEscape(r rune) bool {
+	return r <= ' ' || r >= 0x7f || strings.ContainsRune(`"<>\,;`, r)
+}
+
+func quoteParam(value string) string {
+	if validHeaderName(value) {
+		return value
+	}
+
+	var b strings.Builder
+	b.Grow(len(value) + 2)
+
+	b.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; c == '"' || c == '\\' {
+			b.WriteByte('\\')
+		}
+
+		b.WriteByte(value[i])
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
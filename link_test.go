@@ -0,0 +1,38 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAddLink(t *testing.T) {
+	for _, tc := range []struct {
+		target string
+		attrs  []string
+		want   string
+	}{
+		{"/a.css", nil, "</a.css>; rel=preload"},
+		{"/a.css", []string{"as=style", "nopush"}, "</a.css>; rel=preload; as=style; nopush"},
+		{"/a b.css", []string{"as=style"}, "</a%20b.css>; rel=preload; as=style"},
+		{"/a>;rel=x", nil, "</a%3E%3Brel=x>; rel=preload"},
+		{"/\"a\",b", nil, "</%22a%22%2Cb>; rel=preload"},
+		{"/a\r\nSet-Cookie: x", nil, "</a%0D%0ASet-Cookie:%20x>; rel=preload"},
+		{"/café.css", nil, "</caf%C3%A9.css>; rel=preload"},
+	} {
+		rec := httptest.NewRecorder()
+		AddLink(rec, tc.target, tc.attrs...)
+
+		if got := rec.Header().Get("Link"); got != tc.want {
+			t.Errorf("AddLink(%q, %q) = %q, want %q", tc.target, tc.attrs, got, tc.want)
+		}
+
+		if want := Preload(tc.target).String(); len(tc.attrs) == 0 && rec.Header().Get("Link") != want {
+			t.Errorf("AddLink(%q) differs from Preload: %q", tc.target, want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Logger is the interface used to report errors when no
+// slog.Logger has been provided.
+type Logger interface {
+	Logf(r *http.Request, format string, v ...interface{})
+}
+
+// LoggerFunc is an adapter to allow the use of ordinary
+// functions as a Logger.
+type LoggerFunc func(r *http.Request, format string, v ...interface{})
+
+// Logf calls f(r, format, v...).
+func (f LoggerFunc) Logf(r *http.Request, format string, v ...interface{}) {
+	f(r, format, v...)
+}
+
+// logWarning logs a problem with the options that does
+// not stop the handler from pushing.
+func (o *options) logWarning(msg string) {
+	if o.logger != nil {
+		o.logger.Warn(msg)
+		return
+	}
+
+	log.Print("go-server-push: " + msg)
+}
+
+// requestLogf logs to the http.Server's ErrorLog, or to the
+// standard logger if the server has none.
+func requestLogf(r *http.Request, format string, v ...interface{}) {
+	if srv, ok := r.Context().Value(http.ServerContextKey).(*http.Server); ok && srv.ErrorLog != nil {
+		srv.ErrorLog.Printf(format, v...)
+		return
+	}
+
+	log.Printf(format, v...)
+}
+
+// Error is an error encountered while handling a request,
+// as passed to Options.ErrorHandler.
+type Error struct {
+	// Msg describes what failed, for example "error
+	// pushing resource".
+	Msg string
+	// Target is the resource, link or Location involved,
+	// if any.
+	Target string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Target == "" {
+		return "go-server-push: " + e.Msg + ": " + e.Err.Error()
+	}
+
+	return "go-server-push: " + e.Msg + " " + strconv.Quote(e.Target) + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func requestAttrs(r *http.Request) slog.Attr {
+	return slog.Group("request",
+		slog.String("method", r.Method),
+		slog.String("url", r.URL.String()))
+}
+
+func (o *options) logError(r *http.Request, msg string, err error, attrs ...slog.Attr) {
+	o.add(errorsVar, 1)
+
+	if o.errorHandler != nil {
+		e := &Error{Msg: msg, Err: err}
+		if len(attrs) != 0 {
+			e.Target = attrs[0].Value.String()
+		}
+
+		o.errorHandler(r, e)
+		return
+	}
+
+	if o.limiter != nil && !o.limiter.allow(r) {
+		return
+	}
+
+	if o.logger == nil {
+		format := "go-server-push: " + msg
+		args := make([]interface{}, 0, len(attrs)+1)
+
+		for _, attr := range attrs {
+			format += " %q"
+			args = append(args, attr.Value.String())
+		}
+
+		format += ": %#v"
+		args = append(args, err)
+
+		if o.errorLog != nil {
+			o.errorLog.Logf(r, format, args...)
+		} else {
+			requestLogf(r, format, args...)
+		}
+		return
+	}
+
+	attrs = append(attrs, slog.Any("error", err), requestAttrs(r))
+	o.logger.LogAttrs(r.Context(), slog.LevelError, msg, attrs...)
+}
+
+func (o *options) logSuppressed(r *http.Request, n int, d time.Duration) {
+	if o.logger != nil {
+		o.logger.LogAttrs(r.Context(), slog.LevelWarn, "suppressed errors",
+			slog.Int("count", n), slog.Duration("interval", d))
+	} else if o.errorLog != nil {
+		o.errorLog.Logf(r, "go-server-push: suppressed %d errors in the last %s", n, d)
+	} else {
+		requestLogf(r, "go-server-push: suppressed %d errors in the last %s", n, d)
+	}
+}
+
+// logLimiter limits the number of errors logged in each
+// interval. Errors beyond the limit are counted and
+// reported in a single summary once the interval ends.
+type logLimiter struct {
+	opts *options
+
+	limit    int
+	interval time.Duration
+
+	mu         sync.Mutex
+	start      time.Time
+	count      int
+	suppressed int
+	last       *http.Request
+}
+
+// configure sets the limit and interval of l and the
+// options it reports suppressed errors with, keeping the
+// errors counted so far.
+func (l *logLimiter) configure(o *options, limit int, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.opts, l.limit, l.interval = o, limit, interval
+}
+
+func (l *logLimiter) allow(r *http.Request) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.opts.clock.Now()
+	if now.Sub(l.start) >= l.interval {
+		l.start = now
+		l.count = 0
+	}
+
+	if l.count < l.limit {
+		l.count++
+		return true
+	}
+
+	l.suppressed++
+	l.last = r
+
+	if l.suppressed == 1 {
+		l.opts.clock.AfterFunc(l.start.Add(l.interval).Sub(now), l.flush)
+	}
+
+	return false
+}
+
+func (l *logLimiter) flush() {
+	l.mu.Lock()
+	o, n, r, d := l.opts, l.suppressed, l.last, l.interval
+	l.suppressed, l.last = 0, nil
+	l.mu.Unlock()
+
+	if n != 0 {
+		o.logSuppressed(r, n, d)
+	}
+}
+
+func (o *options) logDecision(r *http.Request, target string, outcome Outcome, err error) {
+	if o.logger == nil || !o.logger.Enabled(r.Context(), slog.LevelDebug) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("target", target),
+		slog.String("reason", outcome.String()),
+	}
+
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+
+	attrs = append(attrs, requestAttrs(r))
+	o.logger.LogAttrs(r.Context(), slog.LevelDebug, "push decision", attrs...)
+}
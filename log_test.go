@@ -0,0 +1,40 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestErrorLogLimitSetOptions(t *testing.T) {
+	var logged int
+	opts := &Options{
+		ErrorLog: LoggerFunc(func(r *http.Request, format string, v ...interface{}) {
+			logged++
+		}),
+		ErrorLogLimit:    1,
+		ErrorLogInterval: time.Hour,
+	}
+
+	s := New(1<<16, 4, nil, opts)
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+
+	for i := 0; i < 3; i++ {
+		s.opts.Load().logError(r, "error pushing resource", errors.New("test"))
+
+		if err := s.SetOptions(1<<16, 4, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if logged != 1 {
+		t.Errorf("logged %d errors across SetOptions, want 1", logged)
+	}
+}
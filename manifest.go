@@ -0,0 +1,445 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// Resource is a sub-resource listed in a Manifest.
+type Resource struct {
+	// Path is the absolute path of the resource.
+	Path string `json:"path" yaml:"path"`
+
+	// As is the destination of the resource, such as
+	// "style" or "script", as for the as parameter of a
+	// preload Link header.
+	As string `json:"as,omitempty" yaml:"as,omitempty"`
+
+	// Priority orders the resources of a page. Resources
+	// with a higher priority are pushed first.
+	Priority int `json:"priority,omitempty" yaml:"priority,omitempty"`
+
+	// FetchPriority is the fetchpriority hint of the
+	// resource: "high", "low" or "auto". Within each
+	// priority, resources marked high are pushed first and
+	// those marked low last. It is included in the Link
+	// header of the resource.
+	FetchPriority string `json:"fetchpriority,omitempty" yaml:"fetchpriority,omitempty"`
+
+	// NoPush, if true, lists the resource without pushing
+	// it.
+	NoPush bool `json:"nopush,omitempty" yaml:"nopush,omitempty"`
+
+	// Name is the logical name of a fingerprinted asset,
+	// such as "/app.js" for "/app.3fa9c1.js". If it is
+	// empty, LogicalName is used.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Size is the size of the resource in bytes, if it is
+	// known. It is used by Options.PushBudget and
+	// Options.SmallestFirst.
+	Size int64 `json:"size,omitempty" yaml:"size,omitempty"`
+
+	// Weight is the relative likelihood that the resource
+	// is chosen when Options.SamplePushes samples the
+	// resources of a page. If it is zero, it is 1.
+	Weight float64 `json:"weight,omitempty" yaml:"weight,omitempty"`
+
+	// Deps lists the paths of the resources that this one
+	// references, such as the fonts of a stylesheet. Those
+	// listed for the same page are pushed immediately
+	// after this one, rather than in their own place.
+	Deps []string `json:"deps,omitempty" yaml:"deps,omitempty"`
+
+	// Lang, if non-empty, is the language tag of the
+	// resource, such as "en" or "pt-BR", making it a
+	// variant of the resources listed with the same
+	// logical name. Of each set of variants, only that
+	// best matching the request's Accept-Language header
+	// is pushed or linked, or the first listed if none
+	// match.
+	Lang string `json:"lang,omitempty" yaml:"lang,omitempty"`
+
+	// Omit, if true, removes the resource of the same
+	// logical name when the manifest is used as an
+	// overlay. See Overlay.
+	Omit bool `json:"omit,omitempty" yaml:"omit,omitempty"`
+}
+
+// Manifest maps request paths to the sub-resources that
+// should be pushed along with them. It is safe for
+// concurrent use and the zero value is an empty manifest.
+//
+// A route may be a pattern that matches many request
+// paths. A segment of the form :name matches any single
+// non-empty segment, and a final segment of * matches the
+// remainder of the path. The captured values are
+// substituted for :name and * in the paths of the route's
+// resources, so that
+//
+//	/users/:id -> /api/users/:id.json
+//
+// pushes /api/users/42.json for /users/42. Exact routes
+// take precedence over patterns, and literal segments
+// over :name, over *.
+type Manifest struct {
+	mu       sync.RWMutex
+	routes   map[string][]Resource
+	patterns []routePattern
+
+	assets      map[string]string
+	fingerprint uint64
+}
+
+// Set replaces the resources listed for path.
+func (m *Manifest) Set(path string, resources ...Resource) {
+	resources = sortResources(resources)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.routes == nil {
+		m.routes = make(map[string][]Resource)
+	}
+
+	m.routes[path] = resources
+	m.update()
+}
+
+// Replace atomically replaces every entry of the manifest
+// with routes, which maps request paths to resources.
+func (m *Manifest) Replace(routes map[string][]Resource) {
+	r := make(map[string][]Resource, len(routes))
+	for path, resources := range routes {
+		r[path] = sortResources(resources)
+	}
+
+	m.mu.Lock()
+	m.routes = r
+	m.update()
+	m.mu.Unlock()
+}
+
+func (m *Manifest) update() {
+	m.patterns = compilePatterns(m.routes)
+	m.assets = assets(m.routes)
+	m.fingerprint = fingerprint(m.assets)
+}
+
+// Assets returns the fingerprinted assets listed in the
+// manifest, mapping the logical name of each to its
+// current path.
+func (m *Manifest) Assets() map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return maps.Clone(m.assets)
+}
+
+// Fingerprint returns a hash of the paths of the
+// fingerprinted assets in the manifest, or zero if there
+// are none. It changes when a new build of any asset is
+// listed, and is the same for identical manifests loaded
+// by different processes.
+func (m *Manifest) Fingerprint() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.fingerprint
+}
+
+// Routes returns a copy of the entries of the manifest.
+func (m *Manifest) Routes() map[string][]Resource {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r := make(map[string][]Resource, len(m.routes))
+	for path, resources := range m.routes {
+		r[path] = slices.Clone(resources)
+	}
+
+	return r
+}
+
+// sortResources returns a copy of resources ordered by
+// descending priority, then fetchpriority hint, with each
+// resource followed by its dependencies.
+func sortResources(resources []Resource) []Resource {
+	resources = slices.Clone(resources)
+	slices.SortStableFunc(resources, comparePriority)
+
+	return orderDeps(resources)
+}
+
+// comparePriority orders resources by descending priority,
+// then by fetchpriority hint.
+func comparePriority(a, b Resource) int {
+	if a.Priority != b.Priority {
+		return b.Priority - a.Priority
+	}
+
+	return fetchPriorityRank(a.FetchPriority) - fetchPriorityRank(b.FetchPriority)
+}
+
+// orderDeps orders resources depth first from those that
+// are not the dependency of another, so that each
+// dependency directly follows the first resource to
+// reference it. Where dependencies form a cycle, the
+// first resource in it is treated as if it were not a
+// dependency.
+func orderDeps(resources []Resource) []Resource {
+	index := make(map[string]int, len(resources))
+	referenced := make(map[string]bool)
+	for i, res := range resources {
+		index[res.Path] = i
+
+		for _, dep := range res.Deps {
+			if dep != res.Path {
+				referenced[dep] = true
+			}
+		}
+	}
+
+	if len(referenced) == 0 {
+		return resources
+	}
+
+	out := make([]Resource, 0, len(resources))
+	visited := make([]bool, len(resources))
+
+	var visit func(i int)
+	visit = func(i int) {
+		if visited[i] {
+			return
+		}
+
+		visited[i] = true
+		out = append(out, resources[i])
+
+		for _, dep := range resources[i].Deps {
+			if j, ok := index[dep]; ok {
+				visit(j)
+			}
+		}
+	}
+
+	for i, res := range resources {
+		if !referenced[res.Path] {
+			visit(i)
+		}
+	}
+
+	for i, res := range resources {
+		if len(res.Deps) != 0 {
+			visit(i)
+		}
+	}
+
+	for i := range resources {
+		visit(i)
+	}
+
+	return out
+}
+
+// ReadManifest decodes a manifest from JSON. The JSON is
+// an object mapping request paths to arrays of resources:
+//
+//	{
+//		"/": [
+//			{"path": "/app.css", "as": "style", "priority": 1},
+//			{"path": "/app.js", "as": "script"},
+//			{"path": "/logo.svg", "as": "image", "nopush": true}
+//		]
+//	}
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	var routes map[string][]Resource
+	if err := json.NewDecoder(r).Decode(&routes); err != nil {
+		return nil, err
+	}
+
+	m := new(Manifest)
+	m.Replace(routes)
+	return m, nil
+}
+
+// MarshalJSON encodes the manifest in the format read by
+// ReadManifest.
+func (m *Manifest) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Routes())
+}
+
+// AddLinks returns an http.Handler that adds a preload Link
+// header for each resource listed for the request path,
+// choosing between language variants by Accept-Language,
+// before calling h. Placed in front of the push handler,
+// the links are pushed as if h had added them, and clients
+// that cannot be pushed to may still preload them.
+func (m *Manifest) AddLinks(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resources := selectLanguage(w.Header(), r, m.Lookup(r.URL.Path))
+		for _, res := range resources {
+			w.Header().Add("Link", res.link())
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Links returns a preload Link header value for each
+// resource listed for path.
+func (m *Manifest) Links(path string) []string {
+	resources := m.Lookup(path)
+	if len(resources) == 0 {
+		return nil
+	}
+
+	links := make([]string, len(resources))
+	for i, res := range resources {
+		links[i] = res.link()
+	}
+
+	return links
+}
+
+func (res *Resource) link() string {
+	l := Preload(res.Path)
+	if res.As != "" {
+		l = l.As(res.As)
+	}
+
+	if res.FetchPriority != "" {
+		l = l.FetchPriority(res.FetchPriority)
+	}
+
+	if res.NoPush {
+		l = l.NoPush()
+	}
+
+	return l.String()
+}
+
+// Lookup returns the resources listed for path, or for the
+// most specific pattern matching it. The returned slice
+// must not be modified.
+func (m *Manifest) Lookup(path string) []Resource {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if resources, ok := m.routes[path]; ok {
+		return resources
+	}
+
+	return lookupPattern(m.patterns, path)
+}
+
+// pushResources pushes the given manifest resources,
+// returning the number pushed.
+func (w *pushResponseWriter) pushResources(resources []Resource, opts *http.PushOptions) (count int) {
+	resources = selectLanguage(w.Header(), w.req, resources)
+
+	if w.opts.meta != nil && (w.opts.smallestFirst || w.opts.pushBudget > 0) {
+		resources = w.opts.meta.fillSizes(resources)
+	}
+
+	if w.opts.smallestFirst {
+		resources = smallestFirst(resources)
+	}
+
+	for _, res := range resources {
+		if res.NoPush {
+			w.record(res.Path, NoPush, w.opts.clock.Now(), nil)
+			continue
+		}
+
+		if w.opts.pushBudget > 0 && w.pushedBytes+res.Size > w.opts.pushBudget {
+			w.record(res.Path, OverBudget, w.opts.clock.Now(), nil)
+			continue
+		}
+
+		didPush, err := w.pushTarget(res.Path, opts)
+		if err == http.ErrNotSupported {
+			break
+		} else if err != nil {
+			w.opts.logError(w.req, "error pushing resource", err, slog.String("resource", res.Path))
+		}
+
+		if didPush {
+			w.pushedBytes += res.Size
+			count++
+
+			if w.opts.edgePush {
+				w.edgePushed = append(w.edgePushed, res.link())
+			}
+		}
+	}
+
+	return count
+}
+
+// smallestFirst returns a copy of resources ordered by
+// ascending size within each priority and fetchpriority
+// hint, with each resource followed by its dependencies.
+// Resources of unknown size are placed after those of
+// known size.
+func smallestFirst(resources []Resource) []Resource {
+	resources = slices.Clone(resources)
+	slices.SortStableFunc(resources, func(a, b Resource) int {
+		if c := comparePriority(a, b); c != 0 {
+			return c
+		}
+
+		switch {
+		case a.Size == b.Size:
+			return 0
+		case a.Size == 0:
+			return 1
+		case b.Size == 0:
+			return -1
+		case a.Size < b.Size:
+			return -1
+		default:
+			return 1
+		}
+	})
+
+	return orderDeps(resources)
+}
+
+// NewStatic wraps the given http.Handler in a push aware
+// handler that pushes the targets listed in pushes for each
+// request path, without the handler adding Link headers.
+// Any Link headers are still pushed as for New.
+//
+// It is intended for static sites where the resources of
+// each page are known up front.
+func NewStatic(m, k uint, handler http.Handler, pushes map[string][]string, opts *Options) *PushHandler {
+	manifest := new(Manifest)
+	for path, targets := range pushes {
+		resources := make([]Resource, len(targets))
+		for i, target := range targets {
+			resources[i].Path = target
+		}
+
+		manifest.Set(path, resources...)
+	}
+
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+
+	o.Manifest = manifest
+	o.PushManifest = true
+	return New(m, k, handler, &o)
+}
@@ -0,0 +1,140 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/gddo/httputil/header"
+)
+
+// TargetMetadata describes the response to a pushed
+// request, as remembered by Options.MetadataCache.
+type TargetMetadata struct {
+	// Size is the length of the response body.
+	Size int64
+	// ContentType is the Content-Type of the response.
+	ContentType string
+	// Cacheable is false if the response had a
+	// Cache-Control no-store directive.
+	Cacheable bool
+}
+
+// metaCache remembers the TargetMetadata of up to max push
+// targets. When it is full, an arbitrary entry is evicted.
+type metaCache struct {
+	mu      sync.RWMutex
+	max     int
+	entries map[string]TargetMetadata
+}
+
+func (c *metaCache) setMax(max int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.max = max
+	for path := range c.entries {
+		if len(c.entries) <= max {
+			break
+		}
+
+		delete(c.entries, path)
+	}
+}
+
+func (c *metaCache) get(path string) (TargetMetadata, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	md, ok := c.entries[path]
+	return md, ok
+}
+
+func (c *metaCache) add(path string, md TargetMetadata) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]TargetMetadata)
+	}
+
+	if _, ok := c.entries[path]; !ok {
+		for evict := range c.entries {
+			if len(c.entries) < c.max {
+				break
+			}
+
+			delete(c.entries, evict)
+		}
+	}
+
+	c.entries[path] = md
+}
+
+// fillSizes returns resources with the Size of those
+// without one taken from the cache, copying them only if
+// a size is found.
+func (c *metaCache) fillSizes(resources []Resource) []Resource {
+	filled := resources
+	for i, res := range resources {
+		if res.Size != 0 {
+			continue
+		}
+
+		md, ok := c.get(res.Path)
+		if !ok || md.Size == 0 {
+			continue
+		}
+
+		if &filled[0] == &resources[0] {
+			filled = append([]Resource(nil), resources...)
+		}
+
+		filled[i].Size = md.Size
+	}
+
+	return filled
+}
+
+// TargetMetadata returns the metadata remembered for the
+// push target path, if Options.MetadataCache is set and
+// path has been pushed and served by the handler.
+func (s *PushHandler) TargetMetadata(path string) (TargetMetadata, bool) {
+	return s.meta.get(path)
+}
+
+// recordMetadata remembers the metadata of the response to
+// a pushed request once it is complete.
+func (w *pushResponseWriter) recordMetadata() {
+	if w.code != http.StatusOK {
+		return
+	}
+
+	h := w.Header()
+
+	size := w.written
+	if cl, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil {
+		size = cl
+	} else if w.req.Method == http.MethodHead {
+		return
+	}
+
+	cacheable := true
+	for _, directive := range header.ParseList(h, "Cache-Control") {
+		if strings.EqualFold(directive, "no-store") {
+			cacheable = false
+		}
+	}
+
+	w.opts.meta.add(w.req.URL.Path, TargetMetadata{
+		Size:        size,
+		ContentType: h.Get("Content-Type"),
+		Cacheable:   cacheable,
+	})
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import "net/http"
+
+// The kinds of push a handler makes, recorded in the
+// Result of each request it serves so that a handler it
+// wraps can tell which are already taken care of.
+const (
+	servesLinks uint8 = 1 << iota
+	servesRedirects
+)
+
+func (o *options) serves() uint8 {
+	var s uint8
+	if !o.redirectsOnly {
+		s |= servesLinks
+	}
+
+	if o.pushRedirects {
+		s |= servesRedirects
+	}
+
+	return s
+}
+
+// nested reports whether r is already being served by an
+// outer push handler that makes every kind of push this
+// one would, as when the handler has been applied twice.
+// The Nested hook is called if so.
+func (o *options) nested(r *http.Request, res *Result) bool {
+	if res == nil || res.serves&o.serves() != o.serves() {
+		return false
+	}
+
+	if o.hooks != nil && o.hooks.Nested != nil {
+		o.hooks.Nested(r)
+	}
+
+	return true
+}
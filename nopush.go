@@ -0,0 +1,55 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"strings"
+)
+
+// noPushPrefix marks a cookie value, before any generation,
+// of a client that has disabled push. It is in the
+// alphabet of neither the standard base64 encoding nor of
+// generations, and no other encoding begins with it.
+const noPushPrefix = "-"
+
+// knownNoPush reports whether the filter cookie of r
+// records that the client has disabled push. See
+// Options.RememberNoPush.
+func (o *options) knownNoPush(r *http.Request) bool {
+	if !o.rememberNoPush {
+		return false
+	}
+
+	c, err := r.Cookie(o.cookie.Name)
+	return err == nil && strings.HasPrefix(c.Value, noPushPrefix)
+}
+
+// pushNotSupported records that the client refused a push,
+// so that the filter cookie is saved with noPushPrefix.
+func (w *pushResponseWriter) pushNotSupported() {
+	if w.opts.rememberNoPush && !w.pushDisabled && !w.isPush {
+		w.pushDisabled, w.noPushFound = true, true
+	}
+}
+
+// saveNoPush saves the filter cookie of a client found to
+// have disabled push, reporting false if there is no need.
+func (w *pushResponseWriter) saveNoPush() bool {
+	if !w.noPushFound || w.dirty {
+		return false
+	}
+
+	if w.bloom == nil {
+		w.loadBloomFilter()
+	}
+
+	if err := w.saveBloomFilter(); err != nil {
+		w.opts.logError(w.req, "error saving bloom filter", err)
+	}
+
+	return true
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// The filter parameters used by NewHandler unless
+// WithFilterParams is given: enough for 200 resources
+// with a 1% false positive rate.
+var defaultM, defaultK = EstimateParameters(200, 0.01)
+
+// Option configures a handler created by NewHandler.
+type Option func(*config)
+
+type config struct {
+	m, k uint
+	opts Options
+}
+
+// WithFilterParams sets the number of bits, m, and the
+// number of hash functions, k, of the bloom filter.
+func WithFilterParams(m, k uint) Option {
+	return func(c *config) {
+		c.m, c.k = m, k
+	}
+}
+
+// WithOptions replaces the Options of the handler. Options
+// given after it are applied on top.
+func WithOptions(opts *Options) Option {
+	return func(c *config) {
+		if opts != nil {
+			c.opts = *opts
+		} else {
+			c.opts = Options{}
+		}
+	}
+}
+
+// WithCookie sets the cookie used to store the bloom
+// filter. See Options.Cookie.
+func WithCookie(cookie *http.Cookie) Option {
+	return func(c *config) {
+		c.opts.Cookie = cookie
+	}
+}
+
+// WithPushOptions sets the options passed to Push. See
+// Options.PushOptions.
+func WithPushOptions(opts *http.PushOptions) Option {
+	return func(c *config) {
+		c.opts.PushOptions = opts
+	}
+}
+
+// WithLogger sets the structured logger. See
+// Options.Logger.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *config) {
+		c.opts.Logger = l
+	}
+}
+
+// WithHooks sets the hooks. See Options.Hooks.
+func WithHooks(h *Hooks) Option {
+	return func(c *config) {
+		c.opts.Hooks = h
+	}
+}
+
+// NewHandler wraps the given http.Handler in a push aware
+// handler configured by opts.
+//
+// Unless WithFilterParams is given, the bloom filter is
+// sized for 200 resources with a 1% false positive rate.
+func NewHandler(handler http.Handler, opts ...Option) *PushHandler {
+	c := config{
+		m: defaultM,
+		k: defaultK,
+	}
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	return New(c.m, c.k, handler, &c.opts)
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+// Overlay returns the routes of base with each of overlays
+// applied in turn, so that a shared manifest may be
+// adjusted for each environment without being copied.
+//
+// Resources are matched by their logical name, their Name
+// or, if it is empty, the LogicalName of their Path, and
+// their Lang. For each route of an overlay:
+//
+//   - an empty list of resources removes the route,
+//   - a resource with Omit set removes the matching
+//     resource,
+//   - a resource that matches one already listed replaces
+//     it in place, and
+//   - any other resource is appended.
+//
+// Neither base nor overlays are modified.
+func Overlay(base map[string][]Resource, overlays ...map[string][]Resource) map[string][]Resource {
+	out := make(map[string][]Resource, len(base))
+	for _, layer := range append([]map[string][]Resource{base}, overlays...) {
+		for route, resources := range layer {
+			if len(resources) == 0 {
+				delete(out, route)
+				continue
+			}
+
+			out[route] = overlayResources(out[route], resources)
+		}
+	}
+
+	return out
+}
+
+func overlayResources(lower, upper []Resource) []Resource {
+	out := make([]Resource, 0, len(lower)+len(upper))
+	out = append(out, lower...)
+
+	for _, res := range upper {
+		name := res.logicalName()
+
+		i := -1
+		for j := range out {
+			if out[j].logicalName() == name && out[j].Lang == res.Lang {
+				i = j
+				break
+			}
+		}
+
+		switch {
+		case res.Omit && i >= 0:
+			out = append(out[:i], out[i+1:]...)
+		case res.Omit:
+		case i >= 0:
+			out[i] = res
+		default:
+			out = append(out, res)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// opaqueSite is the partition of a cross-site request
+// whose embedding site is not known.
+const opaqueSite = "cross-site"
+
+// filterKey returns the key of target in the client's
+// filter, as for options.filterKey, in the partition of
+// the top-level site of the request.
+func (w *pushResponseWriter) filterKey(target string) string {
+	return w.opts.siteFilterKey(w.opts.topLevelSite(w.req), target)
+}
+
+// siteFilterKey returns the key of target in the partition
+// of site, or in the unpartitioned filter if site is empty.
+func (o *options) siteFilterKey(site, target string) string {
+	key := o.filterKey(target)
+	if site != "" {
+		// Clean targets never contain a space.
+		return site + " " + key
+	}
+
+	return key
+}
+
+// topLevelSite returns the site that r is embedded in, if
+// Options.PartitionBySite is set and r is a cross-site
+// request for other than a top-level document. It is
+// empty for requests made by our own pages, whose pushes
+// are kept in the unpartitioned filter.
+func (o *options) topLevelSite(r *http.Request) string {
+	if !o.partitionBySite || r.Header.Get("Sec-Fetch-Site") != "cross-site" {
+		return ""
+	}
+
+	switch r.Header.Get("Sec-Fetch-Dest") {
+	case "document", "":
+		return ""
+	}
+
+	for _, v := range [...]string{r.Header.Get("Origin"), r.Header.Get("Referer")} {
+		if site := siteOf(v); site != "" {
+			return site
+		}
+	}
+
+	return opaqueSite
+}
+
+// siteOf returns the scheme and registrable domain of the
+// URL or origin v, or an empty string if it has neither.
+func siteOf(v string) string {
+	u, err := url.Parse(v)
+	if err != nil || u.Scheme == "" || u.Hostname() == "" {
+		return ""
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if net.ParseIP(host) == nil {
+		if site, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+			host = site
+		}
+	}
+
+	return strings.ToLower(u.Scheme) + "://" + host
+}
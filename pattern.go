@@ -0,0 +1,179 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// routePattern is a Manifest route containing :name or *
+// segments.
+type routePattern struct {
+	segments  []string
+	resources []Resource
+}
+
+func isPattern(route string) bool {
+	for _, seg := range strings.Split(route, "/") {
+		if seg == "*" || strings.HasPrefix(seg, ":") && len(seg) > 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compilePatterns returns the pattern routes of routes,
+// most specific first.
+func compilePatterns(routes map[string][]Resource) []routePattern {
+	var patterns []routePattern
+	for route, resources := range routes {
+		if isPattern(route) {
+			patterns = append(patterns, routePattern{
+				segments:  strings.Split(route, "/"),
+				resources: resources,
+			})
+		}
+	}
+
+	slices.SortFunc(patterns, func(a, b routePattern) int {
+		for i := 0; i < len(a.segments) && i < len(b.segments); i++ {
+			if d := segmentRank(a.segments[i]) - segmentRank(b.segments[i]); d != 0 {
+				return d
+			}
+		}
+
+		if d := len(b.segments) - len(a.segments); d != 0 {
+			return d
+		}
+
+		return slices.Compare(a.segments, b.segments)
+	})
+
+	return patterns
+}
+
+func segmentRank(seg string) int {
+	switch {
+	case seg == "*":
+		return 2
+	case strings.HasPrefix(seg, ":") && len(seg) > 1:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func lookupPattern(patterns []routePattern, path string) []Resource {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	parts := strings.Split(path, "/")
+	for _, p := range patterns {
+		if params, ok := p.match(parts); ok {
+			return substitute(p.resources, params)
+		}
+	}
+
+	return nil
+}
+
+// match matches the segments of a request path, returning
+// the values of :name segments and the * remainder.
+func (p *routePattern) match(parts []string) (map[string]string, bool) {
+	params := make(map[string]string)
+	for i, seg := range p.segments {
+		if i >= len(parts) {
+			return nil, false
+		}
+
+		if seg == "*" && i == len(p.segments)-1 {
+			rest := make([]string, len(parts)-i)
+			for j, part := range parts[i:] {
+				rest[j] = url.PathEscape(part)
+			}
+
+			params["*"] = strings.Join(rest, "/")
+			return params, true
+		}
+
+		switch segmentRank(seg) {
+		case 0:
+			if seg != parts[i] {
+				return nil, false
+			}
+		default:
+			if parts[i] == "" {
+				return nil, false
+			}
+
+			params[seg[1:]] = url.PathEscape(parts[i])
+		}
+	}
+
+	return params, len(parts) == len(p.segments)
+}
+
+// substitute returns a copy of resources with the
+// captured params replaced in their paths.
+func substitute(resources []Resource, params map[string]string) []Resource {
+	out := make([]Resource, len(resources))
+	for i, res := range resources {
+		res.Path = substitutePath(res.Path, params)
+
+		if res.Deps != nil {
+			deps := make([]string, len(res.Deps))
+			for j, dep := range res.Deps {
+				deps[j] = substitutePath(dep, params)
+			}
+
+			res.Deps = deps
+		}
+
+		out[i] = res
+	}
+
+	return out
+}
+
+func substitutePath(path string, params map[string]string) string {
+	if !strings.ContainsAny(path, ":*") {
+		return path
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case c == '*':
+			if v, ok := params["*"]; ok {
+				b.WriteString(v)
+				continue
+			}
+		case c == ':':
+			n := i + 1
+			for n < len(path) && isParamByte(path[n]) {
+				n++
+			}
+
+			if v, ok := params[path[i+1:n]]; ok && n > i+1 {
+				b.WriteString(v)
+				i = n - 1
+				continue
+			}
+		}
+
+		b.WriteByte(path[i])
+	}
+
+	return b.String()
+}
+
+func isParamByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_'
+}
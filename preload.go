@@ -0,0 +1,88 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"errors"
+	"net/http"
+)
+
+// PreloadLinks returns a Middleware that adds a preload
+// Link header for each resource of opts.Manifest listed
+// for the request path when the client cannot be pushed
+// to, such as over HTTP/1.1 or HTTP/3, or when
+// Options.SupportsPush rejects the request.
+//
+// Resources found in the client's bloom filter are left
+// out and those linked are added to it, so that, like
+// pushes, each resource is only hinted once. It should
+// be placed in front of a push handler created with the
+// same m, k and opts, which it passes requests that can
+// be pushed to unchanged.
+//
+// As with New, if Validate reports an error, it is logged
+// and no links are added. PreloadLinks panics if
+// opts.Manifest is nil.
+func PreloadLinks(m, k uint, opts *Options) Middleware {
+	if opts == nil || opts.Manifest == nil {
+		panic(errors.New("go-server-push: PreloadLinks requires a Manifest"))
+	}
+
+	o := New(m, k, nil, opts).opts.Load()
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, ok := w.(http.Pusher)
+			if !(ok && o.clientSupportsPush(r)) && !o.disabled && !o.sentinel.IsPush(r) {
+				o.preloadLinks(w, r)
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (o *options) preloadLinks(w http.ResponseWriter, r *http.Request) {
+	resources := o.manifest.Lookup(r.URL.Path)
+	if len(resources) == 0 {
+		return
+	}
+
+	resources = selectLanguage(w.Header(), r, resources)
+
+	pw := &pushResponseWriter{
+		ResponseWriter: w,
+		opts:           o,
+		req:            r,
+	}
+	pw.loadBloomFilter()
+	defer pw.releaseFilter()
+
+	var added bool
+
+	h := w.Header()
+	for _, res := range resources {
+		key := pw.filterKey(res.Path)
+		if pw.test(key) {
+			continue
+		}
+
+		pw.add(key)
+		added = true
+
+		h.Add("Link", res.link())
+	}
+
+	// The push time cookie of Options.WasteWindow is not
+	// set, as a preloaded resource is expected to be
+	// requested.
+	if !added {
+		return
+	}
+
+	if err := pw.saveBloomFilter(); err != nil {
+		o.logError(r, "error saving bloom filter", err)
+	}
+}
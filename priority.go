@@ -0,0 +1,54 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"slices"
+	"strings"
+)
+
+// fetchPriorityRank orders the values of the fetchpriority
+// hint, with "high" first and "low" last. Any other value
+// is treated as "auto".
+func fetchPriorityRank(hint string) int {
+	switch strings.ToLower(hint) {
+	case "high":
+		return 0
+	case "low":
+		return 2
+	default:
+		return 1
+	}
+}
+
+// linkFetchPriority returns the fetchpriority parameter of
+// a Link header value, or the empty string if it has none.
+func linkFetchPriority(link string) string {
+	_, rest := nextField(link)
+	for field, rest := nextField(rest); field != ""; field, rest = nextField(rest) {
+		name, value, ok := strings.Cut(field, "=")
+		if ok && strings.EqualFold(name, "fetchpriority") {
+			return strings.Trim(value, `"`)
+		}
+	}
+
+	return ""
+}
+
+// sortLinks orders links by their fetchpriority hints, so
+// that those marked high are pushed first and those marked
+// low last. The order of links with the same hint is kept.
+func sortLinks(links []string) {
+	if !slices.ContainsFunc(links, func(link string) bool {
+		return linkFetchPriority(link) != ""
+	}) {
+		return
+	}
+
+	slices.SortStableFunc(links, func(a, b string) int {
+		return fetchPriorityRank(linkFetchPriority(a)) - fetchPriorityRank(linkFetchPriority(b))
+	})
+}
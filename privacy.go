@@ -0,0 +1,16 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import "net/http"
+
+// cookieless reports whether the filter cookie must be
+// neither read nor set for r, as it has the DNT or Sec-GPC
+// header and Options.RespectPrivacySignals is set.
+func (o *options) cookieless(r *http.Request) bool {
+	return o.respectPrivacySignals &&
+		(r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1")
+}
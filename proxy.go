@@ -0,0 +1,94 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/golang/gddo/httputil/header"
+)
+
+// NewProxy returns a push handler in front of proxy, so that
+// the preload Link headers of an upstream application
+// server are pushed from the edge.
+//
+// The ModifyResponse function of a copy of proxy is wrapped
+// with RewriteUpstreamLinks and proxy itself is left
+// unchanged. Pushed requests are proxied upstream like any
+// other, with the sentinel header removed, and any
+// X-H2-Pushed header sent by the upstream is dropped. As
+// httputil.ReverseProxy removes hop-by-hop headers before
+// ModifyResponse is called, a Link header the upstream
+// names in its Connection header is neither pushed nor
+// passed to the client.
+func NewProxy(m, k uint, proxy *httputil.ReverseProxy, opts *Options) *PushHandler {
+	p := *proxy
+	modify := proxy.ModifyResponse
+	p.ModifyResponse = func(res *http.Response) error {
+		if modify != nil {
+			if err := modify(res); err != nil {
+				return err
+			}
+		}
+
+		return RewriteUpstreamLinks(res)
+	}
+
+	s := DefaultSentinel
+	if opts != nil && opts.SentinelHeader != "" {
+		s = NewSentinel(opts.SentinelHeader)
+	}
+
+	return New(m, k, s.Strip(&p), opts)
+}
+
+// RewriteUpstreamLinks may be used as, or called from, the
+// ModifyResponse function of an httputil.ReverseProxy. It
+// rewrites the targets of Link headers that are absolute
+// http or https URLs of the upstream server, either its
+// address or the Host header it was sent, to paths, so
+// that they may be pushed by the handler in front of the
+// proxy. Other links are left unchanged.
+func RewriteUpstreamLinks(res *http.Response) error {
+	if res.Request == nil || len(res.Header["Link"]) == 0 {
+		return nil
+	}
+
+	links := header.ParseList(res.Header, "Link")
+	for i, link := range links {
+		links[i] = rewriteUpstreamLink(res.Request, link)
+	}
+
+	res.Header["Link"] = links
+	return nil
+}
+
+func rewriteUpstreamLink(r *http.Request, link string) string {
+	end := strings.IndexByte(link, '>')
+	if !strings.HasPrefix(link, "<") || end < 0 {
+		return link
+	}
+
+	u, err := url.Parse(link[1:end])
+	if err != nil || u.Host == "" || u.User != nil {
+		return link
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+	default:
+		return link
+	}
+
+	if !strings.EqualFold(u.Host, r.URL.Host) && !strings.EqualFold(u.Host, r.Host) {
+		return link
+	}
+
+	return "<" + u.RequestURI() + link[end:]
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Package pushchi adapts serverpush for use with the
+// github.com/go-chi/chi router.
+package pushchi
+
+import (
+	"net/http"
+
+	serverpush "github.com/tmthrgd/go-server-push"
+)
+
+type pusherWriter struct {
+	http.ResponseWriter
+	http.Pusher
+}
+
+func (w pusherWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Middleware returns chi middleware that wraps each
+// request in a serverpush handler.
+//
+// Writers wrapped by other chi middleware, such as
+// middleware.WrapResponseWriter, are unwrapped to reach
+// the underlying http.Pusher when they don't expose it.
+func Middleware(m, k uint, opts *serverpush.Options) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		h := serverpush.New(m, k, next, opts)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := w.(http.Pusher); !ok {
+				if p := serverpush.FindPusher(w); p != nil {
+					w = pusherWriter{w, p}
+				}
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
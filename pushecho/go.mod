@@ -0,0 +1,26 @@
+module github.com/tmthrgd/go-server-push/pushecho
+
+go 1.22
+
+replace github.com/tmthrgd/go-server-push => ../
+
+require (
+	github.com/labstack/echo/v4 v4.9.1
+	github.com/tmthrgd/go-server-push v0.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/golang/gddo v0.0.0-20180823221919-9d8ff1c67be5 // indirect
+	github.com/labstack/gommon v0.4.0 // indirect
+	github.com/mattn/go-colorable v0.1.11 // indirect
+	github.com/mattn/go-isatty v0.0.14 // indirect
+	github.com/spaolacci/murmur3 v1.1.0 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasttemplate v1.2.1 // indirect
+	github.com/willf/bitset v1.1.11 // indirect
+	github.com/willf/bloom v2.0.3+incompatible // indirect
+	golang.org/x/crypto v0.33.0 // indirect
+	golang.org/x/net v0.35.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+)
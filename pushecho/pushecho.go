@@ -0,0 +1,75 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Package pushecho adapts serverpush for use with the
+// github.com/labstack/echo framework.
+package pushecho
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	serverpush "github.com/tmthrgd/go-server-push"
+)
+
+type pusherWriter struct {
+	http.ResponseWriter
+	http.Pusher
+}
+
+func (w pusherWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type call struct {
+	c    echo.Context
+	next echo.HandlerFunc
+	err  error
+}
+
+type callKey struct{}
+
+// Middleware returns echo middleware that wraps each
+// request in a serverpush handler.
+//
+// The writer of the echo.Response is replaced with the
+// push aware writer while the rest of the chain runs, and
+// is unwrapped to reach the underlying http.Pusher when
+// other middleware has hidden it.
+func Middleware(m, k uint, opts *serverpush.Options) echo.MiddlewareFunc {
+	h := serverpush.New(m, k, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := r.Context().Value(callKey{}).(*call)
+
+		res := call.c.Response()
+		orig := res.Writer
+
+		res.Writer = w
+		call.c.SetRequest(r)
+
+		call.err = call.next(call.c)
+
+		res.Writer = orig
+	}), opts)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			cl := &call{c: c, next: next}
+
+			r := c.Request()
+			r = r.WithContext(context.WithValue(r.Context(), callKey{}, cl))
+
+			w := c.Response().Writer
+			if _, ok := w.(http.Pusher); !ok {
+				if p := serverpush.FindPusher(w); p != nil {
+					w = pusherWriter{w, p}
+				}
+			}
+
+			h.ServeHTTP(w, r)
+			return cl.err
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrAlreadyPushed is returned by the Push method of the
+// http.Pusher returned from PusherFor when the target has
+// already been pushed to the client.
+var ErrAlreadyPushed = errors.New("go-server-push: resource already pushed")
+
+type filterPusher struct{ w *pushResponseWriter }
+
+func (p filterPusher) Push(target string, opts *http.PushOptions) error {
+	w := p.w
+
+	// In edge push mode the target can only be passed on
+	// while the Link headers may still be changed.
+	if w.opts.edgePush && w.wroteHeader {
+		return http.ErrNotSupported
+	}
+
+	pushed, err := w.pushTarget(target, w.mergePushOptions(opts))
+	if pushed && w.opts.edgePush {
+		w.edgePushed = append(w.edgePushed, Preload(target).String())
+	}
+
+	switch {
+	case err != nil:
+	case w.opts.observeOnly:
+		err = http.ErrNotSupported
+	case !pushed:
+		err = ErrAlreadyPushed
+	}
+
+	return err
+}
+
+// mergePushOptions returns the push options of the response
+// with the Method and Header of opts, which may be nil,
+// merged over them. Headers of opts that the handler's
+// header policy does not allow are dropped.
+func (w *pushResponseWriter) mergePushOptions(opts *http.PushOptions) *http.PushOptions {
+	base := w.pushOptions()
+	if opts == nil {
+		return base
+	}
+
+	po := *base
+	if opts.Method != "" {
+		po.Method = opts.Method
+	}
+
+	if len(opts.Header) != 0 {
+		po.Header = make(http.Header, len(base.Header)+len(opts.Header))
+		for k, v := range base.Header {
+			po.Header[k] = v
+		}
+
+		for k, v := range w.opts.headerPolicy.filterHeader(opts.Header) {
+			po.Header[k] = v
+		}
+	}
+
+	return &po
+}
+
+func unwrapPushResponseWriter(w http.ResponseWriter) *pushResponseWriter {
+	pw, _ := unwrapWriter(w).(*pushResponseWriter)
+	return pw
+}
+
+// PusherFor returns an http.Pusher for a response being
+// served by the push handler. Its Push method consults and
+// updates the same bloom filter as the handler, returning
+// ErrAlreadyPushed rather than pushing a resource twice.
+// The handler's push options are used, with the Method and
+// Header of opts, if non-nil, merged over them. Headers
+// excluded by Options.DenyHeaders or AllowHeaders are
+// dropped from opts.
+//
+// Pushes made before the response headers are written are
+// recorded in the cookie. Pushes made afterwards are still
+// deduplicated within the response, but are not recorded.
+// If the handler is in observe only mode, the decision is
+// reported and Push returns http.ErrNotSupported.
+//
+// If w was not wrapped by the push handler, the underlying
+// http.Pusher is returned, or nil if w does not support
+// push.
+func PusherFor(w http.ResponseWriter, r *http.Request) http.Pusher {
+	if pw := unwrapPushResponseWriter(w); pw != nil {
+		return filterPusher{pw}
+	}
+
+	p, _ := w.(http.Pusher)
+	return p
+}
+
+// AlreadyPushed returns true if path is probably in the
+// client's bloom filter, meaning it was pushed on an
+// earlier response or earlier in this one. It returns
+// false if w was not wrapped by the push handler.
+//
+// It may be used to decide whether to inline a resource
+// or to rely on the pushed or cached copy.
+func AlreadyPushed(w http.ResponseWriter, r *http.Request, path string) bool {
+	pw := unwrapPushResponseWriter(w)
+	if pw == nil {
+		return false
+	}
+
+	if pw.bloom == nil {
+		pw.loadBloomFilter()
+	}
+
+	return pw.test(pw.filterKey(path))
+}
+
+// FindPusher returns the http.Pusher implemented by w or,
+// if w does not implement it, by the first writer reached
+// by repeatedly calling an Unwrap() http.ResponseWriter
+// method. It returns nil if no writer supports push.
+//
+// It allows the push handler to be used beneath
+// middleware that wraps the http.ResponseWriter without
+// preserving http.Pusher.
+func FindPusher(w http.ResponseWriter) http.Pusher {
+	for w != nil {
+		if p, ok := w.(http.Pusher); ok {
+			return p
+		}
+
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return nil
+		}
+
+		w = u.Unwrap()
+	}
+
+	return nil
+}
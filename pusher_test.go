@@ -0,0 +1,105 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// recordPusher records the options of each push.
+type recordPusher struct {
+	http.ResponseWriter
+	pushes []*http.PushOptions
+}
+
+func (p *recordPusher) Push(target string, opts *http.PushOptions) error {
+	p.pushes = append(p.pushes, opts)
+	return nil
+}
+
+func TestPusherForOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		opts   *http.PushOptions
+		method string
+		want   http.Header // headers besides the sentinel
+	}{
+		{"nil", nil, "", http.Header{
+			"Accept": {"text/css"},
+		}},
+		{"method only", &http.PushOptions{Method: http.MethodHead}, http.MethodHead, http.Header{
+			"Accept": {"text/css"},
+		}},
+		{"merged", &http.PushOptions{Header: http.Header{
+			"Accept-Language": {"en"},
+		}}, "", http.Header{
+			"Accept":          {"text/css"},
+			"Accept-Language": {"en"},
+		}},
+		{"overridden", &http.PushOptions{Header: http.Header{
+			"Accept": {"image/*"},
+		}}, "", http.Header{
+			"Accept": {"image/*"},
+		}},
+		{"denied", &http.PushOptions{Header: http.Header{
+			"Authorization": {"Bearer secret"},
+			"Cookie":        {"session=secret"},
+			"X-Team":        {"a"},
+		}}, "", http.Header{
+			"Accept": {"text/css"},
+			"X-Team": {"a"},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := New(1<<16, 4, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := PusherFor(w, r).Push("/a.css", tc.opts); err != nil {
+					t.Errorf("Push: %v", err)
+				}
+			}), &Options{
+				PushOptions: &http.PushOptions{Header: http.Header{
+					"Accept": {"text/css"},
+				}},
+				DenyHeaders: []string{"authorization", "Cookie"},
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+			r.TLS = new(tls.ConnectionState)
+
+			p := &recordPusher{ResponseWriter: httptest.NewRecorder()}
+			h.ServeHTTP(p, r)
+
+			if len(p.pushes) != 1 {
+				t.Fatalf("pushed %d times, want 1", len(p.pushes))
+			}
+
+			po := p.pushes[0]
+			if po.Method != tc.method {
+				t.Errorf("Method = %q, want %q", po.Method, tc.method)
+			}
+
+			got := po.Header.Clone()
+			delete(got, DefaultSentinel.Name())
+			if len(got) != len(tc.want) {
+				t.Errorf("Header = %v, want %v", got, tc.want)
+			}
+
+			for k, v := range tc.want {
+				if got.Get(k) != v[0] {
+					t.Errorf("Header[%q] = %q, want %q", k, got[k], v)
+				}
+			}
+
+			if tc.opts != nil && len(tc.opts.Header) != 0 {
+				if _, ok := tc.opts.Header[DefaultSentinel.Name()]; ok {
+					t.Error("caller's PushOptions were modified")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Package pushfiber adapts serverpush for use with the
+// github.com/gofiber/fiber framework.
+//
+// fiber is built on fasthttp, which does not support
+// HTTP/2, so resources are never pushed. Middleware instead
+// adds preload Link headers for the Manifest resources of
+// each request path, as serverpush.PreloadLinks does,
+// leaving out those the client has already been sent.
+package pushfiber
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	serverpush "github.com/tmthrgd/go-server-push"
+)
+
+// Middleware returns fiber middleware that adds preload
+// Link headers for the resources listed for the request
+// path in opts.Manifest, recording them in the client's
+// bloom filter cookie.
+//
+// It runs before the rest of the chain, so Link headers
+// added by fiber handlers are neither filtered nor
+// recorded. As elsewhere, the cookie is only set on
+// requests fiber served over TLS, unless the options
+// allow otherwise, such as with TrustForwardedProto
+// behind a TLS-terminating proxy. Middleware panics if
+// opts.Manifest is nil.
+func Middleware(m, k uint, opts *serverpush.Options) fiber.Handler {
+	return adaptor.HTTPMiddleware(serverpush.PreloadLinks(m, k, opts))
+}
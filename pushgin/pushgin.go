@@ -0,0 +1,103 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Package pushgin adapts serverpush for use with the
+// github.com/gin-gonic/gin framework.
+//
+// gin.ResponseWriter exposes http.Pusher through its
+// Pusher method rather than implementing it directly, so
+// the middleware cannot be used with gin.WrapH.
+package pushgin
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	serverpush "github.com/tmthrgd/go-server-push"
+)
+
+// pusherWriter presents a gin.ResponseWriter to the push
+// handler as an http.Pusher.
+type pusherWriter struct{ gin.ResponseWriter }
+
+func (w pusherWriter) Push(target string, opts *http.PushOptions) error {
+	return w.ResponseWriter.Pusher().Push(target, opts)
+}
+
+// responseWriter routes the header and body writes of the
+// gin handlers through the push aware writer.
+type responseWriter struct {
+	gin.ResponseWriter
+	w http.ResponseWriter
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	rw.w.WriteHeader(code)
+}
+
+func (rw *responseWriter) WriteHeaderNow() {
+	if !rw.ResponseWriter.Written() {
+		rw.w.WriteHeader(rw.ResponseWriter.Status())
+	}
+
+	rw.ResponseWriter.WriteHeaderNow()
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	return rw.w.Write(p)
+}
+
+func (rw *responseWriter) WriteString(s string) (int, error) {
+	return io.WriteString(rw.w, s)
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.w
+}
+
+func (rw *responseWriter) Pusher() http.Pusher {
+	p, _ := rw.w.(http.Pusher)
+	return p
+}
+
+type ctxKey struct{}
+
+// Middleware returns gin middleware that wraps the rest
+// of the handler chain in a serverpush handler.
+func Middleware(m, k uint, opts *serverpush.Options) gin.HandlerFunc {
+	h := serverpush.New(m, k, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := r.Context().Value(ctxKey{}).(*gin.Context)
+
+		orig := c.Writer
+		rw := &responseWriter{orig, w}
+
+		c.Writer = rw
+		c.Request = r
+
+		c.Next()
+
+		// Ensure the Link headers are processed even if
+		// no handler wrote the response. gin only records
+		// the status here and writes it once the chain
+		// has finished.
+		if !orig.Written() {
+			w.WriteHeader(orig.Status())
+		}
+
+		c.Writer = orig
+	}), opts)
+
+	return func(c *gin.Context) {
+		if c.Writer.Pusher() == nil {
+			c.Next()
+			return
+		}
+
+		r := c.Request.WithContext(context.WithValue(c.Request.Context(), ctxKey{}, c))
+		h.ServeHTTP(pusherWriter{c.Writer}, r)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Package pushh2 integrates serverpush with the stream
+// prioritisation of golang.org/x/net/http2.
+//
+// By default, the streams pushed for a response each
+// depend on the response's own stream with equal weight,
+// so a stylesheet and an image pushed for the same page
+// share the connection equally. The push handler pushes
+// in the order of the response's Link headers and its
+// Manifest resources by Priority, each ordered by their
+// fetchpriority hints, with dependencies following the
+// resource that references them, and the scheduler
+// returned by NewWriteScheduler sends them in that order
+// instead.
+//
+// Custom write schedulers are only used when x/net/http2
+// serves the connections itself. From Go 1.27, unless the
+// http2legacy build tag is set, x/net/http2 defers to
+// net/http and ignores them.
+package pushh2
+
+import "golang.org/x/net/http2"
+
+type writeScheduler struct {
+	http2.WriteScheduler
+
+	// last maps a stream to the most recent stream it
+	// pushed that is still open, and pusher maps each
+	// pushed stream to the stream that pushed it.
+	last   map[uint32]uint32
+	pusher map[uint32]uint32
+}
+
+// NewWriteScheduler returns an RFC 7540 priority write
+// scheduler in which each pushed stream depends on the
+// stream pushed before it for the same response, so that
+// pushes are sent one after another in the order they
+// were made. Clients may still reprioritise the streams.
+//
+// It is intended to be used as the NewWriteScheduler
+// field of an http2.Server:
+//
+//	s := &http2.Server{NewWriteScheduler: pushh2.NewWriteScheduler}
+func NewWriteScheduler() http2.WriteScheduler {
+	return &writeScheduler{
+		WriteScheduler: http2.NewPriorityWriteScheduler(nil),
+
+		last:   make(map[uint32]uint32),
+		pusher: make(map[uint32]uint32),
+	}
+}
+
+func (ws *writeScheduler) OpenStream(streamID uint32, options http2.OpenStreamOptions) {
+	ws.WriteScheduler.OpenStream(streamID, options)
+
+	if options.PusherID == 0 {
+		return
+	}
+
+	dep, ok := ws.last[options.PusherID]
+	if !ok {
+		dep = options.PusherID
+	}
+
+	ws.WriteScheduler.AdjustStream(streamID, http2.PriorityParam{
+		StreamDep: dep,
+		Weight:    15, // The default weight of 16, less one.
+	})
+
+	ws.last[options.PusherID] = streamID
+	ws.pusher[streamID] = options.PusherID
+}
+
+func (ws *writeScheduler) CloseStream(streamID uint32) {
+	ws.WriteScheduler.CloseStream(streamID)
+
+	if p, ok := ws.pusher[streamID]; ok {
+		delete(ws.pusher, streamID)
+
+		if ws.last[p] == streamID {
+			delete(ws.last, p)
+		}
+	}
+
+	delete(ws.last, streamID)
+}
@@ -0,0 +1,325 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package pushmanifest
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	serverpush "github.com/tmthrgd/go-server-push"
+	"golang.org/x/net/html"
+)
+
+var (
+	cssCommentRe = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	cssImportRe  = regexp.MustCompile(`@import\s+["']([^"']+)["']`)
+	cssURLRe     = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^)\s]*))\s*\)`)
+
+	jsImportRe = regexp.MustCompile(`(?m)^\s*(?:import|export)\s+(?:[\w$*{},\s]+?\s+from\s+)?["']([^"']+)["']`)
+)
+
+// Analyze computes the transitive dependencies of the
+// entrypoints in fsys, which is served beneath the URL
+// path base.
+//
+// Stylesheets, scripts and preloads are found in HTML
+// files, @import rules and url() references in CSS, and
+// static import and export ... from statements in
+// JavaScript modules. Only references to files that exist
+// in fsys are followed. Dynamic imports are not.
+//
+// entries names the files to analyze. If it is empty,
+// every .html file in fsys is analyzed. The returned
+// routes map the path of each entrypoint, and the
+// directory path of each index.html, to its dependencies
+// in the order they were found, with the size and direct
+// dependencies of each. Entrypoints without dependencies
+// are omitted.
+func Analyze(fsys fs.FS, base string, entries ...string) (map[string][]serverpush.Resource, error) {
+	if len(entries) == 0 {
+		err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && path.Ext(name) == ".html" {
+				entries = append(entries, name)
+			}
+
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	a := &analyzer{
+		fsys:  fsys,
+		base:  path.Join("/", base),
+		deps:  make(map[string][]string),
+		sizes: make(map[string]int64),
+	}
+
+	routes := make(map[string][]serverpush.Resource, len(entries))
+	for _, name := range entries {
+		name = strings.TrimPrefix(path.Clean("/"+name), "/")
+
+		var rs resourceSet
+		rs.mark(a.urlPath(name))
+
+		if err := a.walk(name, &rs); err != nil {
+			return nil, err
+		}
+
+		if len(rs.resources) == 0 {
+			continue
+		}
+
+		route := a.urlPath(name)
+		routes[route] = rs.resources
+
+		if path.Base(name) == "index.html" {
+			routes[strings.TrimSuffix(route, "index.html")] = rs.resources
+		}
+	}
+
+	return routes, nil
+}
+
+// FromFS analyzes every HTML file in fsys, which is served
+// beneath the URL path base, and returns the resulting
+// manifest. It is intended to be called at startup with an
+// embed.FS, or an fs.Sub of one, so that a single binary
+// pushes its own assets without any configuration:
+//
+//	//go:embed static
+//	var static embed.FS
+//
+//	sub, _ := fs.Sub(static, "static")
+//	m, err := pushmanifest.FromFS(sub, "/")
+//
+// The Link headers for a page, for clients that cannot
+// be pushed to, are given by m.Links or added by
+// m.AddLinks.
+func FromFS(fsys fs.FS, base string) (*serverpush.Manifest, error) {
+	routes, err := Analyze(fsys, base)
+	if err != nil {
+		return nil, err
+	}
+
+	m := new(serverpush.Manifest)
+	m.Replace(routes)
+	return m, nil
+}
+
+// HTTPFS adapts an http.FileSystem, such as http.Dir, for
+// use with Analyze.
+func HTTPFS(hfs http.FileSystem) fs.FS {
+	return httpFS{hfs}
+}
+
+type httpFS struct{ hfs http.FileSystem }
+
+func (h httpFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return h.hfs.Open("/" + name)
+}
+
+type analyzer struct {
+	fsys fs.FS
+	base string
+
+	// deps caches the direct dependencies of each file,
+	// by name within fsys, and sizes the size of each
+	// dependency.
+	deps  map[string][]string
+	sizes map[string]int64
+}
+
+func (a *analyzer) urlPath(name string) string {
+	return path.Join(a.base, name)
+}
+
+// walk adds the dependencies of name to rs, depth first.
+func (a *analyzer) walk(name string, rs *resourceSet) error {
+	deps, err := a.direct(name)
+	if err != nil {
+		return err
+	}
+
+	for _, dep := range deps {
+		p := a.urlPath(dep)
+		if rs.seen[p] {
+			continue
+		}
+
+		rs.add("/", p)
+		i := len(rs.resources) - 1
+		rs.resources[i].Size = a.sizes[dep]
+
+		if err := a.walk(dep, rs); err != nil {
+			return err
+		}
+
+		for _, d := range a.deps[dep] {
+			rs.resources[i].Deps = append(rs.resources[i].Deps, a.urlPath(d))
+		}
+	}
+
+	return nil
+}
+
+// direct returns the files in fsys that name references.
+func (a *analyzer) direct(name string) ([]string, error) {
+	if deps, ok := a.deps[name]; ok {
+		return deps, nil
+	}
+
+	b, err := fs.ReadFile(a.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []string
+	switch strings.ToLower(path.Ext(name)) {
+	case ".html", ".htm":
+		refs = htmlRefs(b)
+	case ".css":
+		refs = cssRefs(b)
+	case ".js", ".mjs":
+		refs = jsRefs(b)
+	case "":
+		// Pages are often served without an extension.
+		if strings.HasPrefix(http.DetectContentType(b), "text/html") {
+			refs = htmlRefs(b)
+		}
+	}
+
+	var deps []string
+	for _, ref := range refs {
+		dep, ok := a.resolve(name, ref)
+		if !ok || slices.Contains(deps, dep) {
+			continue
+		}
+
+		switch fi, err := fs.Stat(a.fsys, dep); {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return nil, err
+		default:
+			deps = append(deps, dep)
+			a.sizes[dep] = fi.Size()
+		}
+	}
+
+	a.deps[name] = deps
+	return deps, nil
+}
+
+// resolve returns the name within fsys of ref, a URL
+// referenced by the file name.
+func (a *analyzer) resolve(name, ref string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+
+	p := u.Path
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(path.Dir(a.urlPath(name)), p)
+	}
+
+	rel, ok := strings.CutPrefix(path.Clean(p), a.base)
+	if !ok || rel != "" && rel[0] != '/' && a.base != "/" {
+		return "", false
+	}
+
+	rel = strings.TrimPrefix(rel, "/")
+	return rel, rel != "" && fs.ValidPath(rel)
+}
+
+func htmlRefs(b []byte) []string {
+	var refs []string
+
+	z := html.NewTokenizer(bytes.NewReader(b))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return refs
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			if ref := htmlRef(tok); ref != "" {
+				refs = append(refs, ref)
+			}
+		}
+	}
+}
+
+func htmlRef(tok html.Token) string {
+	var ref, rel string
+	for _, attr := range tok.Attr {
+		switch attr.Key {
+		case "href", "src":
+			ref = attr.Val
+		case "rel":
+			rel = strings.ToLower(attr.Val)
+		}
+	}
+
+	switch tok.Data {
+	case "link":
+		for _, r := range strings.Fields(rel) {
+			switch r {
+			case "stylesheet", "preload", "modulepreload":
+				return ref
+			}
+		}
+	case "script":
+		return ref
+	}
+
+	return ""
+}
+
+func cssRefs(b []byte) []string {
+	b = cssCommentRe.ReplaceAll(b, nil)
+
+	var refs []string
+	for _, m := range cssImportRe.FindAllSubmatch(b, -1) {
+		refs = append(refs, string(m[1]))
+	}
+
+	for _, m := range cssURLRe.FindAllSubmatch(b, -1) {
+		for _, g := range m[1:] {
+			if len(g) != 0 {
+				refs = append(refs, string(g))
+			}
+		}
+	}
+
+	return refs
+}
+
+func jsRefs(b []byte) []string {
+	var refs []string
+	for _, m := range jsImportRe.FindAllSubmatch(b, -1) {
+		ref := string(m[1])
+
+		// Bare specifiers are resolved by an import map or
+		// a bundler and cannot be followed here.
+		if strings.HasPrefix(ref, "/") || strings.HasPrefix(ref, "./") || strings.HasPrefix(ref, "../") {
+			refs = append(refs, ref)
+		}
+	}
+
+	return refs
+}
@@ -0,0 +1,371 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package pushmanifest
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	serverpush "github.com/tmthrgd/go-server-push"
+)
+
+// ViteLoader returns a Loader for the manifest.json written
+// by Vite when build.manifest is enabled.
+//
+// routes maps request paths to the names of entry chunks
+// in the manifest, such as "src/main.ts". Each request
+// path is given the entry's CSS, the entry file and,
+// transitively, the chunks it statically imports. base is
+// the public base path of the build output, usually "/".
+//
+// Used with WatchWith, the push set is regenerated each
+// time the build rewrites the manifest.
+func ViteLoader(base string, routes map[string][]string) Loader {
+	return func(p string) (map[string][]serverpush.Resource, error) {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+
+		var chunks map[string]struct {
+			File    string   `json:"file"`
+			CSS     []string `json:"css"`
+			Imports []string `json:"imports"`
+		}
+		if err := json.Unmarshal(b, &chunks); err != nil {
+			return nil, err
+		}
+
+		out := make(map[string][]serverpush.Resource, len(routes))
+		for route, entries := range routes {
+			var rs resourceSet
+
+			var visit func(name string)
+			visit = func(name string) {
+				chunk, ok := chunks[name]
+				if !ok || rs.seen[name] {
+					return
+				}
+
+				rs.mark(name)
+
+				for _, css := range chunk.CSS {
+					rs.add(base, css)
+				}
+
+				rs.add(base, chunk.File)
+
+				for _, imp := range chunk.Imports {
+					visit(imp)
+				}
+			}
+
+			for _, entry := range entries {
+				visit(entry)
+			}
+
+			out[route] = rs.resources
+		}
+
+		return out, nil
+	}
+}
+
+// WebpackLoader returns a Loader for the manifest.json
+// written by webpack-manifest-plugin or
+// webpack-assets-manifest.
+//
+// routes maps request paths to names in the manifest.
+// Where the manifest has an entrypoints object, names are
+// looked up there and every asset of the entrypoint is
+// used. Otherwise names are the logical file names of the
+// flat manifest, such as "main.js". base is prepended to
+// relative asset paths.
+func WebpackLoader(base string, routes map[string][]string) Loader {
+	return func(p string) (map[string][]serverpush.Resource, error) {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return nil, err
+		}
+
+		entrypoints := make(map[string][]string)
+		if ep, ok := raw["entrypoints"]; ok {
+			var eps map[string]json.RawMessage
+			if err := json.Unmarshal(ep, &eps); err != nil {
+				return nil, err
+			}
+
+			for name, v := range eps {
+				entrypoints[name] = webpackEntryAssets(v)
+			}
+		}
+
+		files := make(map[string]string, len(raw))
+		for name, v := range raw {
+			var file string
+			if json.Unmarshal(v, &file) == nil {
+				files[name] = file
+			}
+		}
+
+		out := make(map[string][]serverpush.Resource, len(routes))
+		for route, names := range routes {
+			var rs resourceSet
+
+			for _, name := range names {
+				if assets, ok := entrypoints[name]; ok {
+					for _, asset := range assets {
+						rs.add(base, asset)
+					}
+				} else if file, ok := files[name]; ok {
+					rs.add(base, file)
+				}
+			}
+
+			out[route] = rs.resources
+		}
+
+		return out, nil
+	}
+}
+
+// EsbuildLoader returns a Loader for the metafile written
+// by esbuild when metafile is enabled.
+//
+// routes maps request paths to entry points, as they are
+// named in the inputs of the metafile, such as
+// "src/app.ts". Each request path is given the CSS bundle
+// of the entry point, its output file and, transitively,
+// the code-split chunks it statically imports, along with
+// their sizes. Output paths are relative to the directory
+// esbuild was run in, so outdir is removed from them
+// before base is prepended.
+func EsbuildLoader(base, outdir string, routes map[string][]string) Loader {
+	outdir = path.Clean(filepath.ToSlash(outdir))
+
+	return func(p string) (map[string][]serverpush.Resource, error) {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+
+		var meta struct {
+			Outputs map[string]struct {
+				Bytes   int64 `json:"bytes"`
+				Imports []struct {
+					Path string `json:"path"`
+					Kind string `json:"kind"`
+				} `json:"imports"`
+				EntryPoint string `json:"entryPoint"`
+				CSSBundle  string `json:"cssBundle"`
+			} `json:"outputs"`
+		}
+		if err := json.Unmarshal(b, &meta); err != nil {
+			return nil, err
+		}
+
+		entries := make(map[string]string, len(meta.Outputs))
+		for out, o := range meta.Outputs {
+			if o.EntryPoint != "" {
+				entries[o.EntryPoint] = out
+			}
+		}
+
+		rel := func(out string) string {
+			r, err := filepath.Rel(outdir, path.Clean(out))
+			if err != nil {
+				return out
+			}
+
+			return filepath.ToSlash(r)
+		}
+
+		out := make(map[string][]serverpush.Resource, len(routes))
+		for route, names := range routes {
+			var rs resourceSet
+
+			add := func(file string) {
+				n := len(rs.resources)
+				rs.add(base, rel(file))
+
+				if len(rs.resources) > n {
+					rs.resources[n].Size = meta.Outputs[file].Bytes
+				}
+			}
+
+			var visit func(file string)
+			visit = func(file string) {
+				o, ok := meta.Outputs[file]
+				if !ok || rs.seen[file] {
+					return
+				}
+
+				rs.mark(file)
+
+				if o.CSSBundle != "" {
+					add(o.CSSBundle)
+				}
+
+				add(file)
+
+				for _, imp := range o.Imports {
+					if imp.Kind == "import-statement" {
+						visit(imp.Path)
+					}
+				}
+			}
+
+			for _, name := range names {
+				if file, ok := entries[name]; ok {
+					visit(file)
+				}
+			}
+
+			out[route] = rs.resources
+		}
+
+		return out, nil
+	}
+}
+
+// webpackEntryAssets returns the assets of an entrypoint,
+// which is either an array of files or, as written by
+// webpack-assets-manifest, an object of the form
+// {"assets": {"css": [...], "js": [...]}}.
+func webpackEntryAssets(v json.RawMessage) []string {
+	var files []string
+	if json.Unmarshal(v, &files) == nil {
+		return files
+	}
+
+	var entry struct {
+		Assets map[string][]string `json:"assets"`
+	}
+	if json.Unmarshal(v, &entry) != nil {
+		return nil
+	}
+
+	// Stylesheets block rendering, so they are listed
+	// before scripts.
+	files = append(files, entry.Assets["css"]...)
+	files = append(files, entry.Assets["js"]...)
+	return files
+}
+
+type resourceSet struct {
+	resources []serverpush.Resource
+	seen      map[string]bool
+}
+
+func (rs *resourceSet) mark(key string) {
+	if rs.seen == nil {
+		rs.seen = make(map[string]bool)
+	}
+
+	rs.seen[key] = true
+}
+
+// add adds file, resolved against base, if it has not
+// been added already. Files on other origins are skipped.
+func (rs *resourceSet) add(base, file string) {
+	if file == "" || strings.Contains(file, "://") || strings.HasPrefix(file, "//") {
+		return
+	}
+
+	if !strings.HasPrefix(file, "/") {
+		file = path.Join("/", base, file)
+	}
+
+	if rs.seen[file] {
+		return
+	}
+
+	rs.mark(file)
+	rs.resources = append(rs.resources, serverpush.Resource{
+		Path: file,
+		As:   destination(file),
+	})
+}
+
+// destination returns the preload destination for file
+// based on its extension.
+func destination(file string) string {
+	switch strings.ToLower(path.Ext(file)) {
+	case ".css":
+		return "style"
+	case ".js", ".mjs":
+		return "script"
+	case ".woff", ".woff2", ".ttf", ".otf":
+		return "font"
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".avif", ".svg":
+		return "image"
+	default:
+		return ""
+	}
+}
+
+// WithSizes returns a Loader that calls load and then sets
+// the Size of each resource that does not have one from
+// the file in fsys that is served at its path. base is the
+// URL path fsys is served beneath. Resources outside of
+// base, or that are missing from fsys, are left unsized.
+//
+// Build tool manifests do not record sizes, so it allows
+// Options.PushBudget to be used with them by reading the
+// build output once, when the manifest is loaded:
+//
+//	load := pushmanifest.WithSizes(
+//		pushmanifest.ViteLoader("/", routes),
+//		os.DirFS("dist"), "/")
+func WithSizes(load Loader, fsys fs.FS, base string) Loader {
+	base = path.Join("/", base)
+
+	return func(p string) (map[string][]serverpush.Resource, error) {
+		routes, err := load(p)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, resources := range routes {
+			for i := range resources {
+				res := &resources[i]
+				if res.Size != 0 {
+					continue
+				}
+
+				rel, ok := strings.CutPrefix(res.Path, base)
+				if !ok {
+					continue
+				}
+
+				rel = strings.TrimPrefix(rel, "/")
+				if !fs.ValidPath(rel) {
+					continue
+				}
+
+				switch fi, err := fs.Stat(fsys, rel); {
+				case errors.Is(err, fs.ErrNotExist):
+				case err != nil:
+					return nil, err
+				case fi.Mode().IsRegular():
+					res.Size = fi.Size()
+				}
+			}
+		}
+
+		return routes, nil
+	}
+}
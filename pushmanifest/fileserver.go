@@ -0,0 +1,51 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package pushmanifest
+
+import (
+	"io/fs"
+	"net/http"
+	"strings"
+
+	serverpush "github.com/tmthrgd/go-server-push"
+)
+
+// FileServer returns a push handler that serves fsys, as
+// http.FileServerFS does, beneath the URL path base.
+//
+// fsys is analyzed with FromFS when FileServer is called.
+// Each HTML file is then served with a preload Link header
+// for each of its dependencies, which are pushed to
+// clients that support it and preloaded by those that do
+// not. Changes made to fsys afterwards are not seen.
+//
+// The handler should be registered for base without
+// stripping it from the request path:
+//
+//	h, err := pushmanifest.FileServer(sub, "/static/", 8192, 4, nil)
+//	mux.Handle("/static/", h)
+func FileServer(fsys fs.FS, base string, m, k uint, opts *serverpush.Options) (*serverpush.PushHandler, error) {
+	manifest, err := FromFS(fsys, base)
+	if err != nil {
+		return nil, err
+	}
+
+	var o serverpush.Options
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.Manifest == nil {
+		o.Manifest = manifest
+	}
+
+	h := http.FileServerFS(fsys)
+	if prefix := strings.TrimSuffix(base, "/"); prefix != "" {
+		h = http.StripPrefix(prefix, h)
+	}
+
+	return serverpush.New(m, k, manifest.AddLinks(h), &o), nil
+}
@@ -0,0 +1,20 @@
+module github.com/tmthrgd/go-server-push/pushmanifest
+
+go 1.22
+
+replace github.com/tmthrgd/go-server-push => ../
+
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/tmthrgd/go-server-push v0.0.0-00010101000000-000000000000
+	golang.org/x/net v0.35.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/golang/gddo v0.0.0-20180823221919-9d8ff1c67be5 // indirect
+	github.com/spaolacci/murmur3 v1.1.0 // indirect
+	github.com/willf/bitset v1.1.11 // indirect
+	github.com/willf/bloom v2.0.3+incompatible // indirect
+	golang.org/x/sys v0.30.0 // indirect
+)
@@ -0,0 +1,182 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Package pushmanifest builds serverpush manifests from JSON
+// or YAML files, the manifests of frontend build tools and
+// the static assets themselves, and reloads them when they
+// change.
+package pushmanifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	serverpush "github.com/tmthrgd/go-server-push"
+	"gopkg.in/yaml.v3"
+)
+
+// A Loader reads the file at path and returns the routes of
+// a manifest, mapping request paths to resources.
+type Loader func(path string) (map[string][]serverpush.Resource, error)
+
+// Load reads the manifest file at path. Files with a .yaml
+// or .yml extension are decoded as YAML, using the same
+// structure as serverpush.ReadManifest, and all others as
+// JSON.
+func Load(path string) (*serverpush.Manifest, error) {
+	return LoadWith(path, load)
+}
+
+// LoadWith reads the file at path with load and returns
+// the resulting manifest.
+func LoadWith(path string, load Loader) (*serverpush.Manifest, error) {
+	routes, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := new(serverpush.Manifest)
+	m.Replace(routes)
+	return m, nil
+}
+
+func load(path string) (map[string][]serverpush.Resource, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(b, isYAML(filepath.Ext(path)))
+}
+
+func isYAML(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		return true
+	default:
+		return false
+	}
+}
+
+func decode(b []byte, isYAML bool) (routes map[string][]serverpush.Resource, err error) {
+	if isYAML {
+		err = yaml.Unmarshal(b, &routes)
+	} else {
+		err = json.NewDecoder(bytes.NewReader(b)).Decode(&routes)
+	}
+
+	return routes, err
+}
+
+// Watcher reloads a manifest whenever its file changes.
+type Watcher struct {
+	w    *fsnotify.Watcher
+	done chan struct{}
+}
+
+// Watch watches the manifest file at path and replaces the
+// contents of m each time the file is written or replaced.
+// The directory containing path is watched, so editors
+// and deployment tools that replace the file by renaming
+// are supported.
+//
+// If a reload fails, m is left unchanged and onError, if
+// non-nil, is called with the error.
+func Watch(path string, m *serverpush.Manifest, onError func(error)) (*Watcher, error) {
+	return WatchWith(path, load, m, onError)
+}
+
+// WatchWith is like Watch but reads the file with load.
+func WatchWith(path string, load Loader, m *serverpush.Manifest, onError func(error)) (*Watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := fw.Add(filepath.Dir(path)); err != nil {
+		fw.Close()
+		return nil, err
+	}
+
+	w := &Watcher{
+		w:    fw,
+		done: make(chan struct{}),
+	}
+
+	go w.run(filepath.Clean(path), load, m, onError)
+	return w, nil
+}
+
+func (w *Watcher) run(path string, load Loader, m *serverpush.Manifest, onError func(error)) {
+	defer close(w.done)
+
+	for {
+		select {
+		case ev, ok := <-w.w.Events:
+			if !ok {
+				return
+			}
+
+			if filepath.Clean(ev.Name) != path ||
+				!ev.Has(fsnotify.Write) && !ev.Has(fsnotify.Create) {
+				continue
+			}
+
+			routes, err := load(path)
+			if err != nil {
+				if onError != nil {
+					onError(err)
+				}
+
+				continue
+			}
+
+			m.Replace(routes)
+		case err, ok := <-w.w.Errors:
+			if !ok {
+				return
+			}
+
+			if onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Close stops watching the manifest file.
+func (w *Watcher) Close() error {
+	err := w.w.Close()
+	<-w.done
+	return err
+}
+
+// OverlayLoader returns a Loader that loads a base manifest
+// file and then applies the manifest files at overlays to
+// it, in order, with serverpush.Overlay. Each file is read
+// as by Load.
+//
+// Used with WatchWith, only the base file is watched.
+func OverlayLoader(overlays ...string) Loader {
+	return func(path string) (map[string][]serverpush.Resource, error) {
+		base, err := load(path)
+		if err != nil {
+			return nil, err
+		}
+
+		layers := make([]map[string][]serverpush.Resource, len(overlays))
+		for i, overlay := range overlays {
+			if layers[i], err = load(overlay); err != nil {
+				return nil, err
+			}
+		}
+
+		return serverpush.Overlay(base, layers...), nil
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package pushmanifest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+
+	serverpush "github.com/tmthrgd/go-server-push"
+)
+
+// maxRemoteSize is the largest manifest that Poll will
+// download.
+const maxRemoteSize = 10 << 20
+
+// Poller refreshes a manifest from a URL.
+type Poller struct {
+	url    string
+	client *http.Client
+	m      *serverpush.Manifest
+
+	etag, lastModified string
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Poll fetches the manifest at url into m and then fetches
+// it again every interval, so that a manifest built
+// centrally can be distributed to many servers. The
+// contents of m are replaced only when the manifest has
+// changed; the ETag and Last-Modified of the previous
+// response are sent so that an unchanged manifest is not
+// downloaded again.
+//
+// The manifest is decoded as YAML if it is served with a
+// YAML media type or url has a .yaml or .yml extension,
+// and as JSON otherwise. If client is nil,
+// http.DefaultClient is used.
+//
+// The first fetch is made before Poll returns and its
+// error, if any, is returned. If a later fetch fails, m is
+// left unchanged and onError, if non-nil, is called with
+// the error.
+func Poll(url string, interval time.Duration, client *http.Client, m *serverpush.Manifest, onError func(error)) (*Poller, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Poller{
+		url:    url,
+		client: client,
+		m:      m,
+
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	if err := p.fetch(ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	go p.run(ctx, interval, onError)
+	return p, nil
+}
+
+func (p *Poller) run(ctx context.Context, interval time.Duration, onError func(error)) {
+	defer close(p.done)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if err := p.fetch(ctx); err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+func (p *Poller) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return err
+	}
+
+	if p.etag != "" {
+		req.Header.Set("If-None-Match", p.etag)
+	}
+
+	if p.lastModified != "" {
+		req.Header.Set("If-Modified-Since", p.lastModified)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil
+	default:
+		return fmt.Errorf("pushmanifest: fetching %s: unexpected status %s", p.url, resp.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteSize+1))
+	if err != nil {
+		return err
+	}
+
+	if len(b) > maxRemoteSize {
+		return fmt.Errorf("pushmanifest: fetching %s: manifest is larger than %d bytes", p.url, maxRemoteSize)
+	}
+
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	yaml := isYAML(path.Ext(req.URL.Path))
+	switch mt {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		yaml = true
+	}
+
+	routes, err := decode(b, yaml)
+	if err != nil {
+		return err
+	}
+
+	p.m.Replace(routes)
+	p.etag = resp.Header.Get("ETag")
+	p.lastModified = resp.Header.Get("Last-Modified")
+	return nil
+}
+
+// Close stops refreshing the manifest.
+func (p *Poller) Close() error {
+	p.cancel()
+	<-p.done
+	return nil
+}
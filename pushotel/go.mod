@@ -0,0 +1,19 @@
+module github.com/tmthrgd/go-server-push/pushotel
+
+go 1.22
+
+replace github.com/tmthrgd/go-server-push => ../
+
+require (
+	github.com/tmthrgd/go-server-push v0.0.0-00010101000000-000000000000
+	go.opentelemetry.io/otel v1.7.0
+	go.opentelemetry.io/otel/trace v1.7.0
+)
+
+require (
+	github.com/golang/gddo v0.0.0-20180823221919-9d8ff1c67be5 // indirect
+	github.com/spaolacci/murmur3 v1.1.0 // indirect
+	github.com/willf/bitset v1.1.11 // indirect
+	github.com/willf/bloom v2.0.3+incompatible // indirect
+	golang.org/x/net v0.35.0 // indirect
+)
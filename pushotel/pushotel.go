@@ -0,0 +1,77 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Package pushotel records the push decisions made by
+// serverpush as OpenTelemetry span events.
+package pushotel
+
+import (
+	"net/http"
+
+	serverpush "github.com/tmthrgd/go-server-push"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EventName is the name of the span event added for each
+// push decision.
+const EventName = "serverpush.push"
+
+// Hooks returns serverpush.Hooks that add a span event to
+// the active span of the request for each push decision.
+//
+// If next is non-nil, its callbacks are preserved and its
+// Push callback is invoked after the span event has been
+// recorded.
+func Hooks(next *serverpush.Hooks) *serverpush.Hooks {
+	var h serverpush.Hooks
+	if next != nil {
+		h = *next
+	}
+
+	push := h.Push
+	h.Push = func(r *http.Request, e serverpush.PushEvent) {
+		span := trace.SpanFromContext(r.Context())
+		if span.IsRecording() {
+			attrs := []attribute.KeyValue{
+				attribute.String("serverpush.target", e.Target),
+				attribute.String("serverpush.outcome", e.Outcome.String()),
+				attribute.Int64("serverpush.duration_ns", int64(e.Duration)),
+			}
+
+			if e.Err != nil {
+				attrs = append(attrs, attribute.String("serverpush.error", e.Err.Error()))
+			}
+
+			span.AddEvent(EventName, trace.WithAttributes(attrs...))
+		}
+
+		if push != nil {
+			push(r, e)
+		}
+	}
+
+	return &h
+}
+
+// New wraps the given http.Handler in a push aware handler
+// that records push decisions on the active request span.
+// It is otherwise identical to serverpush.New.
+func New(m, k uint, handler http.Handler, opts *serverpush.Options) serverpush.Handler {
+	var o serverpush.Options
+	if opts != nil {
+		o = *opts
+	}
+
+	o.Hooks = Hooks(o.Hooks)
+	return serverpush.New(m, k, handler, &o)
+}
+
+// Wrapper returns a serverpush.Middleware that calls New.
+func Wrapper(m, k uint, opts *serverpush.Options) serverpush.Middleware {
+	return func(h http.Handler) http.Handler {
+		return New(m, k, h, opts)
+	}
+}
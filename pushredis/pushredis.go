@@ -0,0 +1,187 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Package pushredis synchronises the server-side bloom
+// filters of a cluster of push handlers over a Redis
+// pub/sub channel.
+//
+// Each instance keeps its filters in a local
+// serverpush.FilterStore and publishes every filter it
+// saves. The other instances merge it into the filter they
+// hold for the same client with serverpush.FilterInfo.Union,
+// so push state stays roughly consistent across the cluster
+// without sticky sessions. Messages are not persisted: an
+// instance that is not subscribed when a filter is saved
+// never learns of it, and learns the client's filter only
+// when it is next saved by a peer.
+package pushredis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	serverpush "github.com/tmthrgd/go-server-push"
+)
+
+// Store is a serverpush.FilterStore that broadcasts the
+// filters it saves to its peers.
+type Store struct {
+	local   serverpush.FilterStore
+	rdb     redis.UniversalClient
+	channel string
+	onError func(error)
+
+	// id identifies the messages published by this Store,
+	// which it ignores when they are received.
+	id string
+
+	// mu serialises the merging of filters received from
+	// peers with those saved locally.
+	mu sync.Mutex
+
+	sub  *redis.PubSub
+	done chan struct{}
+}
+
+type message struct {
+	From   string `json:"from"`
+	Key    string `json:"key"`
+	Filter string `json:"filter"`
+}
+
+// New subscribes to channel and returns a Store that keeps
+// filters in local. onError, if non-nil, is called with
+// errors encountered publishing or merging filters.
+//
+// The Store should be closed when it is no longer needed.
+func New(ctx context.Context, rdb redis.UniversalClient, channel string, local serverpush.FilterStore, onError func(error)) (*Store, error) {
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+
+	sub := rdb.Subscribe(ctx, channel)
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	s := &Store{
+		local:   local,
+		rdb:     rdb,
+		channel: channel,
+		onError: onError,
+
+		id: hex.EncodeToString(id[:]),
+
+		sub:  sub,
+		done: make(chan struct{}),
+	}
+
+	go s.receive(sub.Channel())
+	return s, nil
+}
+
+// Close unsubscribes from the channel.
+func (s *Store) Close() error {
+	err := s.sub.Close()
+	<-s.done
+	return err
+}
+
+// Load implements serverpush.FilterStore.
+func (s *Store) Load(ctx context.Context, key string) (*serverpush.FilterInfo, error) {
+	return s.local.Load(ctx, key)
+}
+
+// Save implements serverpush.FilterStore. The filter is
+// saved locally before it is published, and an error
+// publishing it is passed to onError rather than returned.
+func (s *Store) Save(ctx context.Context, key string, fi *serverpush.FilterInfo) error {
+	s.mu.Lock()
+	err := s.local.Save(ctx, key, fi)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	v, err := fi.CookieValue()
+	if err != nil {
+		s.error(err)
+		return nil
+	}
+
+	b, err := json.Marshal(message{From: s.id, Key: key, Filter: v})
+	if err != nil {
+		s.error(err)
+		return nil
+	}
+
+	if err := s.rdb.Publish(ctx, s.channel, b).Err(); err != nil {
+		s.error(err)
+	}
+
+	return nil
+}
+
+func (s *Store) receive(ch <-chan *redis.Message) {
+	defer close(s.done)
+
+	for msg := range ch {
+		if err := s.merge(msg.Payload); err != nil {
+			s.error(err)
+		}
+	}
+}
+
+// merge adds the filter of a message published by a peer
+// to that held locally for the same client. If their
+// parameters or generations differ, the peer's replaces
+// it.
+func (s *Store) merge(payload string) error {
+	var m message
+	if err := json.Unmarshal([]byte(payload), &m); err != nil {
+		return err
+	}
+
+	if m.From == s.id {
+		return nil
+	}
+
+	fi, err := serverpush.InspectCookie(m.Filter)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cur, err := s.local.Load(ctx, m.Key)
+	if err != nil {
+		return err
+	}
+
+	if cur != nil {
+		// The stored filter must not be modified, so the
+		// peer's, which is not shared, is added to.
+		if err := fi.Union(cur); err != nil && err != serverpush.ErrFilterMismatch {
+			return err
+		}
+	}
+
+	return s.local.Save(ctx, m.Key, fi)
+}
+
+func (s *Store) error(err error) {
+	if s.onError != nil {
+		s.onError(err)
+	}
+}
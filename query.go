@@ -0,0 +1,93 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"slices"
+	"strings"
+)
+
+// filterKey returns the form of target that is tested for
+// and added to the client's filter, with its query
+// canonicalised as set by Options.SortQuery and
+// Options.StripQuery. Targets are still pushed as given.
+func (o *options) filterKey(target string) string {
+	if !o.sortQuery && len(o.stripQuery) == 0 {
+		return target
+	}
+
+	return canonicalQuery(target, o.sortQuery, o.stripQuery)
+}
+
+// canonicalQuery removes the parameters of the query of
+// target whose names match strip, and any that are empty,
+// and, if sort is set, orders the rest by name. Parameters
+// of the same name keep their order.
+func canonicalQuery(target string, sort bool, strip []string) string {
+	target, fragment, hasFragment := strings.Cut(target, "#")
+
+	path, query, ok := strings.Cut(target, "?")
+	if !ok {
+		if hasFragment {
+			return target + "#" + fragment
+		}
+
+		return target
+	}
+
+	params := strings.Split(query, "&")
+	params = slices.DeleteFunc(params, func(param string) bool {
+		return param == "" || matchParam(strip, paramName(param))
+	})
+
+	if sort {
+		slices.SortStableFunc(params, func(a, b string) int {
+			return strings.Compare(paramName(a), paramName(b))
+		})
+	}
+
+	var b strings.Builder
+	b.Grow(len(target) + 1 + len(fragment))
+	b.WriteString(path)
+
+	for i, param := range params {
+		if i == 0 {
+			b.WriteByte('?')
+		} else {
+			b.WriteByte('&')
+		}
+
+		b.WriteString(param)
+	}
+
+	if hasFragment {
+		b.WriteByte('#')
+		b.WriteString(fragment)
+	}
+
+	return b.String()
+}
+
+func paramName(param string) string {
+	name, _, _ := strings.Cut(param, "=")
+	return name
+}
+
+// matchParam reports whether name matches any of patterns,
+// each either a parameter name or a prefix followed by *.
+func matchParam(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+
+	return false
+}
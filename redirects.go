@@ -6,93 +6,211 @@
 package serverpush
 
 import (
-	"io"
+	"context"
 	"net/http"
-
-	"github.com/tmthrgd/httputils"
+	"net/url"
+	"slices"
+	"strings"
 )
 
-type redirectResponseWriter struct {
-	http.ResponseWriter
-	req *http.Request
+// redirectLocation returns the Location of a redirect
+// response to r if it should be pushed, or the empty string
+// otherwise. The Location is resolved against the request
+// URL and must be same-origin.
+func (o *options) redirectLocation(r *http.Request, code int, h http.Header) string {
+	if _, ok := h[noPushRedirectHeader]; ok {
+		return ""
+	}
 
-	opts *http.PushOptions
-}
+	// Only redirects that clients follow automatically are
+	// pushed, which excludes 300, 304 and 305.
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return ""
+	}
 
-func (w *redirectResponseWriter) WriteHeader(code int) {
-	req := w.req
-	w.req = nil
+	location := o.sameOriginTarget(r, h.Get("Location"))
+	if location == "" {
+		return ""
+	}
 
-	location := w.Header().Get("Location")
-	if req == nil || code < 300 || code >= 400 ||
-		location == "" || location[0] != '/' {
-		w.ResponseWriter.WriteHeader(code)
-		return
+	if o.redirectCodes != nil && !slices.Contains(o.redirectCodes, code) {
+		return ""
 	}
 
-	opts := *w.opts
-	opts.Header = headers(w.opts, req)
+	if o.redirectMethods != nil {
+		if !slices.Contains(o.redirectMethods, r.Method) {
+			return ""
+		}
+	} else if !redirectFollowedWithGet(code, r.Method) {
+		return ""
+	}
 
-	if err := w.Push(location, &opts); err != nil && err != http.ErrNotSupported {
-		httputils.RequestLogf(req, "go-server-push: error pushing resource %q: %#v", location, err)
+	if o.redirectFilter != nil && !o.redirectFilter(r, code, location) {
+		return ""
 	}
 
-	w.ResponseWriter.WriteHeader(code)
+	return location
 }
 
-func (w *redirectResponseWriter) WriteString(s string) (n int, err error) {
-	return io.WriteString(w.ResponseWriter, s)
+// redirectFollowedWithGet reports whether a client that
+// follows a redirect with the given status code from a
+// request with the given method will GET the Location.
+//
+// 303 See Other is always followed with a GET and browsers
+// also switch POST to GET for 301 and 302, but 307 and 308
+// preserve the method, so pushing their Location is only
+// useful after a GET or HEAD.
+func redirectFollowedWithGet(code int, method string) bool {
+	switch code {
+	case http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return method == http.MethodGet || method == http.MethodHead
+	default:
+		return true
+	}
+}
+
+// sameOriginTarget resolves location against the URL of r
+// and returns the resulting path and query, or the empty
+// string if location is malformed, ambiguous or refers to
+// another origin. The scheme of the origin is that of r,
+// as for the cookie, so an absolute https location is
+// same-origin behind a TLS-terminating proxy when
+// TrustForwardedProto is set.
+//
+// Locations that browsers and servers may disagree about,
+// such as those beginning with // or containing
+// backslashes, control characters or encoded slashes, are
+// rejected rather than normalised.
+func (o *options) sameOriginTarget(r *http.Request, location string) string {
+	if location == "" || strings.HasPrefix(location, "//") ||
+		strings.IndexFunc(location, isUnsafeLocationRune) >= 0 {
+		return ""
+	}
+
+	lower := strings.ToLower(location)
+	for _, enc := range [...]string{"%2f", "%5c", "%00"} {
+		if strings.Contains(lower, enc) {
+			return ""
+		}
+	}
+
+	u, err := url.Parse(location)
+	if err != nil || u.Opaque != "" || u.User != nil {
+		return ""
+	}
+
+	if u.Scheme != "" || u.Host != "" {
+		if !strings.EqualFold(u.Scheme, o.scheme(r)) || !strings.EqualFold(u.Host, r.Host) {
+			return ""
+		}
+
+		u.Scheme, u.Host = "", ""
+	}
+
+	return r.URL.ResolveReference(u).RequestURI()
 }
 
-func (w *redirectResponseWriter) Push(target string, opts *http.PushOptions) error {
-	return w.ResponseWriter.(http.Pusher).Push(target, opts)
+func isUnsafeLocationRune(r rune) bool {
+	return r <= ' ' || r == 0x7f || r == '\\'
 }
 
-func (w *redirectResponseWriter) Flush() {
-	if f, ok := w.ResponseWriter.(http.Flusher); ok {
-		f.Flush()
+// locationPath returns the path of a pushed Location,
+// without any query or fragment.
+func locationPath(location string) string {
+	if i := strings.IndexAny(location, "?#"); i >= 0 {
+		return location[:i]
 	}
+
+	return location
 }
 
-type redirects struct {
-	http.Handler
-	opts http.PushOptions
+// NoPushRedirect marks the response so that the Location of
+// the redirect is not pushed, for example for a logout
+// redirect or a redirect to a page that requires fresh
+// authentication state. It must be called before the
+// response headers are written.
+//
+// It sets a header that is removed before the response is
+// sent, whether or not the handler pushes it.
+// NoPushRedirect has no effect on Link headers.
+func NoPushRedirect(w http.ResponseWriter) {
+	w.Header().Set(noPushRedirectHeader, "1")
 }
 
-func (pr *redirects) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if _, ok := w.(http.Pusher); !ok {
-		pr.Handler.ServeHTTP(w, r)
+// takeNoPushRedirect removes the header set by
+// NoPushRedirect from h, recording it in res, which is
+// shared with any push handler that this one is nested in.
+func takeNoPushRedirect(h http.Header, res *Result) {
+	if _, ok := h[noPushRedirectHeader]; !ok {
 		return
 	}
 
-	rrw := &redirectResponseWriter{
-		ResponseWriter: w,
-		req:            r,
+	delete(h, noPushRedirectHeader)
+	if res != nil {
+		res.noPushRedirect = true
+	}
+}
 
-		opts: &pr.opts,
+// NewRedirects is like New but only pushes the Location of
+// redirect responses, leaving Link headers untouched.
+//
+// Pushed locations are recorded in the bloom filter cookie,
+// so a client that is repeatedly redirected to the same
+// target is only pushed it once. If Options.Cookie is nil,
+// the cookie is named X-H2-Push-Redirects, so that it does
+// not collide with that of a handler returned by New,
+// which may wrap this one with a filter of a different
+// size. The cookie may be shared with such a handler by
+// setting the same Options.Cookie and the same m and k.
+//
+// As with New, if Validate reports an error, it is logged
+// and requests are passed through without pushing.
+func NewRedirects(m, k uint, handler http.Handler, opts *Options) *PushHandler {
+	var o Options
+	if opts != nil {
+		o = *opts
 	}
 
-	var rw http.ResponseWriter = rrw
+	o.PushRedirects = true
 
-	if _, ok := w.(http.CloseNotifier); ok {
-		rw = closeNotifyRedirectsResponseWriter{rrw}
+	if o.Cookie == nil {
+		o.Cookie = DefaultCookie()
+		o.Cookie.Name = redirectsCookieName
+		o.Cookie.Secure = !o.Cleartext
 	}
 
-	pr.Handler.ServeHTTP(rw, r)
-}
+	s := &PushHandler{
+		Handler: handler,
 
-// Redirects wraps the given http.Handler and pushes the Location
-// of redirects to clients.
-func Redirects(h http.Handler, opts *http.PushOptions) Handler {
-	r := &redirects{
-		Handler: h,
+		redirectsOnly: true,
 	}
 
-	if opts != nil {
-		r.opts = *opts
+	if err := Validate(m, k, &o); err != nil {
+		s.setInvalid(err, &o)
+		return s
 	}
 
-	return r
+	s.setOptions(m, k, &o)
+	return s
+}
+
+// Redirects wraps the given http.Handler and pushes the Location
+// of redirects to clients.
+//
+// It is equivalent to calling NewRedirects with opts as
+// the PushOptions and a filter sized as for NewHandler. Use
+// NewRedirects directly to configure the proxied request
+// headers, the cookie or any of the other Options.
+//
+// Pushed locations are recorded in the X-H2-Push-Redirects
+// bloom filter cookie, as for NewRedirects, so a location
+// is only pushed to a client once. Responses that push a
+// location therefore set that cookie.
+func Redirects(h http.Handler, opts *http.PushOptions) Handler {
+	return NewRedirects(defaultM, defaultK, h, &Options{PushOptions: opts})
 }
 
 // RedirectsWrap returns a Middleware that calls Redirects.
@@ -102,12 +220,78 @@ func RedirectsWrap(opts *http.PushOptions) Middleware {
 	}
 }
 
-// This struct is intentionally small (1 pointer wide) so as to
-// fit inside an interface{} without causing an allocaction.
-type closeNotifyRedirectsResponseWriter struct{ *redirectResponseWriter }
+// RedirectsWrapper returns a Middleware that calls
+// NewRedirects.
+func RedirectsWrapper(m, k uint, opts *Options) Middleware {
+	return func(h http.Handler) http.Handler {
+		return NewRedirects(m, k, h, opts)
+	}
+}
+
+// followRedirects resolves the chain of redirects starting
+// at location by serving each hop internally with the
+// wrapped handler. It returns the last location reached
+// within the configured depth, stopping at the first hop
+// that does not redirect.
+//
+// Each hop is served as a HEAD request, so that a handler
+// may skip rendering the final target, but its
+// redirectLocation is decided as for the GET the client
+// will make.
+func (w *pushResponseWriter) followRedirects(location string) string {
+	seen := []string{location}
+
+	for i := 0; i < w.opts.redirectDepth; i++ {
+		u, err := url.ParseRequestURI(location)
+		if err != nil {
+			break
+		}
+
+		r := w.req.Clone(context.WithValue(w.req.Context(), isPushKey{w.opts.sentinel.name}, true))
+		r.Method = http.MethodHead
+		r.URL = w.req.URL.ResolveReference(u)
+		r.RequestURI = location
+		r.Body = http.NoBody
+		r.ContentLength = 0
+		r.Header.Del("Content-Type")
 
-var _ http.CloseNotifier = closeNotifyRedirectsResponseWriter{}
+		rec := &discardRecorder{header: make(http.Header)}
+		w.handler.ServeHTTP(rec, r)
+
+		r.Method = http.MethodGet
+		next := w.opts.redirectLocation(r, rec.code, rec.header)
+		if next == "" || slices.Contains(seen, next) {
+			break
+		}
+
+		location = next
+		seen = append(seen, next)
+	}
+
+	return location
+}
+
+// discardRecorder records the status code, headers and
+// body size of an internally served response, such as a
+// redirect hop, discarding the body.
+type discardRecorder struct {
+	header http.Header
+	code   int
+	size   int64
+}
+
+func (rr *discardRecorder) Header() http.Header {
+	return rr.header
+}
+
+func (rr *discardRecorder) WriteHeader(code int) {
+	if rr.code == 0 {
+		rr.code = code
+	}
+}
 
-func (w closeNotifyRedirectsResponseWriter) CloseNotify() <-chan bool {
-	return w.ResponseWriter.(http.CloseNotifier).CloseNotify()
+func (rr *discardRecorder) Write(p []byte) (int, error) {
+	rr.WriteHeader(http.StatusOK)
+	rr.size += int64(len(p))
+	return len(p), nil
 }
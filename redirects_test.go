@@ -0,0 +1,150 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSameOriginTarget(t *testing.T) {
+	const (
+		plain = iota
+		tlsConn
+		forwarded
+		forwardedUntrusted
+	)
+
+	for _, tc := range []struct {
+		location string
+		conn     int
+		want     string // empty if the location is rejected
+	}{
+		// Relative and same-origin locations are resolved
+		// against https://example.com/dir/page?q.
+		{"/a", tlsConn, "/a"},
+		{"b", tlsConn, "/dir/b"},
+		{"../c?x=1", tlsConn, "/c?x=1"},
+		{"?y", tlsConn, "/dir/page?y"},
+		{"/a#frag", tlsConn, "/a"},
+		{"https://example.com/a", tlsConn, "/a"},
+		{"HTTPS://EXAMPLE.COM/a", tlsConn, "/a"},
+		{"http://example.com/a", plain, "/a"},
+		{"https://example.com/a", forwarded, "/a"},
+
+		// The scheme or host differ.
+		{"http://example.com/a", tlsConn, ""},
+		{"https://example.com/a", plain, ""},
+		{"https://example.com/a", forwardedUntrusted, ""},
+		{"http://example.com/a", forwarded, ""},
+		{"https://example.com:8443/a", tlsConn, ""},
+		{"https://example.org/a", tlsConn, ""},
+		{"https://sub.example.com/a", tlsConn, ""},
+		{"//example.com/a", tlsConn, ""},
+		{"//evil.example/a", tlsConn, ""},
+		{"https:example.com/a", tlsConn, ""},
+
+		// Userinfo and opaque URLs.
+		{"https://user@example.com/a", tlsConn, ""},
+		{"https://example.com@evil.example/a", tlsConn, ""},
+		{"mailto:a@example.com", tlsConn, ""},
+		{"javascript:alert(1)", tlsConn, ""},
+
+		// Ambiguous characters and encodings.
+		{"", tlsConn, ""},
+		{"/\\evil.example/a", tlsConn, ""},
+		{"\\\\evil.example/a", tlsConn, ""},
+		{"/a b", tlsConn, ""},
+		{"/a\tb", tlsConn, ""},
+		{" /a", tlsConn, ""},
+		{"/a\nLocation: /b", tlsConn, ""},
+		{"/a\x7f", tlsConn, ""},
+		{"/%2fevil.example/a", tlsConn, ""},
+		{"/%2Fevil.example/a", tlsConn, ""},
+		{"/%5cevil.example/a", tlsConn, ""},
+		{"/a%00.css", tlsConn, ""},
+		{"/a%zz", tlsConn, ""},
+	} {
+		o := *New(1<<16, 4, nil, nil).opts.Load()
+		o.trustForwardedProto = tc.conn == forwarded
+
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/dir/page?q", nil)
+		switch tc.conn {
+		case tlsConn:
+			r.TLS = new(tls.ConnectionState)
+		case forwarded, forwardedUntrusted:
+			r.Header.Set("X-Forwarded-Proto", "https")
+		}
+
+		if got := o.sameOriginTarget(r, tc.location); got != tc.want {
+			t.Errorf("sameOriginTarget(%q) with connection %d = %q, want %q",
+				tc.location, tc.conn, got, tc.want)
+		}
+	}
+}
+
+func TestFollowRedirects(t *testing.T) {
+	redirects := map[string]string{
+		"/a":     "/b",
+		"/b":     "/c",
+		"/loop":  "/loop2",
+		"/loop2": "/loop",
+		"/away":  "https://example.org/",
+	}
+
+	for _, tc := range []struct {
+		location string
+		depth    int
+		want     string
+		hops     int
+	}{
+		{"/a", 1, "/b", 1},
+		{"/a", 2, "/c", 2},
+		{"/a", 5, "/c", 3},
+		{"/c", 5, "/c", 1},
+		{"/loop", 5, "/loop2", 2},
+		{"/away", 5, "/away", 1},
+	} {
+		var methods []string
+		h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			methods = append(methods, r.Method)
+
+			if loc, ok := redirects[r.URL.Path]; ok {
+				http.Redirect(w, r, loc, http.StatusFound)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+		})
+
+		r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+		r.TLS = new(tls.ConnectionState)
+
+		w := &pushResponseWriter{
+			opts:    New(1<<16, 4, nil, &Options{RedirectDepth: tc.depth}).opts.Load(),
+			req:     r,
+			handler: h,
+		}
+
+		if got := w.followRedirects(tc.location); got != tc.want {
+			t.Errorf("followRedirects(%q) with depth %d = %q, want %q",
+				tc.location, tc.depth, got, tc.want)
+		}
+
+		if len(methods) != tc.hops {
+			t.Errorf("followRedirects(%q) with depth %d served %d hops, want %d",
+				tc.location, tc.depth, len(methods), tc.hops)
+		}
+
+		for _, m := range methods {
+			if m != http.MethodHead {
+				t.Errorf("hop served with %s, want HEAD", m)
+			}
+		}
+	}
+}
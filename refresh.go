@@ -0,0 +1,58 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// refreshSuffix is appended to the name of the filter
+// cookie to name the cookie recording that the filter
+// cookie was recently set.
+const refreshSuffix = "-R"
+
+// refreshCookie sets the filter cookie again, unchanged, if
+// it has not been set within the refresh interval, so that
+// its MaxAge is extended for a client that is pushed
+// nothing.
+func (w *pushResponseWriter) refreshCookie() {
+	if w.opts.cookieRefresh <= 0 || w.isPush || w.opts.insecure(w.req) || w.opts.cookieless(w.req) {
+		return
+	}
+
+	if _, err := w.req.Cookie(w.opts.cookie.Name + refreshSuffix); err == nil {
+		return
+	}
+
+	c, err := w.req.Cookie(w.opts.cookie.Name)
+	if err != nil || c.Value == "" {
+		return
+	}
+
+	if gen, _ := splitGeneration(strings.TrimPrefix(c.Value, noPushPrefix)); gen != w.opts.generation() {
+		return
+	}
+
+	nc := *w.opts.cookie
+	nc.Value = c.Value
+	http.SetCookie(w, &nc)
+
+	w.saveRefreshed()
+}
+
+// saveRefreshed sets the cookie recording that the filter
+// cookie was just set, which expires with the refresh
+// interval.
+func (w *pushResponseWriter) saveRefreshed() {
+	c := *w.opts.cookie
+	c.Name += refreshSuffix
+	c.Value = "1"
+	c.MaxAge = int((w.opts.cookieRefresh + time.Second - 1) / time.Second)
+	c.Expires = time.Time{}
+	http.SetCookie(w, &c)
+}
@@ -0,0 +1,39 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// requestID returns the value of the request ID header for
+// the requests pushed for w: that of the request, or else
+// a new random ID, or one derived from the request in
+// deterministic mode, which is also added to the response so
+// that it can be correlated with them.
+func (w *pushResponseWriter) requestID(name string) []string {
+	if v := w.req.Header[name]; len(v) != 0 {
+		return v
+	}
+
+	var id []string
+	if w.opts.deterministic {
+		id = []string{w.deterministicID()}
+	} else {
+		var b [16]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(err)
+		}
+
+		id = []string{hex.EncodeToString(b[:])}
+	}
+
+	// It only reaches the client if the response headers
+	// have yet to be written.
+	w.Header()[name] = id
+	return id
+}
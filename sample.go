@@ -0,0 +1,140 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// minEffectiveness is the least that a target's weight is
+// scaled by for the pushes of it that were wasted, so that
+// every target is still sampled occasionally.
+const minEffectiveness = 0.1
+
+type sampleCandidate struct {
+	key    string
+	weight float64
+}
+
+// sampleWeight returns the weight of target, which is
+// scaled by the fraction of its pushes that were not
+// wasted if Options.Stats is set.
+func (o *options) sampleWeight(target string, weight float64) float64 {
+	if weight <= 0 {
+		weight = 1
+	}
+
+	if o.stats != nil {
+		weight *= max(1-o.stats.wasteRate(target), minEffectiveness)
+	}
+
+	return weight
+}
+
+// samplePushes chooses which of the targets of links and
+// resources that are not already in the client's filter
+// are pushed, if there are more than Options.MaxPushes.
+// Each is chosen with a probability proportional to its
+// weight, by the method of Efraimidis and Spirakis, so that
+// over many visits every target is pushed.
+func (w *pushResponseWriter) samplePushes(links []string, resources []Resource) {
+	if w.opts.insecure(w.req) || w.isPush {
+		return
+	}
+
+	if w.bloom == nil {
+		w.loadBloomFilter()
+	}
+
+	var candidates []sampleCandidate
+	seen := make(map[string]bool)
+	consider := func(target string, weight float64) {
+		target, ok := w.opts.rewrite(target)
+		if !ok {
+			return
+		}
+
+		clean, ok := cleanTarget(target)
+		if !ok {
+			return
+		}
+
+		key := w.filterKey(clean)
+		if seen[key] || w.cached(clean, key) {
+			return
+		}
+
+		seen[key] = true
+		candidates = append(candidates, sampleCandidate{key, w.opts.sampleWeight(clean, weight)})
+	}
+
+	for _, res := range resources {
+		if !res.NoPush {
+			consider(res.Path, res.Weight)
+		}
+	}
+
+	for _, link := range links {
+		if target, ok := preloadTarget(link); ok && !hasNoPush(link) {
+			consider(target, 0)
+		}
+	}
+
+	if len(candidates) <= w.opts.maxPushes {
+		return
+	}
+
+	random := w.sampleRand()
+
+	keys := make([]float64, len(candidates))
+	for i, c := range candidates {
+		keys[i] = math.Pow(random(), 1/c.weight)
+	}
+
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+
+	slices.SortFunc(order, func(a, b int) int {
+		return cmp.Compare(keys[b], keys[a])
+	})
+
+	w.sample = make(map[string]bool, len(candidates))
+	for i, j := range order {
+		w.sample[candidates[j].key] = i < w.opts.maxPushes
+	}
+}
+
+// overPushLimit reports whether pushing the target with
+// the filter key would exceed Options.MaxPushes, or it was
+// not chosen by samplePushes.
+func (w *pushResponseWriter) overPushLimit(key string) bool {
+	if w.opts.maxPushes <= 0 || w.redirect {
+		return false
+	}
+
+	if chosen, ok := w.sample[key]; ok {
+		return !chosen
+	}
+
+	return w.pushCount >= w.opts.maxPushes
+}
+
+// hasNoPush reports whether a Link header value has the
+// nopush parameter.
+func hasNoPush(link string) bool {
+	_, rest := nextField(link)
+	for field, rest := nextField(rest); field != ""; field, rest = nextField(rest) {
+		if field == "nopush" {
+			return true
+		}
+	}
+
+	return false
+}
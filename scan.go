@@ -0,0 +1,285 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// maxHeldHTML is the most of an HTML response that is
+	// buffered while waiting for the end of its head.
+	maxHeldHTML = 64 << 10
+
+	// maxScanHTML is the most of an HTML response that is
+	// scanned for sub-resources.
+	maxScanHTML = 1 << 20
+
+	sniffLen = 512
+)
+
+// htmlScanner discovers the sub-resources of an HTML
+// response as it is written.
+type htmlScanner struct {
+	// code is the status code of a response whose headers
+	// are being held back until the end of its head has
+	// been scanned. It is zero once they are written.
+	code  int
+	held  []byte
+	sniff bool
+
+	// pending is the input that has not yet been
+	// tokenized and raw is the raw text element, such as
+	// script, that it begins within.
+	pending []byte
+	raw     string
+	scanned int
+
+	seen map[string]bool
+}
+
+func isHTML(contentType string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(contentType)), "text/html")
+}
+
+// holdForScan begins scanning the response if it is HTML,
+// holding back its headers so that the stylesheets and
+// scripts in its head can be pushed along with its Link
+// headers.
+func (w *pushResponseWriter) holdForScan(code int) bool {
+	if !w.opts.scanHTML || code < 200 || code >= 300 || code == http.StatusNoContent ||
+		w.req.Method == http.MethodHead || w.result.disabled || w.isPush {
+		return false
+	}
+
+	h := w.Header()
+	ct := h.Get("Content-Type")
+	if ct != "" && !isHTML(ct) || h.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	w.wroteHeader = true
+	w.scan = &htmlScanner{
+		code:  code,
+		sniff: ct == "",
+	}
+	return true
+}
+
+func (w *pushResponseWriter) writeScanned(p []byte) (int, error) {
+	s := w.scan
+
+	if s.code == 0 {
+		s.tokenize(w.opts, w.req, p, w.pushDiscovered)
+		return w.ResponseWriter.Write(p)
+	}
+
+	n := len(p)
+	s.held = append(s.held, p...)
+
+	if s.sniff {
+		// Without a Content-Type, the response is sniffed
+		// as net/http would, from its first 512 bytes.
+		if len(s.held) < sniffLen {
+			return n, nil
+		}
+
+		if !w.sniffHTML() {
+			if err := w.release(); err != nil {
+				return 0, err
+			}
+
+			return n, nil
+		}
+
+		// Everything held so far is scanned once it is
+		// known to be HTML.
+		p = s.held
+	}
+
+	if s.tokenize(w.opts, w.req, p, w.addDiscovered) || len(s.held) > maxHeldHTML {
+		if err := w.release(); err != nil {
+			return 0, err
+		}
+	}
+
+	return n, nil
+}
+
+// sniffHTML reports whether the held response is HTML,
+// setting its Content-Type if it is and stopping scanning
+// if it is not.
+func (w *pushResponseWriter) sniffHTML() bool {
+	s := w.scan
+	s.sniff = false
+
+	if ct := http.DetectContentType(s.held); isHTML(ct) {
+		w.Header().Set("Content-Type", ct)
+		return true
+	}
+
+	s.scanned = maxScanHTML
+	return false
+}
+
+// release writes the held headers and body.
+func (w *pushResponseWriter) release() error {
+	s := w.scan
+	if s.code == 0 {
+		return nil
+	}
+
+	if s.sniff && w.sniffHTML() {
+		s.tokenize(w.opts, w.req, s.held, w.addDiscovered)
+	}
+
+	code, held := s.code, s.held
+	s.code, s.held = 0, nil
+
+	w.wroteHeader = false
+	w.writeHeader(code)
+
+	if len(held) == 0 {
+		return nil
+	}
+
+	_, err := w.ResponseWriter.Write(held)
+	return err
+}
+
+// addDiscovered adds a preload Link header for a resource
+// found while the headers are held, so that it is pushed,
+// filtered and recorded with the other links.
+func (w *pushResponseWriter) addDiscovered(target, as string) {
+	Preload(target).As(as).Add(w)
+}
+
+// pushDiscovered pushes a resource found after the
+// headers have been written. The push is deduplicated by
+// the bloom filter, but can no longer be recorded in the
+// cookie.
+func (w *pushResponseWriter) pushDiscovered(target, as string) {
+	_, err := w.pushTarget(target, w.pushOptions())
+	if err == http.ErrNotSupported {
+		w.scan.scanned = maxScanHTML
+	} else if err != nil {
+		w.opts.logError(w.req, "error pushing resource", err, slog.String("target", target))
+	}
+}
+
+// tokenize scans p for sub-resources, calling found for
+// each new one. It reports whether the end of the head
+// was reached.
+func (s *htmlScanner) tokenize(o *options, r *http.Request, p []byte, found func(target, as string)) (headDone bool) {
+	if s.scanned >= maxScanHTML {
+		s.pending = nil
+		return false
+	}
+
+	s.scanned += len(p)
+	s.pending = append(s.pending, p...)
+
+	z := html.NewTokenizerFragment(bytes.NewReader(s.pending), s.raw)
+
+	var n int
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// The remainder is an incomplete tag.
+			break
+		}
+
+		raw := len(z.Raw())
+		if n+raw == len(s.pending) && (tt == html.TextToken || tt == html.CommentToken) {
+			// Text may be continued by the next write.
+			break
+		}
+
+		n += raw
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+
+			switch tok.Data {
+			case "body":
+				headDone = true
+			case "iframe", "noembed", "noframes", "noscript", "plaintext",
+				"script", "style", "textarea", "title", "xmp":
+				s.raw = tok.Data
+			}
+
+			href, as := tagResource(tok)
+			if target := o.sameOriginTarget(r, href); target != "" && !s.seen[target] {
+				if s.seen == nil {
+					s.seen = make(map[string]bool)
+				}
+
+				s.seen[target] = true
+				found(target, as)
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+
+			switch string(name) {
+			case "head":
+				headDone = true
+			case s.raw:
+				s.raw = ""
+			}
+		}
+	}
+
+	s.pending = append(s.pending[:0], s.pending[n:]...)
+	return headDone
+}
+
+// tagResource returns the URL and destination of a
+// stylesheet, preload or script tag.
+func tagResource(tok html.Token) (href, as string) {
+	var rel string
+	for _, attr := range tok.Attr {
+		switch attr.Key {
+		case "href", "src":
+			href = attr.Val
+		case "rel":
+			rel = strings.ToLower(attr.Val)
+		case "as":
+			as = strings.ToLower(attr.Val)
+		}
+	}
+
+	switch tok.Data {
+	case "link":
+		rels := strings.Fields(rel)
+		switch {
+		case slices.Contains(rels, "stylesheet") && !slices.Contains(rels, "alternate"):
+			as = "style"
+		case slices.Contains(rels, "modulepreload"):
+			as = "script"
+		case slices.Contains(rels, "preload") && as != "":
+		default:
+			return "", ""
+		}
+	case "script":
+		as = "script"
+	default:
+		return "", ""
+	}
+
+	return href, as
+}
+
+// writerOnly hides the ReadFrom method of a writer from
+// io.Copy.
+type writerOnly struct{ io.Writer }
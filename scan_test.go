@@ -0,0 +1,135 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// scanChunks tokenizes each chunk in turn as separate writes
+// of a response, returning the sub-resources found, as
+// target=as, and whether the end of the head was reached.
+func scanChunks(chunks ...string) (found []string, headDone bool) {
+	o := New(1<<16, 4, nil, nil).opts.Load()
+
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/dir/", nil)
+	r.TLS = new(tls.ConnectionState)
+
+	var s htmlScanner
+	for _, p := range chunks {
+		if s.tokenize(o, r, []byte(p), func(target, as string) {
+			found = append(found, target+"="+as)
+		}) {
+			headDone = true
+		}
+	}
+
+	return found, headDone
+}
+
+func TestScanHTML(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		doc      string
+		found    []string
+		headDone bool
+	}{
+		{"stylesheet",
+			`<link rel=stylesheet href=/a.css>`,
+			[]string{"/a.css=style"}, false},
+		{"relative script",
+			`<script src="b.js"></script>`,
+			[]string{"/dir/b.js=script"}, false},
+		{"preload and modulepreload",
+			`<link rel=preload as=font href=/f.woff2><link rel=modulepreload href=/m.js>`,
+			[]string{"/f.woff2=font", "/m.js=script"}, false},
+		{"ignored links",
+			`<link rel="alternate stylesheet" href=/alt.css><link rel=preload href=/no-as><link rel=icon href=/i.png>`,
+			nil, false},
+		{"inline script", `<script>var a = 1;</script>`, nil, false},
+		{"cross-origin",
+			`<script src="https://cdn.example/a.js"></script><link rel=stylesheet href=//cdn.example/a.css>`,
+			nil, false},
+		{"duplicates",
+			`<link rel=stylesheet href=/a.css><link rel=stylesheet href="/dir/../a.css">`,
+			[]string{"/a.css=style"}, false},
+		{"raw text",
+			`<script>document.write('<link rel=stylesheet href=/x.css>')</script><link rel=stylesheet href=/a.css>`,
+			[]string{"/a.css=style"}, false},
+		{"title",
+			`<title><script src=/x.js></script></title><script src=/a.js></script>`,
+			[]string{"/a.js=script"}, false},
+		{"comment",
+			`<!-- <link rel=stylesheet href=/x.css> --><link rel=stylesheet href=/a.css>`,
+			[]string{"/a.css=style"}, false},
+		{"end of head",
+			`<head><link rel=stylesheet href=/a.css></head><script src=/b.js></script>`,
+			[]string{"/a.css=style", "/b.js=script"}, true},
+		{"body",
+			`<link rel=stylesheet href=/a.css><body>`,
+			[]string{"/a.css=style"}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// The document is split in two at every offset,
+			// and then written a byte at a time, so that
+			// tokens span writes.
+			for i := 0; i <= len(tc.doc); i++ {
+				found, headDone := scanChunks(tc.doc[:i], tc.doc[i:])
+				if !slices.Equal(found, tc.found) || headDone != tc.headDone {
+					t.Errorf("split at %d: found %q, head done %t, want %q, %t",
+						i, found, headDone, tc.found, tc.headDone)
+				}
+			}
+
+			found, headDone := scanChunks(strings.Split(tc.doc, "")...)
+			if !slices.Equal(found, tc.found) || headDone != tc.headDone {
+				t.Errorf("byte at a time: found %q, head done %t, want %q, %t",
+					found, headDone, tc.found, tc.headDone)
+			}
+		})
+	}
+}
+
+func TestScanHTMLLimit(t *testing.T) {
+	const link = `<link rel=stylesheet href=/a.css>`
+
+	for _, tc := range []struct {
+		name   string
+		chunks []string
+		found  []string
+	}{
+		{"under limit",
+			[]string{strings.Repeat(" ", maxScanHTML-1), link},
+			[]string{"/a.css=style"}},
+		{"at limit",
+			[]string{strings.Repeat(" ", maxScanHTML), link},
+			nil},
+		// The limit is checked before each write, so a tag
+		// completed by a write after it is not found, but a
+		// single write is scanned in full.
+		{"tag split across limit",
+			[]string{strings.Repeat(" ", maxScanHTML-10) + link[:20], link[20:]},
+			nil},
+		{"over limit in one write",
+			[]string{strings.Repeat(" ", 2*maxScanHTML) + link},
+			[]string{"/a.css=style"}},
+		{"after long write",
+			[]string{strings.Repeat(" ", 2*maxScanHTML), link},
+			nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			found, _ := scanChunks(tc.chunks...)
+			if !slices.Equal(found, tc.found) {
+				t.Errorf("found %q, want %q", found, tc.found)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"net/textproto"
+)
+
+// headerPolicy decides which headers may be sent on pushed
+// requests.
+type headerPolicy struct {
+	allow, deny map[string]struct{}
+}
+
+func headerSet(names []string) map[string]struct{} {
+	if names == nil {
+		return nil
+	}
+
+	set := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		set[textproto.CanonicalMIMEHeaderKey(name)] = struct{}{}
+	}
+
+	return set
+}
+
+func newHeaderPolicy(allow, deny []string) *headerPolicy {
+	if allow == nil && deny == nil {
+		return nil
+	}
+
+	return &headerPolicy{
+		allow: headerSet(allow),
+		deny:  headerSet(deny),
+	}
+}
+
+func (p *headerPolicy) allowed(name string) bool {
+	if p == nil {
+		return true
+	}
+
+	if _, ok := p.deny[name]; ok {
+		return false
+	}
+
+	if p.allow == nil {
+		return true
+	}
+
+	_, ok := p.allow[name]
+	return ok
+}
+
+func (p *headerPolicy) filterNames(names []string) []string {
+	if p == nil {
+		return names
+	}
+
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		if p.allowed(name) {
+			out = append(out, name)
+		}
+	}
+
+	return out
+}
+
+func (p *headerPolicy) filterHeader(h http.Header) http.Header {
+	if p == nil || h == nil {
+		return h
+	}
+
+	out := make(http.Header, len(h))
+	for k, v := range h {
+		if p.allowed(textproto.CanonicalMIMEHeaderKey(k)) {
+			out[k] = v
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,306 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pendingPushTTL is how long a promised push is waited for
+// before it is forgotten, as when the client resets the
+// pushed stream before it is served.
+const pendingPushTTL = 30 * time.Second
+
+// pendingKey identifies a promised push: the connection it
+// was promised on, by the remote address of the request
+// that promised it, and the nonce sent in the sentinel
+// header of the pushed request.
+type pendingKey struct {
+	sentinel   string
+	remoteAddr string
+	nonce      string
+}
+
+// pushNonce numbers the pushes made by this process, and
+// noncePrefix, which is random, is prepended to the number
+// so that the nonces of pushes promised to other clients
+// cannot be guessed.
+var (
+	pushNonce   atomic.Uint64
+	noncePrefix = func() string {
+		var b [8]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(err)
+		}
+
+		return hex.EncodeToString(b[:])
+	}()
+)
+
+type pendingPush struct {
+	n  int
+	at time.Time
+}
+
+// pendingPushes records the pushes promised by this
+// process that have yet to be served. The headers of a
+// pushed request are visible to the client in the
+// PUSH_PROMISE frame, so the nonce in its sentinel header
+// is claimed when the pushed request is served, and a copy
+// sent by the client is not mistaken for a push.
+var pendingPushes pushRegistry
+
+type pushRegistry struct {
+	mu      sync.Mutex
+	pending map[pendingKey]pendingPush
+	swept   time.Time
+}
+
+// promise records a push that is about to be made. It is
+// called before the push, as the pushed request may be
+// served before http.Pusher.Push returns.
+func (pr *pushRegistry) promise(k pendingKey) {
+	now := time.Now()
+
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	if pr.pending == nil {
+		pr.pending = make(map[pendingKey]pendingPush)
+	}
+
+	if now.Sub(pr.swept) > pendingPushTTL {
+		for k, p := range pr.pending {
+			if now.Sub(p.at) > pendingPushTTL {
+				delete(pr.pending, k)
+			}
+		}
+
+		pr.swept = now
+	}
+
+	p := pr.pending[k]
+	pr.pending[k] = pendingPush{p.n + 1, now}
+}
+
+// claim removes a push promised for k, reporting whether
+// there was one.
+func (pr *pushRegistry) claim(k pendingKey) bool {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	p, ok := pr.pending[k]
+	if !ok || time.Since(p.at) > pendingPushTTL {
+		return false
+	}
+
+	if p.n--; p.n == 0 {
+		delete(pr.pending, k)
+	} else {
+		pr.pending[k] = p
+	}
+
+	return true
+}
+
+// cancel removes a push promised for k that failed.
+func (pr *pushRegistry) cancel(k pendingKey) {
+	pr.claim(k)
+}
+
+// has reports whether a push is promised for k.
+func (pr *pushRegistry) has(k pendingKey) bool {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	p, ok := pr.pending[k]
+	return ok && time.Since(p.at) <= pendingPushTTL
+}
+
+// Sentinel identifies requests pushed by a handler using
+// a particular sentinel header name.
+type Sentinel struct{ name string }
+
+// DefaultSentinel is the Sentinel used by handlers that
+// don't set Options.SentinelHeader.
+var DefaultSentinel = NewSentinel("X-H2-Push")
+
+// NewSentinel returns a Sentinel for the named header. It
+// matches requests pushed by a handler with the same
+// Options.SentinelHeader.
+func NewSentinel(name string) Sentinel {
+	return Sentinel{textproto.CanonicalMIMEHeaderKey(name)}
+}
+
+// Name returns the canonical name of the sentinel header.
+func (s Sentinel) Name() string {
+	return s.name
+}
+
+type isPushKey struct{ name string }
+
+// promise returns a copy of opts with a new nonce in the
+// sentinel header, recording the push as promised in
+// response to r.
+func (s Sentinel) promise(r *http.Request, opts *http.PushOptions) (*http.PushOptions, pendingKey) {
+	var po http.PushOptions
+	if opts != nil {
+		po = *opts
+	}
+
+	k := pendingKey{s.name, r.RemoteAddr, noncePrefix + strconv.FormatUint(pushNonce.Add(1), 36)}
+
+	h := make(http.Header, len(po.Header)+1)
+	for name, v := range po.Header {
+		h[name] = v
+	}
+
+	h[s.name] = []string{k.nonce}
+	po.Header = h
+
+	pendingPushes.promise(k)
+	return &po, k
+}
+
+// received returns the key that r has if it was pushed,
+// or false if it has no nonce.
+func (s Sentinel) received(r *http.Request) (pendingKey, bool) {
+	v := r.Header[s.name]
+	if len(v) != 1 {
+		return pendingKey{}, false
+	}
+
+	return pendingKey{s.name, r.RemoteAddr, v[0]}, true
+}
+
+// mark returns r with whether it was pushed by a handler
+// using s recorded in its context, claiming the push that
+// was promised for it. A sentinel header sent by the
+// client is removed.
+func (s Sentinel) mark(r *http.Request) (*http.Request, bool) {
+	if isPush, ok := r.Context().Value(isPushKey{s.name}).(bool); ok {
+		return r, isPush
+	}
+
+	k, isPush := s.received(r)
+	isPush = isPush && pendingPushes.claim(k)
+
+	if _, ok := r.Header[s.name]; ok {
+		r = r.Clone(r.Context())
+		r.Header.Del(s.name)
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), isPushKey{s.name}, isPush)), isPush
+}
+
+// IsPush returns true iff the request was pushed by a
+// handler using this sentinel.
+func (s Sentinel) IsPush(r *http.Request) bool {
+	if isPush, ok := r.Context().Value(isPushKey{s.name}).(bool); ok {
+		return isPush
+	}
+
+	k, ok := s.received(r)
+	return ok && pendingPushes.has(k)
+}
+
+// MarkPushes is like the package level MarkPushes but for
+// this sentinel.
+func (s Sentinel) MarkPushes(h http.Handler) Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, _ = s.mark(r)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Forward wraps the given http.Handler, such as a reverse
+// proxy to a trusted upstream, so that the sentinel header
+// is set on the requests that reach it if, and only if,
+// they were pushed. The upstream recognises them with
+// TrustForwarded.
+func (s Sentinel) Forward(h http.Handler) Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		isPush := s.IsPush(r)
+		if _, ok := r.Header[s.name]; ok || isPush {
+			r = r.Clone(r.Context())
+			r.Header.Del(s.name)
+		}
+
+		if isPush {
+			r.Header.Set(s.name, "1")
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// TrustForwarded wraps the given http.Handler so that a
+// request with the sentinel header is taken to have been
+// pushed, with the header removed and the signal carried
+// by the request context. It is for upstream servers that
+// are only reachable through a server that uses Forward,
+// which removes any sentinel header sent by a client, and
+// must not be exposed to clients directly.
+func (s Sentinel) TrustForwarded(h http.Handler) Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, isPush := r.Header[s.name]
+		if isPush {
+			r = r.Clone(r.Context())
+			r.Header.Del(s.name)
+		}
+
+		ctx := context.WithValue(r.Context(), isPushKey{s.name}, isPush)
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// IsPush returns true iff the request was pushed by this
+// package using the default sentinel.
+//
+// Pushed requests carry a nonce in the sentinel header
+// that is only accepted once, on the connection the push
+// was promised on, so a header copied by the client from
+// a PUSH_PROMISE is not mistaken for a push. The push
+// handler and MarkPushes claim the nonce, remove the
+// header and record the signal in the request context.
+// Behind a reverse proxy, use Forward in front of the
+// proxy and TrustForwarded on the upstream.
+func IsPush(r *http.Request) bool {
+	return DefaultSentinel.IsPush(r)
+}
+
+// MarkPushes wraps the given http.Handler so that whether
+// each request was pushed is recorded in its context, and
+// the sentinel header is removed. Handlers then see the
+// same headers for pushed requests as the push handler
+// sent, and a sentinel header sent by a client is
+// discarded. IsPush continues to work as before.
+//
+// It should wrap the whole server, outside of the push
+// handler.
+func MarkPushes(h http.Handler) Handler {
+	return DefaultSentinel.MarkPushes(h)
+}
+
+// Forward is like Sentinel.Forward for the default
+// sentinel.
+func Forward(h http.Handler) Handler {
+	return DefaultSentinel.Forward(h)
+}
+
+// TrustForwarded is like Sentinel.TrustForwarded for the
+// default sentinel.
+func TrustForwarded(h http.Handler) Handler {
+	return DefaultSentinel.TrustForwarded(h)
+}
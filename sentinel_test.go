@@ -0,0 +1,152 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSentinelNonce(t *testing.T) {
+	s := NewSentinel("X-Test-Push")
+
+	for _, tc := range []struct {
+		name string
+		// pushed modifies the request made for the push
+		// promised in response to a request from
+		// 192.0.2.1:1234, or is nil to leave it as is.
+		pushed func(r *http.Request)
+		// before runs before the pushed request is served.
+		before func(k pendingKey)
+		isPush bool
+	}{
+		{"issued", nil, nil, true},
+		{"other connection", func(r *http.Request) {
+			r.RemoteAddr = "192.0.2.1:5678"
+		}, nil, false},
+		{"other nonce", func(r *http.Request) {
+			r.Header.Set("X-Test-Push", noncePrefix+"guess")
+		}, nil, false},
+		{"repeated header", func(r *http.Request) {
+			r.Header.Add("X-Test-Push", "1")
+		}, nil, false},
+		{"no header", func(r *http.Request) {
+			r.Header.Del("X-Test-Push")
+		}, nil, false},
+		{"cancelled", nil, pendingPushes.cancel, false},
+		{"expired", nil, func(k pendingKey) {
+			pendingPushes.mu.Lock()
+			p := pendingPushes.pending[k]
+			p.at = time.Now().Add(-pendingPushTTL - time.Second)
+			pendingPushes.pending[k] = p
+			pendingPushes.mu.Unlock()
+		}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+
+			po, k := s.promise(r, &http.PushOptions{
+				Header: http.Header{"Accept": {"text/css"}},
+			})
+			defer pendingPushes.cancel(k)
+
+			if got := po.Header.Get("Accept"); got != "text/css" {
+				t.Errorf("promise dropped header: Accept = %q", got)
+			}
+
+			pr := httptest.NewRequest(http.MethodGet, "https://example.com/a.css", nil)
+			pr.RemoteAddr = r.RemoteAddr
+			for name, v := range po.Header {
+				pr.Header[name] = append([]string(nil), v...)
+			}
+
+			if tc.pushed != nil {
+				tc.pushed(pr)
+			}
+
+			if tc.before != nil {
+				tc.before(k)
+			}
+
+			if got := s.IsPush(pr); got != tc.isPush {
+				t.Errorf("IsPush before mark = %t, want %t", got, tc.isPush)
+			}
+
+			mr, isPush := s.mark(pr)
+			if isPush != tc.isPush {
+				t.Errorf("mark = %t, want %t", isPush, tc.isPush)
+			}
+
+			if _, ok := mr.Header["X-Test-Push"]; ok {
+				t.Error("mark left the sentinel header")
+			}
+
+			if got := s.IsPush(mr); got != tc.isPush {
+				t.Errorf("IsPush after mark = %t, want %t", got, tc.isPush)
+			}
+
+			// The nonce is single use: a second request with
+			// the same header, as a client copying it from the
+			// PUSH_PROMISE would send, is not a push.
+			if _, again := s.mark(pr); again {
+				t.Error("nonce was accepted twice")
+			}
+		})
+	}
+}
+
+func TestSentinelNonceUnique(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		_, k := DefaultSentinel.promise(r, nil)
+		pendingPushes.cancel(k)
+
+		if seen[k.nonce] {
+			t.Fatalf("nonce %q issued twice", k.nonce)
+		}
+
+		seen[k.nonce] = true
+	}
+}
+
+func TestSentinelTrustForwarded(t *testing.T) {
+	s := NewSentinel("X-Test-Push")
+
+	for _, tc := range []struct {
+		name   string
+		header http.Header
+		isPush bool
+	}{
+		{"pushed", http.Header{"X-Test-Push": {"1"}}, true},
+		{"not pushed", nil, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+			for name, v := range tc.header {
+				r.Header[name] = v
+			}
+
+			var got, sawHeader bool
+			s.TrustForwarded(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = s.IsPush(r)
+				_, sawHeader = r.Header["X-Test-Push"]
+			})).ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tc.isPush {
+				t.Errorf("IsPush = %t, want %t", got, tc.isPush)
+			}
+
+			if sawHeader {
+				t.Error("TrustForwarded left the sentinel header")
+			}
+		})
+	}
+}
@@ -6,78 +6,403 @@
 package serverpush
 
 import (
-	"bytes"
-	"compress/flate"
-	"encoding/base64"
+	"bufio"
+	"context"
+	"expvar"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/textproto"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unicode"
 
 	"github.com/golang/gddo/httputil/header"
-	"github.com/tmthrgd/httputils"
 	"github.com/willf/bloom"
 )
 
-var (
-	flateReaderPool sync.Pool
-	flateWriterPool sync.Pool
-
-	bufferPool = &sync.Pool{
-		New: func() interface{} {
-			return new(bytes.Buffer)
-		},
-	}
-)
-
 type options struct {
-	m, k        uint
-	cookie      *http.Cookie
+	m, k   uint
+	cookie *http.Cookie
+
+	// pushOptions are the PushOptions of the handler. Its
+	// Header has been filtered by headerPolicy, and is
+	// shared by pushed requests that proxy no headers. The
+	// sentinel header is added to each push by
+	// Sentinel.promise.
 	pushOptions http.PushOptions
+	sentinel    Sentinel
+
+	proxyHeaders    []string
+	headerPolicy    *headerPolicy
+	requestIDHeader string
+
+	vars  *expvar.Map
+	hooks *Hooks
+
+	pushedTargets, filteredTargets *expvar.Map
+
+	stats *Stats
+
+	serverTiming bool
+
+	pushedCountHeader string
+
+	vary string
+
+	logger       *slog.Logger
+	errorLog     Logger
+	errorHandler func(r *http.Request, err error)
+	limiter      *logLimiter
+
+	accessLog *accessLog
+
+	events *eventHub
+
+	disabled      bool
+	supportsPush  func(*http.Request) bool
+	allowInsecure bool
+
+	trustForwardedProto bool
+
+	respectPrivacySignals bool
+
+	minThroughput float64
+
+	rememberNoPush bool
+	cacheDigest    bool
+
+	deterministic bool
+
+	skipServiceWorker   bool
+	serviceWorkerHeader string
+	serviceWorkerCookie string
+
+	pushRedirects bool
+
+	// redirectsOnly is set for handlers returned by
+	// NewRedirects, which ignore Link headers.
+	redirectsOnly   bool
+	redirectCodes   []int
+	redirectMethods []string
+	redirectFilter  func(r *http.Request, code int, location string) bool
+	redirectDepth   int
+
+	manifest     *Manifest
+	pushManifest bool
+
+	firstVisit, repeatVisit VisitPolicy
+
+	shadow *Shadow
+
+	blocklist *Blocklist
+
+	redirectEarlyHints bool
+
+	clock Clock
+
+	observeOnly bool
+
+	fallback     Fallback
+	fallbackFunc func(w http.ResponseWriter, r *http.Request, links []string)
+
+	http3EarlyHints bool
+
+	compactCookie  bool
+	exactThreshold int
+
+	shareConnFilter bool
+
+	filterStore FilterStore
+	storeKey    func(r *http.Request) string
+
+	maxCookieSize  int
+	classifyFilter func(r *http.Request) (m, k uint)
+
+	sortQuery  bool
+	stripQuery []string
+
+	rewriteTarget func(string) (string, bool)
+
+	partitionBySite bool
+
+	ttlBucket  time.Duration
+	ttlBuckets int
+	targetTTL  func(target string) time.Duration
+
+	edgePush     bool
+	edgeAnnotate func(link string) string
+
+	learner      *Learner
+	learnerState io.Writer
+
+	scanHTML bool
+
+	resetOnAssetChange bool
+
+	pushBudget     int64
+	maxPushes      int
+	samplePushes   bool
+	pushTimeBudget time.Duration
+	smallestFirst  bool
+
+	wasteWindow time.Duration
+
+	cookieRefresh time.Duration
+
+	pushRanges bool
+
+	meta *metaCache
+
+	pushTimeout time.Duration
+
+	// src is the Options the options were created from.
+	src Options
 }
 
 type pushResponseWriter struct {
 	http.ResponseWriter
 	req *http.Request
 
+	handler http.Handler
+
 	opts *options
 
+	// isPush is set when the request was itself pushed. Its
+	// response neither pushes nor sets the cookie, which
+	// is left to the response that pushed it.
+	isPush bool
+
 	bloom *bloom.BloomFilter
+	dirty bool
+
+	// filterWords, if non-nil, holds the bits of bloom and
+	// is returned to filterPool by releaseFilter.
+	filterWords *filterWords
+
+	// conn is the filter shared by the requests of the
+	// connection, if ShareConnFilter is set.
+	conn *sharedFilter
+
+	// exact holds the locations of the targets in the
+	// filter while exactMode is set. See
+	// Options.ExactThreshold.
+	exact     []uint64
+	exactMode bool
+
+	// pushStart is when the handler began pushing the
+	// targets of the response, and overTime is set once
+	// Options.PushTimeBudget is spent.
+	pushStart time.Time
+	overTime  bool
+
+	// pushCount is the number of targets pushed for the
+	// response, and sample holds whether each was chosen
+	// by samplePushes. See Options.MaxPushes.
+	pushCount int
+	sample    map[string]bool
+
+	// bodyStart is when the response headers were written,
+	// from which the body is timed. See ConnThroughput.
+	bodyStart time.Time
+
+	// pushDisabled is set if the client has disabled push,
+	// as recorded in its cookie or found by noPushFound on
+	// this request. See Options.RememberNoPush.
+	pushDisabled bool
+	noPushFound  bool
+
+	// digests holds the Cache-Digest header of the request
+	// once parsed. See Options.CacheDigest.
+	digests       []cacheDigest
+	digestsParsed bool
+
+	// siteCleared holds the kinds of data cleared by the
+	// Clear-Site-Data header of the response.
+	siteCleared uint8
+
+	// buckets holds a filter for each Options.TTLBucket
+	// interval, from that with index bucket back, of
+	// which bloom is the union.
+	buckets []*bloom.BloomFilter
+	bucket  int64
+
+	result *Result
+	trace  *PushTrace
+
+	// redirect is set while the Location of a redirect is
+	// being pushed.
+	redirect bool
+
+	scan *htmlScanner
+
+	// pushedBytes is the total Size of the Manifest
+	// resources pushed.
+	pushedBytes int64
+
+	// pushOpts is returned by pushOptions once its Header
+	// is set. If pooled is true, the Header was taken from
+	// headerPool and is returned to it by releaseHeader.
+	pushOpts http.PushOptions
+	pooled   bool
+
+	// edgePushed holds the links of the Manifest resources
+	// marked for the edge to push in edge push mode.
+	edgePushed []string
+
+	// code is the status of the response and written the
+	// number of bytes of its body written by the handler.
+	code    int
+	written int64
+
+	// started is when the handler began serving the
+	// response, by the clock of the options, if
+	// Options.PushTimeout is set.
+	started time.Time
 
 	wroteHeader bool
 }
 
 func (w *pushResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader && isInformational(code) {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	if !w.wroteHeader && w.holdForScan(code) {
+		return
+	}
+
+	w.writeHeader(code)
+
+	if w.bodyStart.IsZero() {
+		w.bodyStart = w.opts.clock.Now()
+	}
+}
+
+func (w *pushResponseWriter) writeHeader(code int) {
 	wroteHeader := w.wroteHeader
 	w.wroteHeader = true
 
-	if wroteHeader || code == http.StatusNotModified {
+	if !wroteHeader {
+		w.code = code
+		takeNoPushRedirect(w.Header(), w.result)
+	}
+
+	if wroteHeader {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	if code == http.StatusNotModified {
+		w.refreshCookie()
 		w.ResponseWriter.WriteHeader(code)
 		return
 	}
 
 	h := w.Header()
-	links := header.ParseList(h, "Link")
 
-	if len(links) == 0 {
+	if !w.isPush {
+		w.clearSiteData(h)
+	}
+
+	var links []string
+	if !w.opts.redirectsOnly {
+		links = header.ParseList(h, "Link")
+	}
+
+	var location string
+	if w.opts.pushRedirects && !w.opts.edgePush && !w.result.noPushRedirect {
+		location = w.opts.redirectLocation(w.req, code, h)
+	}
+
+	var resources []Resource
+	if (w.opts.pushManifest || w.opts.manifest != nil && w.opts.visitPolicy(w.req) == VisitPushManifest) &&
+		code >= 200 && code < 300 {
+		resources = w.opts.manifest.Lookup(w.req.URL.Path)
+	}
+
+	if len(links) == 0 && location == "" && len(resources) == 0 && len(w.edgePushed) == 0 ||
+		w.result.disabled || w.isPush || code == http.StatusPartialContent && !w.opts.pushRanges {
+		w.saveIfDirty()
 		w.ResponseWriter.WriteHeader(code)
 		return
 	}
 
-	opts := w.opts.pushOptions
-	opts.Header = headers(&opts, w.req)
+	if w.opts.vary != "" {
+		addVary(h, w.opts.vary)
+	}
+
+	if len(links) != 0 && w.trace != nil && w.trace.GotLinks != nil {
+		w.trace.GotLinks(links)
+	}
+
+	start := w.opts.clock.Now()
+	w.pushStart = start
+
+	opts := w.pushOptions()
+
+	if w.opts.samplePushes {
+		w.samplePushes(links, resources)
+	}
+
+	var count int
+	if location != "" {
+		if w.opts.redirectDepth > 0 {
+			location = w.followRedirects(location)
+		}
+
+		w.redirect = true
+		didPush, err := w.pushTarget(location, opts)
+		w.redirect = false
+
+		if err == http.ErrNotSupported && w.opts.redirectEarlyHints {
+			w.earlyHints([]string{Preload(location).As("document").String()})
+		} else if err != nil && err != http.ErrNotSupported {
+			w.opts.logError(w.req, "error pushing resource", err, slog.String("location", location))
+		}
+
+		if didPush {
+			count++
+		}
 
+		if err == nil && w.opts.manifest != nil {
+			count += w.pushResources(w.opts.manifest.Lookup(locationPath(location)), opts)
+		}
+	}
+
+	if len(resources) != 0 {
+		count += w.pushResources(resources, opts)
+	}
+
+	// Links are pushed, and kept in the Link header, in
+	// the order of their fetchpriority hints.
+	sortLinks(links)
+
+	var shadowLinks []string
+	if w.opts.shadow != nil {
+		shadowLinks = slices.Clone(links)
+	}
+
+	// rest shares the array of links, which it never
+	// overtakes, so the links left when push turns out to
+	// be unsupported are moved down after those kept.
 	rest := links[:0]
 	var pushed []string
+	var notSupported bool
 
-	for _, link := range links {
-		didPush, err := w.pushLink(&opts, link)
+	for i, link := range links {
+		didPush, err := w.pushLink(opts, link)
 		if err == http.ErrNotSupported {
-			rest = links
+			rest, notSupported = append(rest, links[i:]...), true
 			break
 		} else if err != nil {
-			httputils.RequestLogf(w.req, "go-server-push: error pushing link %q: %#v", link, err)
+			w.opts.logError(w.req, "error pushing link", err, slog.String("link", link))
 		}
 
 		if didPush {
@@ -87,46 +412,142 @@ func (w *pushResponseWriter) WriteHeader(code int) {
 		}
 	}
 
-	h["Link"] = rest
-	h[pushedHeader] = pushed
+	if w.opts.shadow != nil {
+		w.evaluateShadow(code, shadowLinks)
+	}
+
+	w.saveIfDirty()
 
-	if len(pushed) != 0 {
-		if err := w.saveBloomFilter(); err != nil {
-			httputils.RequestLogf(w.req, "go-server-push: error saving bloom filter: %#v", err)
+	if w.opts.accessLog != nil {
+		if err := w.opts.accessLog.log(w.req, w.result.Events, w.opts.clock.Now()); err != nil {
+			w.opts.logError(w.req, "error writing access log", err)
 		}
 	}
 
+	if w.opts.observeOnly {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	if w.opts.edgePush {
+		h["Link"] = w.edgeLinks(pushed, rest)
+		count += len(pushed)
+	} else if !w.opts.redirectsOnly {
+		h["Link"] = rest
+		h[pushedHeader] = pushed
+		count += len(pushed)
+	}
+
+	if notSupported {
+		w.fallback(rest)
+	}
+
+	if w.opts.pushedCountHeader != "" {
+		h.Set(w.opts.pushedCountHeader, strconv.Itoa(count))
+	}
+
+	if w.opts.serverTiming {
+		h.Add("Server-Timing", serverTiming(count, w.opts.clock.Now().Sub(start)))
+	}
+
 	w.ResponseWriter.WriteHeader(code)
 }
 
+func (w *pushResponseWriter) Write(p []byte) (n int, err error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.scan != nil {
+		n, err = w.writeScanned(p)
+	} else {
+		n, err = w.ResponseWriter.Write(p)
+	}
+
+	w.written += int64(n)
+	return n, err
+}
+
 func (w *pushResponseWriter) WriteString(s string) (n int, err error) {
-	return io.WriteString(w.ResponseWriter, s)
+	if !w.wroteHeader || w.scan != nil {
+		return w.Write([]byte(s))
+	}
+
+	n, err = io.WriteString(w.ResponseWriter, s)
+	w.written += int64(n)
+	return n, err
+}
+
+// pushOptions returns the options for pushes made for
+// this response, with any options from the request context
+// merged over those of the handler. They are built once
+// per response and shared by every push it makes.
+func (w *pushResponseWriter) pushOptions() *http.PushOptions {
+	if w.pushOpts.Header != nil {
+		return &w.pushOpts
+	}
+
+	w.pushOpts.Method = w.opts.pushOptions.Method
+
+	var ctxHeader http.Header
+	if ctxOpts := PushOptionsFromContext(w.req.Context()); ctxOpts != nil {
+		if ctxOpts.Method != "" {
+			w.pushOpts.Method = ctxOpts.Method
+		}
+
+		if len(ctxOpts.Header) != 0 {
+			ctxHeader = w.opts.headerPolicy.filterHeader(ctxOpts.Header)
+		}
+	}
+
+	w.pushOpts.Header, w.pooled = w.opts.headers(ctxHeader, w.req)
+
+	if name := w.opts.requestIDHeader; name != "" {
+		w.pushOpts.Header[name] = w.requestID(name)
+	}
+
+	return &w.pushOpts
 }
 
 func isFieldSeparator(r rune) bool {
 	return r == ';' || unicode.IsSpace(r)
 }
 
-func (w *pushResponseWriter) pushLink(opts *http.PushOptions, link string) (pushed bool, err error) {
-	fields := strings.FieldsFunc(link, isFieldSeparator)
-	if len(fields) < 2 {
-		return false, nil
+// nextField returns the first field of s, as split by
+// strings.FieldsFunc with isFieldSeparator, and the rest of
+// s after it, without allocating. field is empty once s
+// has no more fields.
+func nextField(s string) (field, rest string) {
+	start := strings.IndexFunc(s, func(r rune) bool { return !isFieldSeparator(r) })
+	if start < 0 {
+		return "", ""
 	}
 
-	path, fields := fields[0], fields[1:]
-	if len(path) < 4 || path[0] != '<' ||
-		path[1] != '/' || path[2] == '/' ||
-		path[len(path)-1] != '>' {
+	s = s[start:]
+	end := strings.IndexFunc(s, isFieldSeparator)
+	if end < 0 {
+		return s, ""
+	}
+
+	return s[:end], s[end:]
+}
+
+func (w *pushResponseWriter) pushLink(opts *http.PushOptions, link string) (pushed bool, err error) {
+	// Only links to local paths are pushed, unless
+	// Options.RewriteTarget may map others to them.
+	path, rest := nextField(link)
+	if len(path) < 3 || path[0] != '<' || path[len(path)-1] != '>' ||
+		w.opts.rewriteTarget == nil && (len(path) < 4 || path[1] != '/' || path[2] == '/') {
 		return false, nil
 	}
 
-	var isPreload bool
-	for _, field := range fields {
+	var isPreload, noPush bool
+	for field, rest := nextField(rest); field != ""; field, rest = nextField(rest) {
 		switch field {
 		case "rel=preload", `rel="preload"`:
 			isPreload = true
 		case "nopush":
-			return false, nil
+			noPush = true
 		}
 	}
 
@@ -136,122 +557,722 @@ func (w *pushResponseWriter) pushLink(opts *http.PushOptions, link string) (push
 
 	path = path[1 : len(path)-1]
 
+	if noPush {
+		w.record(path, NoPush, w.opts.clock.Now(), nil)
+		return false, nil
+	}
+
+	return w.pushTarget(path, opts)
+}
+
+func (w *pushResponseWriter) pushTarget(path string, opts *http.PushOptions) (pushed bool, err error) {
+	if w.isPush {
+		w.record(path, NotSupported, w.opts.clock.Now(), http.ErrNotSupported)
+		return false, http.ErrNotSupported
+	}
+
+	if w.opts.insecure(w.req) || w.opts.visitPolicy(w.req) == VisitPreload {
+		w.record(path, NotSupported, w.opts.clock.Now(), http.ErrNotSupported)
+		return false, http.ErrNotSupported
+	}
+
 	if w.bloom == nil {
 		w.loadBloomFilter()
 	}
 
-	if w.bloom.TestString(path) {
+	start := w.opts.clock.Now()
+
+	path, ok := w.opts.rewrite(path)
+	if !ok {
+		w.record(path, NoPush, start, nil)
+		return false, nil
+	}
+
+	clean, ok := cleanTarget(path)
+	if !ok {
+		w.record(path, Failed, start, errUnsafeTarget)
+		return false, errUnsafeTarget
+	}
+
+	path = clean
+	key := w.filterKey(path)
+
+	if w.cached(path, key) {
+		w.record(path, Filtered, start, nil)
+		return false, nil
+	}
+
+	if w.opts.blocklist != nil && w.opts.blocklist.blocked(targetPath(path)) {
+		w.record(path, NoPush, start, nil)
+		return false, nil
+	}
+
+	if w.opts.observeOnly {
+		w.add(key)
+		w.record(path, Observed, start, nil)
+		return false, nil
+	}
+
+	if w.overTimeBudget() || w.overPushLimit(key) {
+		w.record(path, OverBudget, start, nil)
+		return false, nil
+	}
+
+	if w.pushedOnConn(key) {
+		w.add(key)
+		w.record(path, Filtered, start, nil)
 		return false, nil
 	}
 
-	if err := w.Push(path, opts); err != nil {
+	if w.opts.edgePush {
+		w.add(key)
+		w.dirty = true
+		w.pushCount++
+
+		w.record(path, Pushed, start, nil)
+		return true, nil
+	}
+
+	if w.trace != nil && w.trace.PushStart != nil {
+		w.trace.PushStart(path)
+	}
+
+	err = w.pushWithDeadline(path, opts)
+
+	if w.trace != nil && w.trace.PushDone != nil {
+		w.trace.PushDone(path, err)
+	}
+
+	if err == http.ErrNotSupported {
+		w.record(path, NotSupported, start, err)
+		return false, err
+	} else if err != nil {
+		w.record(path, Failed, start, err)
 		return false, err
 	}
 
-	w.bloom.AddString(path)
+	w.add(key)
+	w.dirty = true
+	w.pushCount++
+
+	w.record(path, Pushed, start, nil)
 	return true, nil
 }
 
-func (w *pushResponseWriter) loadBloomFilter() {
-	c, err := w.req.Cookie(w.opts.cookie.Name)
-	if err != nil || c.Value == "" {
-		w.bloom = bloom.New(w.opts.m, w.opts.k)
+func (w *pushResponseWriter) saveIfDirty() {
+	if w.saveCleared() || w.saveNoPush() {
 		return
 	}
 
-	sr := strings.NewReader(c.Value)
-	b64r := base64.NewDecoder(base64.RawStdEncoding, sr)
+	if !w.dirty {
+		w.refreshCookie()
+		return
+	}
 
-	fr, _ := flateReaderPool.Get().(io.ReadCloser)
-	if fr == nil {
-		fr = flate.NewReader(b64r)
-	} else if err := fr.(flate.Resetter).Reset(b64r, nil); err != nil {
-		panic(err)
+	if w.isPush {
+		return
 	}
 
-	w.bloom = new(bloom.BloomFilter)
-	if _, err := w.bloom.ReadFrom(fr); err != nil {
-		httputils.RequestLogf(w.req, "go-server-push: error loading bloom filter: %#v", err)
+	w.dirty = false
 
-		w.bloom = bloom.New(w.opts.m, w.opts.k)
+	if err := w.saveBloomFilter(); err != nil {
+		w.opts.logError(w.req, "error saving bloom filter", err)
+		return
 	}
 
-	if err := fr.Close(); err != nil {
-		httputils.RequestLogf(w.req, "go-server-push: error closing flate writer: %#v", err)
+	if w.opts.cookieless(w.req) {
+		return
 	}
 
-	flateReaderPool.Put(fr)
-}
+	if w.opts.wasteWindow > 0 {
+		w.savePushTime()
+	}
 
-func (w *pushResponseWriter) saveBloomFilter() (err error) {
-	buf := bufferPool.Get().(*bytes.Buffer)
-	b64w := base64.NewEncoder(base64.RawStdEncoding, buf)
+	if w.opts.cookieRefresh > 0 {
+		w.saveRefreshed()
+	}
+}
 
-	fw, _ := flateWriterPool.Get().(*flate.Writer)
-	if fw != nil {
-		fw.Reset(b64w)
-	} else if fw, err = flate.NewWriter(b64w, flate.BestSpeed); err != nil {
+func (w *pushResponseWriter) loadBloomFilter() {
+	c, err := w.req.Cookie(w.opts.cookie.Name)
+	if err != nil || c.Value == "" || w.opts.cookieless(w.req) {
+		w.resetFilter()
+		w.filterLoaded(nil)
 		return
 	}
 
-	if _, err = w.bloom.WriteTo(fw); err != nil {
+	// Oversized cookies are rejected before any decoding.
+	if len(c.Value) > w.opts.maxCookieSize {
+		w.opts.add(oversizedCookiesVar, 1)
+		w.opts.filterLoaded(w.req, 0, errCookieTooLarge)
+		w.opts.add(filterResetsVar, 1)
+		w.opts.logError(w.req, "error loading bloom filter", errCookieTooLarge)
+
+		w.resetFilter()
+		w.filterLoaded(errCookieTooLarge)
 		return
 	}
 
-	if err = fw.Close(); err != nil {
+	raw, noPush := strings.CutPrefix(c.Value, noPushPrefix)
+	w.pushDisabled = noPush && w.opts.rememberNoPush
+
+	gen, value := splitGeneration(raw)
+	if gen != w.opts.generation() {
+		w.resetFilter()
+		w.filterLoaded(nil)
 		return
 	}
 
-	flateWriterPool.Put(fw)
+	start := w.opts.clock.Now()
+	if buckets, ok := strings.CutPrefix(value, bucketsPrefix); ok && w.opts.ttlBucket > 0 {
+		w.bucket = w.opts.bucketIndex(start)
+		w.buckets, w.bloom, w.filterWords, err = decodeBuckets(buckets, w.opts.m, w.opts.k, w.bucket, w.opts.ttlBuckets)
+	} else if set, ok := strings.CutPrefix(value, exactPrefix); ok {
+		w.bloom, w.filterWords, w.exact, err = decodeExact(set, w.opts.m, w.opts.k)
+		w.exactMode = err == nil && w.bloom.Cap() == w.opts.m && w.bloom.K() == w.opts.k &&
+			len(w.exact)/int(w.opts.k) <= w.opts.exactThreshold
+	} else {
+		w.bloom, w.filterWords, err = decodeFilterPooled(value, w.opts.m, w.opts.k)
+	}
 
-	if err = b64w.Close(); err != nil {
-		return
+	// A filter saved before TTLBucket was set is taken to
+	// have been added to in the current interval.
+	if err == nil && w.opts.ttlBucket > 0 && w.buckets == nil {
+		w.bucket = w.opts.bucketIndex(start)
+		w.buckets = append(w.buckets, w.bloom.Copy())
+		w.exactMode = false
+	}
+
+	w.opts.filterLoaded(w.req, w.opts.clock.Now().Sub(start), err)
+
+	if err != nil {
+		w.opts.add(filterResetsVar, 1)
+		w.opts.logError(w.req, "error loading bloom filter", err)
+
+		w.resetFilter()
+	}
+
+	w.filterLoaded(err)
+}
+
+// resetFilter gives the client an empty filter.
+func (w *pushResponseWriter) resetFilter() {
+	m, k := w.opts.filterParams(w.req)
+	w.bloom, w.filterWords = newFilter(m, k)
+	w.exact = w.exact[:0]
+	w.exactMode = w.opts.exactThreshold > 0 && m == w.opts.m && k == w.opts.k
+
+	if w.opts.ttlBucket > 0 {
+		w.buckets, w.bucket = nil, w.opts.bucketIndex(w.opts.clock.Now())
+		w.exactMode = false
+	}
+}
+
+func (w *pushResponseWriter) filterLoaded(err error) {
+	w.loadStoredFilter()
+	w.loadConnFilter()
+
+	// The filter shared by a connection may hold targets
+	// that are not in the exact set.
+	if w.conn != nil {
+		w.exactMode = false
+	}
+
+	if w.trace != nil && w.trace.FilterLoaded != nil {
+		w.trace.FilterLoaded(err)
+	}
+}
+
+func (w *pushResponseWriter) saveBloomFilter() error {
+	if w.opts.insecure(w.req) {
+		return nil
+	}
+
+	w.saveConnFilter()
+	w.saveStoredFilter()
+
+	if w.opts.cookieless(w.req) {
+		return nil
+	}
+
+	start := w.opts.clock.Now()
+	var v string
+	var err error
+	switch {
+	case w.opts.ttlBucket > 0:
+		v, err = encodeBuckets(w.bucket, w.buckets)
+	case w.exactMode:
+		v = encodeExact(w.opts.m, w.opts.k, w.exact)
+	case w.opts.compactCookie:
+		v, err = encodeCompact(w.bloom)
+	default:
+		v, err = encodeFilter(w.bloom)
+	}
+
+	w.opts.filterSaved(w.req, w.opts.clock.Now().Sub(start), err)
+
+	if w.trace != nil && w.trace.FilterSaved != nil {
+		w.trace.FilterSaved(err)
+	}
+
+	if err != nil {
+		return err
 	}
 
 	c := *w.opts.cookie
-	c.Value = buf.String()
-	http.SetCookie(w, &c)
+	c.Value = joinGeneration(w.opts.generation(), v)
+	if w.pushDisabled {
+		c.Value = noPushPrefix + c.Value
+	}
 
-	buf.Reset()
-	bufferPool.Put(buf)
-	return
+	http.SetCookie(w, &c)
+	return nil
 }
 
 func (w *pushResponseWriter) Push(target string, opts *http.PushOptions) error {
-	return w.ResponseWriter.(http.Pusher).Push(target, opts)
+	p, ok := w.ResponseWriter.(http.Pusher)
+	if !ok || !w.opts.clientSupportsPush(w.req) {
+		return http.ErrNotSupported
+	}
+
+	opts, key := w.opts.sentinel.promise(w.req, opts)
+
+	err := p.Push(target, opts)
+	if err != nil {
+		pendingPushes.cancel(key)
+	}
+
+	if err == http.ErrNotSupported {
+		w.pushNotSupported()
+	}
+
+	return err
 }
 
 func (w *pushResponseWriter) Flush() {
+	if w.scan != nil {
+		if err := w.release(); err != nil {
+			return
+		}
+	}
+
 	if f, ok := w.ResponseWriter.(http.Flusher); ok {
 		f.Flush()
 	}
 }
 
-type pushHandler struct {
+// Unwrap returns the wrapped http.ResponseWriter for use
+// by http.ResponseController.
+func (w *pushResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *pushResponseWriter) CloseNotify() <-chan bool {
+	return w.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
+// Hijack hands the connection over to the caller, as for
+// a WebSocket upgrade. Links are not pushed once the
+// connection has been hijacked.
+func (w *pushResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		w.wroteHeader = true
+	}
+
+	return conn, brw, err
+}
+
+// ReadFrom delegates to the underlying io.ReaderFrom so
+// that sendfile may still be used, after first pushing any
+// links in the response headers.
+func (w *pushResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if w.scan != nil {
+		return io.Copy(writerOnly{w}, r)
+	}
+
+	n, err := w.ResponseWriter.(io.ReaderFrom).ReadFrom(r)
+	w.written += n
+	return n, err
+}
+
+// PushHandler is a push aware http.Handler returned by
+// New and NewRedirects.
+type PushHandler struct {
 	http.Handler
-	options
+
+	mu   sync.Mutex
+	opts atomic.Pointer[options]
+
+	redirectsOnly bool
+
+	// off is set by SetEnabled(false).
+	off atomic.Bool
+
+	// closing is set by Shutdown, which waits for inflight
+	// to reach zero.
+	closing  atomic.Bool
+	inflight atomic.Int64
+
+	events eventHub
+	meta   metaCache
+
+	// limiter is shared by the options of each call to
+	// SetOptions, so errors already counted in the current
+	// interval stay counted.
+	limiter logLimiter
 }
 
-func (s *pushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if _, ok := w.(http.Pusher); !ok {
+func (s *PushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o := s.opts.Load()
+
+	// An inner handler whose pushes are all made by an
+	// outer one passes requests through.
+	res := ResultFromContext(r.Context())
+	if o.nested(r, res) {
 		s.Handler.ServeHTTP(w, r)
 		return
 	}
 
-	prw := &pushResponseWriter{
-		ResponseWriter: w,
-		req:            r,
+	r, isPush := o.sentinel.mark(r)
+
+	if o.learner != nil && !isPush {
+		o.learner.Observe(r)
+	}
+
+	if o.wasteWindow > 0 && !isPush {
+		o.checkWasted(r)
+	}
 
-		opts: &s.options,
+	if o.blocklist != nil && isPush {
+		defer o.blocklist.served(r)
 	}
 
-	var rw http.ResponseWriter = prw
+	// Responses that cannot be pushed are still wrapped if
+	// a fallback needs to see their headers, and those to
+	// pushed requests only to record their metadata.
+	_, ok := w.(http.Pusher)
+	if !ok && o.fallbackFor(r) == FallbackLink && !o.redirectEarlyHints && !o.edgePush ||
+		isPush && o.meta == nil || o.disabled || s.off.Load() || o.skipRange(r) || !s.begin() {
+		s.passThrough(w, r, res)
+		return
+	}
+	defer s.end()
+
+	prw := writerPool.Get().(*pushResponseWriter)
+	prw.ResponseWriter = w
+	prw.handler = s.Handler
+	prw.opts = o
+	prw.isPush = isPush
+
+	// The Result is allocated for each request, rather than
+	// pooled with the writer, as it may be kept by the
+	// handler through ResultFromContext.
+	prw.result = res
+	if prw.result == nil {
+		prw.result = new(Result)
+		r = r.WithContext(context.WithValue(r.Context(), resultKey{}, prw.result))
+	}
+
+	prw.result.serves |= o.serves()
+
+	prw.req = r
+	prw.trace = ContextPushTrace(r.Context())
+
+	if o.pushTimeout > 0 {
+		prw.started = o.clock.Now()
+	}
+
+	s.Handler.ServeHTTP(wrapWriter(prw, w), r)
+
+	if prw.scan != nil {
+		if err := prw.release(); err != nil {
+			o.logError(r, "error writing response", err)
+		}
+	}
 
-	if _, ok := w.(http.CloseNotifier); ok {
-		rw = closeNotifyPushResponseWriter{prw}
+	if o.meta != nil && isPush {
+		prw.recordMetadata()
 	}
 
-	s.Handler.ServeHTTP(rw, r)
+	prw.recordDelivery()
+
+	prw.releaseHeader()
+	prw.releaseFilter()
+	prw.reset()
+	writerPool.Put(prw)
+}
+
+// insecure reports whether r was not made over TLS, and may
+// be neither pushed to nor sent the cookie.
+func (o *options) insecure(r *http.Request) bool {
+	return !o.allowInsecure && o.scheme(r) != "https"
+}
+
+// scheme returns the scheme the client used to make r,
+// trusting X-Forwarded-Proto if TrustForwardedProto is
+// set.
+func (o *options) scheme(r *http.Request) string {
+	if r.TLS != nil || o.trustForwardedProto && forwardedHTTPS(r.Header) {
+		return "https"
+	}
+
+	return "http"
+}
+
+// forwardedHTTPS reports whether the last protocol in the
+// X-Forwarded-Proto header, that added by the nearest
+// proxy, is https.
+func forwardedHTTPS(h http.Header) bool {
+	v := h.Values("X-Forwarded-Proto")
+	if len(v) == 0 {
+		return false
+	}
+
+	protos := strings.Split(v[len(v)-1], ",")
+	return strings.EqualFold(strings.TrimSpace(protos[len(protos)-1]), "https")
+}
+
+// skipRange reports whether r is a Range request that is
+// passed through without pushing.
+func (o *options) skipRange(r *http.Request) bool {
+	return !o.pushRanges && r.Header.Get("Range") != ""
+}
+
+// writerPool holds the pushResponseWriters of completed
+// responses for reuse. A handler must not use its
+// http.ResponseWriter after it returns.
+var writerPool = sync.Pool{
+	New: func() any { return new(pushResponseWriter) },
+}
+
+// reset clears w for reuse, keeping the capacity of its
+// slices.
+func (w *pushResponseWriter) reset() {
+	edgePushed := w.edgePushed
+	clear(edgePushed)
+
+	*w = pushResponseWriter{
+		edgePushed: edgePushed[:0],
+	}
+}
+
+// Subscribe returns a Subscription that receives every
+// push decision made by the handler. Events are delivered
+// without blocking; if the buffer is full the event is
+// dropped. The Subscription should be closed when it is
+// no longer needed. It is closed by Shutdown.
+func (s *PushHandler) Subscribe(buffer int) *Subscription {
+	return s.events.subscribe(buffer)
+}
+
+// SetOptions atomically replaces the bloom filter
+// parameters and Options of the handler. Requests that
+// are already being served continue to use the previous
+// options. If Validate reports an error, the options are
+// left unchanged and the error is returned.
+func (s *PushHandler) SetOptions(m, k uint, opts *Options) error {
+	if err := Validate(m, k, opts); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.setOptions(m, k, opts)
+	s.mu.Unlock()
+	return nil
+}
+
+// Update atomically replaces the options of the handler
+// with a copy that has been modified by fn. Calls to
+// Update and SetOptions are serialised, so concurrent
+// updates are not lost. If Validate reports an error, the
+// options are left unchanged and the error is returned.
+func (s *PushHandler) Update(fn func(m, k *uint, opts *Options)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o := s.opts.Load()
+	m, k, opts := o.m, o.k, o.src
+	fn(&m, &k, &opts)
+
+	if err := Validate(m, k, &opts); err != nil {
+		return err
+	}
+
+	s.setOptions(m, k, &opts)
+	return nil
+}
+
+func (s *PushHandler) setOptions(m, k uint, opts *Options) {
+	o := &options{
+		m: m,
+		k: k,
+
+		events: &s.events,
+
+		redirectsOnly: s.redirectsOnly,
+
+		maxCookieSize: maxCookieSize,
+	}
+
+	if opts != nil {
+		o.src = *opts
+	}
+
+	if opts != nil && opts.Cookie != nil {
+		o.cookie = opts.Cookie
+	} else {
+		o.cookie = DefaultCookie()
+		o.cookie.Secure = opts == nil || !opts.Cleartext
+	}
+
+	if opts != nil && opts.PushOptions != nil {
+		o.pushOptions = *opts.PushOptions
+	}
+
+	if opts != nil && opts.ProxyHeaders != nil {
+		o.proxyHeaders = canonicalHeaders(opts.ProxyHeaders)
+	} else {
+		o.proxyHeaders = proxyHeaders
+	}
+
+	if opts != nil && opts.RequestIDHeader != "" {
+		o.requestIDHeader = textproto.CanonicalMIMEHeaderKey(opts.RequestIDHeader)
+	}
+
+	if opts != nil && opts.ForwardCookie {
+		o.proxyHeaders = append(o.proxyHeaders[:len(o.proxyHeaders):len(o.proxyHeaders)], "Cookie")
+	}
+
+	if opts != nil && opts.ForwardAuthorization {
+		o.proxyHeaders = append(o.proxyHeaders[:len(o.proxyHeaders):len(o.proxyHeaders)], "Authorization")
+	}
+
+	if opts != nil {
+		o.headerPolicy = newHeaderPolicy(opts.AllowHeaders, opts.DenyHeaders)
+		o.proxyHeaders = o.headerPolicy.filterNames(o.proxyHeaders)
+		o.pushOptions.Header = o.headerPolicy.filterHeader(o.pushOptions.Header)
+	}
+
+	if opts != nil && opts.SentinelHeader != "" {
+		o.sentinel = NewSentinel(opts.SentinelHeader)
+	} else {
+		o.sentinel = DefaultSentinel
+	}
+
+	// The sentinel header is added to each push with its
+	// own nonce.
+	h := make(http.Header, len(o.pushOptions.Header))
+	for k, v := range o.pushOptions.Header {
+		h[k] = v
+	}
+
+	delete(h, o.sentinel.name)
+	o.pushOptions.Header = h
+
+	if opts != nil {
+		o.vars = opts.Expvar
+		o.initVars(opts.ExpvarPerTarget)
+		o.stats = opts.Stats
+		o.hooks = opts.Hooks
+		o.serverTiming = opts.ServerTiming
+		o.pushedCountHeader = opts.PushedCountHeader
+		o.vary = opts.Vary
+		o.logger = opts.Logger
+		o.errorLog = opts.ErrorLog
+		o.errorHandler = opts.ErrorHandler
+		o.disabled = opts.Disabled
+		o.supportsPush = opts.SupportsPush
+		o.respectPrivacySignals = opts.RespectPrivacySignals
+		o.minThroughput = opts.MinThroughput
+		o.rememberNoPush = opts.RememberNoPush
+		o.cacheDigest = opts.CacheDigest
+		o.skipServiceWorker = opts.SkipServiceWorker
+		o.serviceWorkerHeader = opts.ServiceWorkerHeader
+		o.serviceWorkerCookie = opts.ServiceWorkerCookie
+		o.allowInsecure = opts.AllowInsecure || opts.Cleartext
+		o.trustForwardedProto = opts.TrustForwardedProto
+		o.pushRedirects = opts.PushRedirects
+		o.redirectCodes = slices.Clone(opts.RedirectCodes)
+		o.redirectMethods = slices.Clone(opts.RedirectMethods)
+		o.redirectFilter = opts.RedirectFilter
+		o.redirectDepth = opts.RedirectDepth
+		o.manifest = opts.Manifest
+		o.pushManifest = opts.PushManifest && opts.Manifest != nil
+		o.firstVisit = opts.FirstVisit
+		o.shadow = opts.Shadow
+		o.blocklist = opts.Blocklist
+		o.repeatVisit = opts.RepeatVisit
+		o.redirectEarlyHints = opts.RedirectEarlyHints
+		o.clock = opts.Clock
+		o.observeOnly = opts.ObserveOnly
+		o.fallback = opts.Fallback
+		o.fallbackFunc = opts.FallbackFunc
+		o.http3EarlyHints = opts.HTTP3EarlyHints
+		o.deterministic = opts.Deterministic
+		o.compactCookie = opts.CompactCookie || opts.Deterministic
+		o.exactThreshold = opts.ExactThreshold
+		o.shareConnFilter = opts.ShareConnFilter
+		o.filterStore = opts.FilterStore
+		o.storeKey = opts.StoreKey
+		o.classifyFilter = opts.ClassifyFilter
+		o.sortQuery = opts.SortQuery
+		o.stripQuery = slices.Clone(opts.StripQuery)
+		o.rewriteTarget = opts.RewriteTarget
+		o.partitionBySite = opts.PartitionBySite
+		o.ttlBucket = opts.TTLBucket
+		o.ttlBuckets = opts.TTLBuckets
+		o.targetTTL = opts.TargetTTL
+		o.pushTimeout = opts.PushTimeout
+		o.cookieRefresh = opts.CookieRefresh
+		o.pushRanges = opts.PushRanges
+
+		if opts.MaxCookieSize > 0 {
+			o.maxCookieSize = opts.MaxCookieSize
+		}
+
+		if opts.MetadataCache > 0 {
+			s.meta.setMax(opts.MetadataCache)
+			o.meta = &s.meta
+		}
+		o.edgePush = opts.EdgePush
+		o.edgeAnnotate = opts.EdgeAnnotate
+		o.learner = opts.Learner
+		o.learnerState = opts.LearnerState
+		o.scanHTML = opts.ScanHTML
+		o.resetOnAssetChange = opts.ResetOnAssetChange
+		o.pushBudget = opts.PushBudget
+		o.maxPushes = opts.MaxPushes
+		o.samplePushes = opts.SamplePushes
+		o.pushTimeBudget = opts.PushTimeBudget
+		o.smallestFirst = opts.SmallestFirst
+		o.wasteWindow = opts.WasteWindow
+
+		if opts.ErrorLogLimit > 0 {
+			o.limiter = &s.limiter
+			o.limiter.configure(o, opts.ErrorLogLimit, opts.ErrorLogInterval)
+		}
+
+		if opts.AccessLog != nil {
+			o.accessLog = &accessLog{w: opts.AccessLog}
+		}
+	}
+
+	if o.clock == nil && o.deterministic {
+		o.clock = epochClock{}
+	} else if o.clock == nil {
+		o.clock = SystemClock
+	}
+
+	if c := o.src.Cookie; c != nil && !c.Secure && !o.allowInsecure {
+		o.logWarning("cookie is not Secure, set AllowInsecure if it is meant to be sent without TLS")
+	}
+
+	s.opts.Store(o)
 }
 
 // Options specifies additional options to change the
@@ -259,35 +1280,645 @@ func (s *pushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 type Options struct {
 	Cookie      *http.Cookie
 	PushOptions *http.PushOptions
+
+	// SentinelHeader, if non-empty, is the name of the
+	// sentinel used to identify pushed requests in place
+	// of X-H2-Push. Use NewSentinel with the same name to
+	// recognise them. The header itself is only sent to
+	// upstreams by Sentinel.Forward.
+	SentinelHeader string
+
+	// PushTimeout, if positive, bounds the time taken to
+	// initiate each push. A write deadline is set on the
+	// response with http.ResponseController while each
+	// push is made, so a stalled connection cannot hold
+	// up the response indefinitely; if it passes, the
+	// server abandons the response, which HTTP/2 does by
+	// resetting its stream. The deadline implied by the
+	// server's WriteTimeout is restored afterwards and is
+	// never extended.
+	PushTimeout time.Duration
+
+	// MetadataCache, if positive, is the number of push
+	// targets whose TargetMetadata is remembered from the
+	// responses to pushed requests served by the handler.
+	// Manifest resources without a Size then use the
+	// remembered size for PushBudget and SmallestFirst.
+	MetadataCache int
+
+	// CompactCookie, if true, saves the bloom filter in a
+	// compact encoding, without DEFLATE, that stores
+	// either the raw bits or the gaps between set bits,
+	// whichever is smaller. It is typically half the size
+	// of the default encoding. Cookies in either encoding
+	// are always read, but handlers from before the
+	// compact encoding was added do not read it.
+	CompactCookie bool
+
+	// ExactThreshold, if positive, saves the filter of a
+	// client that has been pushed at most ExactThreshold
+	// targets as an exact set of their bit locations,
+	// rather than as a bloom filter, so that a target is
+	// not mistaken for one already pushed. The set is
+	// replaced by the bloom filter once it grows larger,
+	// or if the client's filter is shared by a connection
+	// with ShareConnFilter. It requires m to be a multiple
+	// of 64.
+	ExactThreshold int
+
+	// ShareConnFilter, if true, shares the bloom filter
+	// between the requests of a connection, as described by
+	// ConnContext, which must be in use. It must not be set
+	// behind a CDN or reverse proxy that multiplexes the
+	// requests of many clients over one connection.
+	ShareConnFilter bool
+
+	// FilterStore, if non-nil, keeps the filter of each
+	// client on the server as well as in its cookie, under
+	// the key returned by StoreKey, such as the ID of the
+	// client's session. The stored filter is merged into
+	// that of the cookie, so a client that loses its
+	// cookie, or is served by another instance sharing the
+	// store, is not pushed again what it has been pushed.
+	// Requests for which StoreKey returns an empty string
+	// only use the cookie. StoreKey is required with
+	// FilterStore.
+	FilterStore FilterStore
+	StoreKey    func(r *http.Request) string
+
+	// MaxCookieSize, if positive, lowers the length of the
+	// longest bloom filter cookie value that is decoded
+	// from the default of 4096 bytes, the limit browsers
+	// place on a cookie. Longer values are rejected, and
+	// the filter reset, before any decoding.
+	MaxCookieSize int
+
+	// ClassifyFilter, if non-nil, is called for a client
+	// without a filter, such as on its first visit, to
+	// choose the parameters of its filter, so that, for
+	// instance, mobile clients are given a smaller cookie.
+	// The parameters are recorded in the cookie and kept
+	// on later requests. The m passed to New is the
+	// largest permitted, and invalid parameters are
+	// replaced by those passed to New.
+	ClassifyFilter func(r *http.Request) (m, k uint)
+
+	// SortQuery, if true, orders the query parameters of
+	// each target by name, and StripQuery removes those
+	// whose names it lists, such as "utm_*", where a
+	// trailing * matches any suffix, before the target is
+	// looked up in or added to the client's filter. Targets
+	// that differ only in the order of their parameters, or
+	// in those stripped, are then only pushed once. The
+	// targets themselves are pushed unchanged.
+	SortQuery  bool
+	StripQuery []string
+
+	// RewriteTarget, if non-nil, is called with each push
+	// target, as it appears in a Link header, a Manifest
+	// or a call to Push, before it is cleaned and pushed.
+	// It returns the target to push in its place, such as
+	// the local path of an asset linked by its CDN URL, or
+	// false if the target must not be pushed. The Link
+	// headers of the response are left unchanged.
+	RewriteTarget func(target string) (string, bool)
+
+	// PartitionBySite, if true, keeps separate records in
+	// the bloom filter for each top-level site that embeds
+	// the handler's pages, as browsers that key their HTTP
+	// cache by top-level site do not share a resource
+	// pushed to a page embedded by one site with another.
+	// Cross-site requests for other than a top-level
+	// document, as told by the Sec-Fetch-Site and
+	// Sec-Fetch-Dest headers, are partitioned by the site
+	// of their Origin or Referer. Requests made from
+	// within a cross-site frame are same-origin to it and
+	// are not told apart from those of top-level pages.
+	PartitionBySite bool
+
+	// TTLBucket, if positive, records in the cookie the
+	// interval, such as a week, in which each target was
+	// pushed, so that targets may be pushed again once
+	// they are likely to have expired from the client's
+	// cache, rather than only when the cookie expires.
+	// The filter of each interval is kept for TTLBuckets
+	// intervals, after which its targets are forgotten.
+	// Filters are saved in the compact encoding and are
+	// never saved as an exact set.
+	TTLBucket  time.Duration
+	TTLBuckets int
+
+	// TargetTTL, if non-nil, returns how long the client
+	// is expected to cache target, such as by its type or
+	// the Cache-Control header it is served with. Targets
+	// pushed in an interval that began longer ago are
+	// pushed again. Targets with a non-positive TTL are
+	// filtered for as long as any interval is kept. It
+	// requires TTLBucket.
+	TargetTTL func(target string) time.Duration
+
+	// Cleartext, if true, indicates that the handler serves
+	// cleartext HTTP/2 (h2c), as with
+	// golang.org/x/net/http2/h2c, on a trusted internal
+	// network. The default cookie is then set without
+	// Secure, as a client would never send it back.
+	//
+	// Pushes over h2c work as they do over TLS, and a
+	// client that disables push is given the Fallback.
+	Cleartext bool
+
+	// AllowInsecure, if true, permits pushing and setting
+	// the cookie on requests not made over TLS, and a
+	// cookie without Secure. It is implied by Cleartext.
+	//
+	// Otherwise, requests for which r.TLS is nil are
+	// treated as not supporting push and are not sent the
+	// cookie, so a handler behind a proxy that terminates
+	// TLS, as in EdgePush mode, stops pushing unless this
+	// or TrustForwardedProto is set. A cookie without
+	// Secure is logged as a warning when the options are
+	// set, so that a deployment accidentally serving
+	// cleartext is caught.
+	AllowInsecure bool
+
+	// TrustForwardedProto, if true, treats a request whose
+	// X-Forwarded-Proto header ends with https as made over
+	// TLS. It must only be set behind a proxy that
+	// terminates TLS and sets the header, as it may
+	// otherwise be sent by the client.
+	TrustForwardedProto bool
+
+	// ProxyHeaders, if non-nil, replaces the list of
+	// request headers that are copied onto pushed
+	// requests. DefaultProxyHeaders returns the default
+	// list, which can be extended or trimmed.
+	ProxyHeaders []string
+
+	// RequestIDHeader, if non-empty, is a header, such as
+	// X-Request-Id, that is copied from the request onto
+	// each pushed request, so that the handling of pushed
+	// resources can be correlated with the response that
+	// pushed them in logs and traces. If the request has
+	// none, a random ID is generated and also added to the
+	// response.
+	RequestIDHeader string
+
+	// ForwardCookie and ForwardAuthorization, if true,
+	// copy the Cookie and Authorization headers of the
+	// request onto pushed requests, so that resources
+	// behind authentication can be pushed.
+	//
+	// Pushed responses are generated with the client's
+	// credentials and are only ever sent to that client,
+	// but they are then held in its push cache as if they
+	// had been requested. Only enable these if the pushed
+	// resources are safe to serve to the authenticated
+	// user, are marked private if they vary by user and
+	// do not perform any state changing action when
+	// requested.
+	ForwardCookie        bool
+	ForwardAuthorization bool
+
+	// DenyHeaders lists request headers that must never be
+	// sent on pushed requests. If AllowHeaders is non-nil,
+	// only the headers it lists may be sent. These apply to
+	// the proxied headers, to PushOptions.Header and to the
+	// headers of push options given in the request context
+	// or to PusherFor alike, and take precedence over
+	// ProxyHeaders, ForwardCookie and ForwardAuthorization.
+	DenyHeaders  []string
+	AllowHeaders []string
+
+	// Expvar, if non-nil, receives counters for the
+	// number of resources pushed, the number of bloom
+	// filters that were reset after failing to load,
+	// the number of errors encountered and the total
+	// nanoseconds spent loading and saving filters and
+	// pushing resources. The number of links skipped
+	// because they were found in the bloom filter is
+	// also counted, so the filter hit ratio can be
+	// derived. Pushes of redirect Locations are
+	// additionally counted separately, as are cookies
+	// rejected for exceeding MaxCookieSize.
+	Expvar *expvar.Map
+
+	// ExpvarPerTarget, if true, additionally records the
+	// pushed and filtered counts for each target path in
+	// nested maps of Expvar. The number of entries is
+	// unbounded, so this should only be used where the
+	// set of linked resources is fixed.
+	ExpvarPerTarget bool
+
+	// Stats, if non-nil, aggregates push decisions for
+	// each target.
+	Stats *Stats
+
+	// Hooks, if non-nil, is invoked as push decisions
+	// are made.
+	Hooks *Hooks
+
+	// ServerTiming, if true, appends a Server-Timing
+	// entry to the response summarising the number of
+	// resources pushed and the time spent pushing them.
+	ServerTiming bool
+
+	// PushedCountHeader, if non-empty, is the name of a
+	// response header, such as X-Pushed-Count, that is
+	// set to the number of resources pushed whenever the
+	// response carries Link headers.
+	PushedCountHeader string
+
+	// Vary, if non-empty, is a request header, such as
+	// Cookie, that is added to the Vary header of every
+	// response whose push decisions depended on the bloom
+	// filter cookie, so that shared caches in front of the
+	// handler do not serve one client's response to
+	// another.
+	Vary string
+
+	// Logger, if non-nil, receives structured records for
+	// errors and, at debug level, for each push decision.
+	// Otherwise errors are logged to the http.Server's
+	// ErrorLog.
+	Logger *slog.Logger
+
+	// ErrorLog, if non-nil and Logger is nil, is used to
+	// log errors instead of the http.Server's ErrorLog.
+	ErrorLog Logger
+
+	// ErrorHandler, if non-nil, is called with each error
+	// in place of logging it, including errors pushing the
+	// Location of redirects. The error is an *Error.
+	ErrorHandler func(r *http.Request, err error)
+
+	// ErrorLogLimit, if positive, is the maximum number
+	// of errors logged in each ErrorLogInterval. Further
+	// errors are counted and reported in a single summary
+	// line once the interval has elapsed.
+	ErrorLogLimit int
+
+	// ErrorLogInterval is the interval for ErrorLogLimit.
+	// If zero, one minute is used.
+	ErrorLogInterval time.Duration
+
+	// AccessLog, if non-nil, receives one JSON object per
+	// line for each response that carried Link headers,
+	// listing the request path, the targets that were
+	// pushed and the targets that were skipped along with
+	// the reason.
+	AccessLog io.Writer
+
+	// Disabled, if true, passes every request through to
+	// the wrapped handler without pushing anything.
+	Disabled bool
+
+	// SupportsPush, if non-nil, is called for each request
+	// made over a connection that supports push and returns
+	// false if the client is known not to make use of
+	// pushed resources, such as by its User-Agent. Those
+	// clients are given the Fallback, as are clients on
+	// connections without push.
+	SupportsPush func(r *http.Request) bool
+
+	// RememberNoPush, if true, records in the bloom filter
+	// cookie that a client refused a push, as a client
+	// does when it has disabled push in its HTTP/2
+	// settings, so that later requests from the client
+	// are given the Fallback without attempting to push.
+	// The record is kept until the cookie expires or is
+	// reset.
+	RememberNoPush bool
+
+	// CacheDigest, if true, consults the Cache-Digest
+	// request header sent by clients and intermediaries
+	// that implement the HTTP Cache Digests draft, and
+	// does not push targets it lists. It is used along
+	// with the bloom filter cookie, and in place of it if
+	// the digest is marked complete. Only the Golomb-coded
+	// set encoding of the earlier drafts is understood;
+	// digests that are stale or include validators are
+	// ignored.
+	CacheDigest bool
+
+	// MinThroughput, if positive, is the slowest rate, in
+	// bytes per second, at which responses must have been
+	// written on a connection, as reported by
+	// ConnThroughput, for pushes to be made on it. Clients
+	// on slower connections are given the Fallback, so
+	// that pushes do not compete with the responses they
+	// asked for. It requires ConnContext.
+	MinThroughput float64
+
+	// RespectPrivacySignals, if true, neither reads nor
+	// sets the bloom filter cookie, or those kept alongside
+	// it, for requests with a DNT or Sec-GPC header of 1,
+	// for sites whose privacy policy honours these signals
+	// for any cookie. Those clients are pushed everything
+	// not already pushed on the same connection, as
+	// recorded with ShareConnFilter if it is set, and
+	// otherwise everything.
+	RespectPrivacySignals bool
+
+	// SkipServiceWorker, if true, treats clients controlled
+	// by a service worker as not supporting push, as the
+	// service worker's cache already holds the assets of
+	// repeat visits and pushed resources bypass it. A
+	// client is taken to be controlled if the request has
+	// the Service-Worker-Navigation-Preload header, the
+	// ServiceWorkerHeader header or the
+	// ServiceWorkerCookie cookie. The latter two may be
+	// set by the service worker or the page that
+	// registers it.
+	SkipServiceWorker   bool
+	ServiceWorkerHeader string
+	ServiceWorkerCookie string
+
+	// PushRedirects, if true, also pushes the Location of
+	// redirect responses, as Redirects does, sharing the
+	// bloom filter, hooks and other options of the handler.
+	PushRedirects bool
+
+	// RedirectCodes, if non-nil, restricts the redirects
+	// whose Location is pushed to those with one of the
+	// listed status codes, for example 301, 302 and 308.
+	// Pushing the target of a 303 See Other or of a 307
+	// Temporary Redirect of a POST is often wasted.
+	RedirectCodes []int
+
+	// RedirectMethods, if non-nil, restricts the redirects
+	// whose Location is pushed to responses to requests
+	// with one of the listed methods. Setting it to GET and
+	// HEAD avoids pushing after form submissions, where the
+	// push is often wasted.
+	//
+	// If it is nil, the Location of a 307 or 308 redirect
+	// is only pushed for GET and HEAD requests, as clients
+	// repeat the original method when following them.
+	RedirectMethods []string
+
+	// RedirectFilter, if non-nil, is called with the
+	// resolved Location of each redirect that would be
+	// pushed. The Location is not pushed if it returns
+	// false, which allows pushes to be skipped for
+	// redirects into authenticated areas, for example.
+	RedirectFilter func(r *http.Request, code int, location string) bool
+
+	// RedirectDepth, if positive, is the number of further
+	// redirects that are followed before a Location is
+	// pushed, so that the final target is pushed rather
+	// than another redirect. Each hop is resolved by
+	// serving a HEAD request for the Location, marked as a
+	// pushed request, with the wrapped handler and
+	// discarding the body. Following stops at the first
+	// hop that does not redirect.
+	//
+	// The wrapped handler therefore runs once for each hop,
+	// up to RedirectDepth times for every pushed redirect,
+	// before the response is written. It should only be
+	// used where serving a redirect, and a HEAD request for
+	// its final target, is cheap and has no side effects.
+	RedirectDepth int
+
+	// Manifest, if non-nil, lists the sub-resources of
+	// pages. When the Location of a redirect is pushed,
+	// the resources listed for it are pushed as well, so
+	// the page the client is redirected to loads without
+	// further round trips.
+	Manifest *Manifest
+
+	// PushManifest, if true, pushes the resources listed in
+	// Manifest for the request path with each successful
+	// response, whether or not it carries Link headers.
+	PushManifest bool
+
+	// FirstVisit and RepeatVisit are the policies for
+	// clients without and with a bloom filter cookie, such
+	// as to push the whole Manifest to new clients with
+	// VisitPushManifest, while returning clients, whose
+	// caches are likely warm, are only sent preload Link
+	// headers with VisitPreload.
+	FirstVisit  VisitPolicy
+	RepeatVisit VisitPolicy
+
+	// Shadow, if non-nil, evaluates a candidate
+	// configuration alongside this one, recording what it
+	// would have pushed and counting where it diverges.
+	// See NewShadow.
+	Shadow *Shadow
+
+	// Blocklist, if non-nil, counts the pushed requests
+	// the handler serves that clients cancel, and stops
+	// pushing targets that are consistently cancelled. It
+	// may be shared by several handlers, and inspected or
+	// overridden at any time.
+	Blocklist *Blocklist
+
+	// RedirectEarlyHints, if true, sends a 103 Early Hints
+	// response preloading the Location of a redirect when
+	// it cannot be pushed, such as over HTTP/1.1, so that
+	// the client still gets a head start.
+	RedirectEarlyHints bool
+
+	// Clock, if non-nil, is used in place of SystemClock.
+	Clock Clock
+
+	// Deterministic, if true, makes the output of the
+	// handler depend only on its requests, for golden
+	// tests of handlers it wraps. Cookies are saved in
+	// the compact encoding, whose bytes, unlike those of
+	// DEFLATE, do not vary between Go versions; MaxPushes
+	// samples using a source seeded by the request; and a
+	// request ID is derived from the request rather than
+	// being random. If Clock is nil, a Clock fixed at the
+	// Unix epoch is used in place of SystemClock. It
+	// should not be set in production.
+	Deterministic bool
+
+	// ObserveOnly, if true, makes every push decision and
+	// reports it through Expvar, Stats, Hooks and the other
+	// observers, but nothing is pushed and the response is
+	// left untouched: Link headers are not modified, the
+	// X-H2-Pushed, count and Server-Timing headers are not
+	// added and the cookie is not set. Links that would
+	// have been pushed are reported as Observed.
+	//
+	// It allows the handler to be evaluated in production
+	// before it is enabled.
+	ObserveOnly bool
+
+	// Fallback selects what is done with the Link headers
+	// when the client has disabled server push or the
+	// connection does not support it. If it is
+	// FallbackFunc, FallbackFunc is called with the links
+	// before the response headers are written.
+	Fallback     Fallback
+	FallbackFunc func(w http.ResponseWriter, r *http.Request, links []string)
+
+	// HTTP3EarlyHints, if true, uses FallbackEarlyHints
+	// for requests served over HTTP/3, whatever Fallback
+	// is. Servers such as quic-go's http3 do not support
+	// server push, so the same handler and bloom filter
+	// may serve both HTTP/2 and HTTP/3 listeners, with
+	// HTTP/3 clients given 103 Early Hints instead.
+	HTTP3EarlyHints bool
+
+	// EdgePush, if true, never pushes from the handler.
+	// Instead the preload Link headers that would have
+	// been pushed, including those of Manifest resources,
+	// are left in the response, passed through
+	// EdgeAnnotate, for a CDN that pushes or sends Early
+	// Hints for them at the edge. They are recorded in the
+	// cookie as if pushed, and the remaining links are
+	// marked nopush so the edge is not told twice.
+	// Redirects are not pushed in this mode.
+	//
+	// The handler need not be served over HTTP/2, as the
+	// connection from the CDN often is not.
+	EdgePush bool
+
+	// EdgeAnnotate, if non-nil, rewrites each Link header
+	// value marked for edge push with any parameters the
+	// CDN expects. Links are otherwise left as is, which
+	// suits CDNs that push preload links without nopush.
+	EdgeAnnotate func(link string) string
+
+	// Learner, if non-nil, observes every request that is
+	// not itself a push, so that a Manifest can be built
+	// from the documents and sub-resources the handler
+	// serves.
+	Learner *Learner
+
+	// LearnerState, if non-nil, receives the state of
+	// Learner, as written by Learner.Export, when the
+	// handler is shut down. See PushHandler.Shutdown.
+	LearnerState io.Writer
+
+	// ScanHTML, if true, scans text/html responses for
+	// same-origin stylesheets, scripts and preload tags
+	// and pushes them. The headers of the response are
+	// held back until the end of its head has been
+	// scanned, or up to 64 KiB of it has been written, so
+	// that the resources in the head are pushed and
+	// recorded in the cookie as if they had been listed in
+	// Link headers. Resources found later in the body are
+	// pushed as they are written, but cannot be recorded.
+	//
+	// Compressed responses are not scanned.
+	ScanHTML bool
+
+	// ResetOnAssetChange, if true, ties the bloom filter
+	// of each client to the Fingerprint of Manifest. When
+	// a new build of a fingerprinted asset is listed, the
+	// filters that clients hold are discarded rather than
+	// being left to fill up with paths that will never be
+	// requested again. The new paths are pushed regardless,
+	// as they were never pushed before.
+	ResetOnAssetChange bool
+
+	// PushBudget, if positive, is the most bytes of
+	// Manifest resources that are pushed with a response,
+	// as given by their Size. Resources that would exceed
+	// it are reported as OverBudget and left for the
+	// client to request. Resources of unknown size and
+	// preload links are not counted.
+	PushBudget int64
+
+	// MaxPushes, if positive, is the most targets pushed
+	// with a response, not counting the Location of a
+	// redirect. Targets beyond it are reported as
+	// OverBudget and left as preload Link headers.
+	//
+	// If SamplePushes is set and more targets than
+	// MaxPushes are not already in the client's filter,
+	// they are chosen at random in proportion to the Weight
+	// of Manifest resources, scaled down for targets whose
+	// pushes Stats finds are often wasted, rather than the
+	// first being pushed, so that every target is pushed
+	// across visits.
+	MaxPushes    int
+	SamplePushes bool
+
+	// PushTimeBudget, if positive, bounds the time spent
+	// pushing the targets of a response once its headers
+	// are written, protecting the latency of the response
+	// itself. Targets that remain once it is spent are
+	// reported as OverBudget and left as preload Link
+	// headers, and the PushTimeExceeded hook is called.
+	PushTimeBudget time.Duration
+
+	// SmallestFirst, if true, pushes the Manifest
+	// resources of each priority in order of ascending
+	// Size, so that more of them complete early. Each
+	// resource is still followed by its Resource.Deps,
+	// which move with it.
+	SmallestFirst bool
+
+	// WasteWindow, if positive, enables the estimation of
+	// wasted pushes. When resources are pushed, a second
+	// cookie recording the time is set to expire after
+	// WasteWindow. A request made within the window for a
+	// target in the client's bloom filter suggests the
+	// client ignored or cancelled the push, and is
+	// reported through Stats, Expvar and Hooks.Wasted.
+	//
+	// Only requests served by the handler are seen, so it
+	// should wrap the handler for the pushed resources too.
+	WasteWindow time.Duration
+
+	// CookieRefresh, if positive, sets the bloom filter
+	// cookie again, extending its MaxAge, on a response
+	// that pushes nothing when the cookie has not been set
+	// for CookieRefresh, including 304 Not Modified
+	// responses. Without it, a client that already has
+	// every resource lets the cookie expire and is then
+	// pushed them all again. A second cookie, with the
+	// name of the filter cookie suffixed by -R, records
+	// when the cookie was last set.
+	CookieRefresh time.Duration
+
+	// PushRanges, if true, pushes the links of responses
+	// to Range requests and of 206 Partial Content
+	// responses. By default they are passed through, as
+	// the Link headers of media files, often added by
+	// templates, are repeated for every range requested.
+	PushRanges bool
 }
 
 // New wraps the given http.Handler in a push aware handler.
-func New(m, k uint, handler http.Handler, opts *Options) Handler {
-	s := &pushHandler{
+//
+// If Validate reports an error, it is logged and the
+// handler passes every request through without pushing
+// until it is given valid options with SetOptions.
+//
+// New is kept for existing callers. NewWithConfig is
+// preferred: it names m and k, so they cannot be swapped,
+// and returns the error instead.
+func New(m, k uint, handler http.Handler, opts *Options) *PushHandler {
+	s := &PushHandler{
 		Handler: handler,
-		options: options{
-			m: m,
-			k: k,
-		},
 	}
 
-	if opts != nil && opts.Cookie != nil {
-		s.cookie = opts.Cookie
-	} else {
-		s.cookie = &http.Cookie{
-			Name: defaultCookieName,
-
-			MaxAge:   7776000,
-			Secure:   true,
-			HttpOnly: true,
-		}
+	if err := Validate(m, k, opts); err != nil {
+		s.setInvalid(err, opts)
+		return s
 	}
 
-	if opts != nil && opts.PushOptions != nil {
-		s.pushOptions = *opts.PushOptions
+	s.setOptions(m, k, opts)
+	return s
+}
+
+// NewWithRedirects is like New but also pushes the
+// Location of redirect responses. It is equivalent to
+// calling New with Options.PushRedirects set and replaces
+// wrapping the handler with both New and Redirects.
+func NewWithRedirects(m, k uint, handler http.Handler, opts *Options) *PushHandler {
+	var o Options
+	if opts != nil {
+		o = *opts
 	}
 
-	return s
+	o.PushRedirects = true
+	return New(m, k, handler, &o)
 }
 
 // Wrapper returns a Middleware that calls New.
@@ -297,17 +1928,18 @@ func Wrapper(m, k uint, opts *Options) Middleware {
 	}
 }
 
+// WrapperAll returns a Middleware that calls
+// NewWithRedirects, pushing both preload links and the
+// Location of redirects from a single handler with one
+// bloom filter cookie. It should be preferred to composing
+// Wrapper and RedirectsWrap, where the order matters.
+func WrapperAll(m, k uint, opts *Options) Middleware {
+	return func(h http.Handler) http.Handler {
+		return NewWithRedirects(m, k, h, opts)
+	}
+}
+
 // EstimateParameters estimates requirements for m and k.
 func EstimateParameters(n uint, p float64) (m, k uint) {
 	return bloom.EstimateParameters(n, p)
 }
-
-// This struct is intentionally small (1 pointer wide) so as to
-// fit inside an interface{} without causing an allocaction.
-type closeNotifyPushResponseWriter struct{ *pushResponseWriter }
-
-var _ http.CloseNotifier = closeNotifyPushResponseWriter{}
-
-func (w closeNotifyPushResponseWriter) CloseNotify() <-chan bool {
-	return w.ResponseWriter.(http.CloseNotifier).CloseNotify()
-}
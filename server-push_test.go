@@ -0,0 +1,45 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+type benchPusher struct{ http.ResponseWriter }
+
+func (benchPusher) Push(string, *http.PushOptions) error { return nil }
+
+func benchLinks(n int) http.Handler {
+	links := make([]string, n)
+	for i := range links {
+		links[i] = "</" + strconv.Itoa(i) + ".css>; rel=preload; as=style"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["Link"] = links
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	for _, n := range []int{1, 20} {
+		b.Run(strconv.Itoa(n)+"-links", func(b *testing.B) {
+			h := New(1<<16, 4, benchLinks(n), nil)
+
+			r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+			r.Header.Set("User-Agent", "bench")
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				h.ServeHTTP(benchPusher{httptest.NewRecorder()}, r)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Package serverpushtest provides utilities for testing
+// handlers that use HTTP/2 server push.
+package serverpushtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// Push is a push recorded by a ResponseRecorder.
+type Push struct {
+	// Target is the path that was pushed.
+	Target string
+	// Options is a copy of the options the push was made
+	// with. It is never nil.
+	Options *http.PushOptions
+}
+
+// ResponseRecorder is an httptest.ResponseRecorder that
+// also implements http.Pusher.
+type ResponseRecorder struct {
+	*httptest.ResponseRecorder
+
+	// Err, if non-nil, is returned from Push and the push
+	// is not recorded. Set it to http.ErrNotSupported to
+	// simulate a client that has disabled push.
+	Err error
+
+	mu     sync.Mutex
+	pushes []Push
+}
+
+// NewRecorder returns an initialized ResponseRecorder.
+func NewRecorder() *ResponseRecorder {
+	return &ResponseRecorder{ResponseRecorder: httptest.NewRecorder()}
+}
+
+// Push implements http.Pusher.
+func (rw *ResponseRecorder) Push(target string, opts *http.PushOptions) error {
+	if rw.Err != nil {
+		return rw.Err
+	}
+
+	var o http.PushOptions
+	if opts != nil {
+		o.Method = opts.Method
+		o.Header = opts.Header.Clone()
+	}
+
+	rw.mu.Lock()
+	rw.pushes = append(rw.pushes, Push{target, &o})
+	rw.mu.Unlock()
+	return nil
+}
+
+// Pushes returns the pushes recorded so far in the order
+// they were made.
+func (rw *ResponseRecorder) Pushes() []Push {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	return append([]Push(nil), rw.pushes...)
+}
+
+// Pushed returns the targets pushed so far in the order
+// they were pushed.
+func (rw *ResponseRecorder) Pushed() []string {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	targets := make([]string, len(rw.pushes))
+	for i, p := range rw.pushes {
+		targets[i] = p.Target
+	}
+
+	return targets
+}
+
+var _ http.Pusher = (*ResponseRecorder)(nil)
@@ -0,0 +1,263 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpushtest
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// Server is an httptest.Server that serves HTTP/2 over
+// TLS and can be queried with a client that accepts
+// pushed streams.
+//
+// net/http's client disables server push, so responses
+// must be fetched with Do or Get rather than through
+// Client.
+type Server struct {
+	*httptest.Server
+
+	// Timeout bounds the time taken by each call to Do.
+	// If it is zero, a default of ten seconds is used.
+	Timeout time.Duration
+}
+
+// NewServer starts and returns a new HTTP/2 Server. The
+// caller should call Close when finished, to shut it
+// down.
+func NewServer(h http.Handler) *Server {
+	s := httptest.NewUnstartedServer(h)
+	s.EnableHTTP2 = true
+	s.StartTLS()
+	return &Server{Server: s}
+}
+
+// Response is a response received from a Server.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	// Pushes contains the streams the server promised
+	// while serving the request, in the order they were
+	// promised.
+	Pushes []*PushedResponse
+}
+
+// Pushed returns the paths of the pushed responses.
+func (r *Response) Pushed() []string {
+	paths := make([]string, len(r.Pushes))
+	for i, p := range r.Pushes {
+		paths[i] = p.Path
+	}
+
+	return paths
+}
+
+// PushedResponse is a stream pushed by a Server.
+type PushedResponse struct {
+	// Method, Path and RequestHeader describe the request
+	// the server promised to respond to.
+	Method        string
+	Path          string
+	RequestHeader http.Header
+
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	// Reset is true if the server reset the stream
+	// before it completed.
+	Reset bool
+}
+
+// Get issues a GET request for path to the server.
+func (s *Server) Get(path string, header http.Header) (*Response, error) {
+	return s.Do(http.MethodGet, path, header)
+}
+
+// Do issues a body-less request to the server on a new
+// connection and returns the response together with any
+// pushed streams. It returns once the response and all
+// pushed streams have completed.
+func (s *Server) Do(method, path string, header http.Header) (*Response, error) {
+	tr, ok := s.Client().Transport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("serverpushtest: unsupported client transport")
+	}
+
+	config := tr.TLSClientConfig.Clone()
+	config.NextProtos = []string{http2.NextProtoTLS}
+
+	conn, err := tls.Dial("tcp", s.Listener.Addr().String(), config)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if p := conn.ConnectionState().NegotiatedProtocol; p != http2.NextProtoTLS {
+		return nil, fmt.Errorf("serverpushtest: negotiated protocol %q, want %q", p, http2.NextProtoTLS)
+	}
+
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Write([]byte(http2.ClientPreface)); err != nil {
+		return nil, err
+	}
+
+	dec := hpack.NewDecoder(4096, nil)
+
+	fr := http2.NewFramer(conn, conn)
+	fr.ReadMetaHeaders = dec
+
+	if err := fr.WriteSettings(http2.Setting{ID: http2.SettingEnablePush, Val: 1}); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := hpack.NewEncoder(&buf)
+	enc.WriteField(hpack.HeaderField{Name: ":method", Value: method})
+	enc.WriteField(hpack.HeaderField{Name: ":scheme", Value: "https"})
+	enc.WriteField(hpack.HeaderField{Name: ":authority", Value: s.Listener.Addr().String()})
+	enc.WriteField(hpack.HeaderField{Name: ":path", Value: path})
+
+	for k, vv := range header {
+		for _, v := range vv {
+			enc.WriteField(hpack.HeaderField{Name: strings.ToLower(k), Value: v})
+		}
+	}
+
+	const streamID = 1
+	if err := fr.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      streamID,
+		BlockFragment: buf.Bytes(),
+		EndStream:     true,
+		EndHeaders:    true,
+	}); err != nil {
+		return nil, err
+	}
+
+	res := new(Response)
+	pushes := make(map[uint32]*PushedResponse)
+	done := false
+	open := 0
+
+	for !done || open > 0 {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				err = fr.WriteSettingsAck()
+			}
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				err = fr.WritePing(true, f.Data)
+			}
+		case *http2.GoAwayFrame:
+			return nil, fmt.Errorf("serverpushtest: server sent GOAWAY: %v", f.ErrCode)
+		case *http2.PushPromiseFrame:
+			var fields []hpack.HeaderField
+			if fields, err = dec.DecodeFull(f.HeaderBlockFragment()); err != nil {
+				break
+			}
+
+			p := &PushedResponse{RequestHeader: make(http.Header)}
+			for _, hf := range fields {
+				switch hf.Name {
+				case ":method":
+					p.Method = hf.Value
+				case ":path":
+					p.Path = hf.Value
+				default:
+					if !strings.HasPrefix(hf.Name, ":") {
+						p.RequestHeader.Add(hf.Name, hf.Value)
+					}
+				}
+			}
+
+			pushes[f.PromiseID] = p
+			res.Pushes = append(res.Pushes, p)
+			open++
+		case *http2.MetaHeadersFrame:
+			status, _ := strconv.Atoi(f.PseudoValue("status"))
+
+			h := make(http.Header)
+			for _, hf := range f.RegularFields() {
+				h.Add(hf.Name, hf.Value)
+			}
+
+			if f.StreamID == streamID {
+				if res.Header == nil {
+					res.StatusCode, res.Header = status, h
+				}
+
+				done = done || f.StreamEnded()
+			} else if p := pushes[f.StreamID]; p != nil {
+				if p.Header == nil {
+					p.StatusCode, p.Header = status, h
+				}
+
+				if f.StreamEnded() {
+					open--
+				}
+			}
+		case *http2.DataFrame:
+			data := f.Data()
+			if len(data) > 0 {
+				if err = fr.WriteWindowUpdate(0, uint32(len(data))); err == nil {
+					err = fr.WriteWindowUpdate(f.StreamID, uint32(len(data)))
+				}
+			}
+
+			if f.StreamID == streamID {
+				res.Body = append(res.Body, data...)
+				done = done || f.StreamEnded()
+			} else if p := pushes[f.StreamID]; p != nil {
+				p.Body = append(p.Body, data...)
+
+				if f.StreamEnded() {
+					open--
+				}
+			}
+		case *http2.RSTStreamFrame:
+			if f.StreamID == streamID {
+				return nil, fmt.Errorf("serverpushtest: server reset stream: %v", f.ErrCode)
+			}
+
+			if p := pushes[f.StreamID]; p != nil {
+				p.Reset = true
+				open--
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import "net/http"
+
+// navigationPreloadHeader is sent with navigation requests
+// made by a service worker with navigation preload enabled.
+const navigationPreloadHeader = "Service-Worker-Navigation-Preload"
+
+// serviceWorker reports whether r indicates a client
+// controlled by a service worker, when
+// Options.SkipServiceWorker is set.
+func (o *options) serviceWorker(r *http.Request) bool {
+	if !o.skipServiceWorker {
+		return false
+	}
+
+	if r.Header.Get(navigationPreloadHeader) != "" {
+		return true
+	}
+
+	if o.serviceWorkerHeader != "" && r.Header.Get(o.serviceWorkerHeader) != "" {
+		return true
+	}
+
+	if o.serviceWorkerCookie != "" {
+		if _, err := r.Cookie(o.serviceWorkerCookie); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
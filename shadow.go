@@ -0,0 +1,140 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import "sync/atomic"
+
+// Shadow evaluates a candidate configuration alongside that
+// of a handler, so that a change of policy may be measured
+// before it is rolled out. The candidate considers the
+// links of every response the handler considers for push,
+// and its own Manifest resources, recording what it would
+// have pushed, as if in observe only mode, in its own
+// cookie. Nothing is pushed for it.
+//
+// It is used by setting Options.Shadow.
+type Shadow struct {
+	opts *options
+
+	requests   atomic.Uint64
+	diverged   atomic.Uint64
+	liveOnly   atomic.Uint64
+	shadowOnly atomic.Uint64
+}
+
+// ShadowStats counts the divergence between the pushes of
+// a handler and those its Shadow would have made.
+type ShadowStats struct {
+	// Requests is the number of responses evaluated.
+	Requests uint64
+	// Diverged is the number of responses for which the
+	// targets differed.
+	Diverged uint64
+	// LiveOnly is the number of targets pushed by the
+	// handler that the candidate would not have pushed.
+	LiveOnly uint64
+	// ShadowOnly is the number of targets the candidate
+	// would have pushed that the handler did not.
+	ShadowOnly uint64
+}
+
+// NewShadow returns a Shadow evaluating the candidate
+// configuration c. Its cookie must have a different name
+// to that of the handler it shadows. Its Hooks, Stats and
+// other observers receive its decisions, each reported as
+// Observed.
+func NewShadow(c Config) (*Shadow, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	c.Options.ObserveOnly = true
+
+	m, k := c.params()
+	return &Shadow{opts: New(m, k, nil, &c.Options).opts.Load()}, nil
+}
+
+// Stats returns the divergence counted so far.
+func (s *Shadow) Stats() ShadowStats {
+	return ShadowStats{
+		Requests:   s.requests.Load(),
+		Diverged:   s.diverged.Load(),
+		LiveOnly:   s.liveOnly.Load(),
+		ShadowOnly: s.shadowOnly.Load(),
+	}
+}
+
+// evaluateShadow evaluates links, and the Manifest
+// resources of the candidate, with the Shadow of the
+// handler and compares what it would have pushed with the
+// pushes recorded for the response.
+func (w *pushResponseWriter) evaluateShadow(code int, links []string) {
+	s := w.opts.shadow
+
+	sw := &pushResponseWriter{
+		ResponseWriter: w.ResponseWriter,
+		opts:           s.opts,
+		req:            w.req,
+		result:         new(Result),
+	}
+	defer sw.releaseFilter()
+
+	if s.opts.pushManifest && code >= 200 && code < 300 {
+		sw.pushResources(s.opts.manifest.Lookup(w.req.URL.Path), nil)
+	}
+
+	for _, link := range links {
+		sw.pushLink(nil, link)
+	}
+
+	shadow := make(map[string]bool)
+	for _, e := range sw.result.Events {
+		if e.Outcome == Observed {
+			shadow[e.Target] = true
+		}
+	}
+
+	if len(shadow) != 0 {
+		if err := sw.saveBloomFilter(); err != nil {
+			s.opts.logError(w.req, "error saving bloom filter", err)
+		}
+	}
+
+	var liveOnly, shadowOnly []string
+	live := make(map[string]bool)
+	for _, e := range w.result.Events {
+		if e.Outcome != Pushed && e.Outcome != Observed || live[e.Target] {
+			continue
+		}
+
+		live[e.Target] = true
+
+		if !shadow[e.Target] {
+			liveOnly = append(liveOnly, e.Target)
+		}
+	}
+
+	for _, e := range sw.result.Events {
+		if e.Outcome == Observed && !live[e.Target] {
+			shadowOnly = append(shadowOnly, e.Target)
+			live[e.Target] = true
+		}
+	}
+
+	s.requests.Add(1)
+
+	if len(liveOnly) == 0 && len(shadowOnly) == 0 {
+		return
+	}
+
+	s.diverged.Add(1)
+	s.liveOnly.Add(uint64(len(liveOnly)))
+	s.shadowOnly.Add(uint64(len(shadowOnly)))
+
+	if hooks := w.opts.hooks; hooks != nil && hooks.ShadowDiverged != nil {
+		hooks.ShadowDiverged(w.req, liveOnly, shadowOnly)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"sync"
+
+	"github.com/willf/bloom"
+)
+
+// sharedFilter is a bloom filter that is safe for
+// concurrent use, for filters that are shared between the
+// requests of a client rather than read from each
+// request's cookie.
+type sharedFilter struct {
+	mu  sync.Mutex
+	gen uint64
+	f   *bloom.BloomFilter
+}
+
+func newSharedFilter(f *bloom.BloomFilter, gen uint64) *sharedFilter {
+	return &sharedFilter{gen: gen, f: f}
+}
+
+// matches reports whether the filter has m bits, k hash
+// functions and the given generation. They never change.
+func (sf *sharedFilter) matches(m, k uint, gen uint64) bool {
+	return sf.gen == gen && sf.f.Cap() == m && sf.f.K() == k
+}
+
+// TestAndAdd adds s to the filter and reports whether it
+// was probably present already. Of several concurrent
+// calls with the same s, at most one returns false, so it
+// can decide which of them pushes.
+func (sf *sharedFilter) TestAndAdd(s string) bool {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	return sf.f.TestAndAddString(s)
+}
+
+// MergeInto adds the contents of the shared filter to f,
+// which must have the same parameters.
+func (sf *sharedFilter) MergeInto(f *bloom.BloomFilter) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	f.Merge(sf.f)
+}
+
+// Exchange adds the contents of f to the shared filter and
+// then the result to f, as a single step, leaving both
+// filters with the union. f must have the same
+// parameters.
+func (sf *sharedFilter) Exchange(f *bloom.BloomFilter) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	sf.f.Merge(f)
+	f.Merge(sf.f)
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// shutdownPollInterval is the longest Shutdown waits
+// between checks for requests that are still pushing.
+const shutdownPollInterval = 500 * time.Millisecond
+
+// Shutdown gracefully stops the handler pushing, such as
+// when the http.Server it serves is shut down. Requests
+// that arrive after Shutdown is called are passed through
+// to the wrapped handler without pushing. Shutdown waits
+// for the requests that are already pushing to complete,
+// and then closes every Subscription, flushes the summary
+// of errors suppressed by Options.ErrorLogLimit, and
+// exports the state of Options.Learner to
+// Options.LearnerState.
+//
+// If ctx expires first, the remaining steps are still
+// taken and the context's error is returned. Once Shutdown
+// has been called the handler does not push again.
+func (s *PushHandler) Shutdown(ctx context.Context) error {
+	s.closing.Store(true)
+
+	err := s.drain(ctx)
+
+	s.events.close()
+
+	o := s.opts.Load()
+	if o.limiter != nil {
+		o.limiter.flush()
+	}
+
+	if o.learner != nil && o.learnerState != nil {
+		if exportErr := o.learner.Export(o.learnerState); exportErr != nil {
+			err = errors.Join(err, exportErr)
+		}
+	}
+
+	return err
+}
+
+// begin records that a request is about to push, reporting
+// false if Shutdown has been called. end must be called
+// once it completes.
+func (s *PushHandler) begin() bool {
+	s.inflight.Add(1)
+	if s.closing.Load() {
+		s.end()
+		return false
+	}
+
+	return true
+}
+
+func (s *PushHandler) end() {
+	s.inflight.Add(-1)
+}
+
+// drain waits for every request that began pushing to end,
+// polling with exponential backoff as http.Server does.
+func (s *PushHandler) drain(ctx context.Context) error {
+	interval := time.Millisecond
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for s.inflight.Load() != 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			interval = min(2*interval, shutdownPollInterval)
+			timer.Reset(interval)
+		}
+	}
+
+	return nil
+}
+
+// Shutdown shuts down the default handler and that of
+// every host, returning the errors of each. See
+// PushHandler.Shutdown.
+func (hh *HostHandler) Shutdown(ctx context.Context) error {
+	err := hh.def.Shutdown(ctx)
+	for _, ph := range hh.hosts {
+		err = errors.Join(err, ph.Shutdown(ctx))
+	}
+
+	return err
+}
@@ -0,0 +1,173 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+// Package simulate replays recorded requests against the
+// bloom filter logic used by serverpush, so that filter
+// parameters and cookie lifetimes can be tuned offline.
+package simulate
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/willf/bloom"
+)
+
+// Request is a single recorded request.
+type Request struct {
+	// Client identifies the client that made the request.
+	// Each client is simulated with its own cookie.
+	Client string `json:"client"`
+	// Time is when the request was made.
+	Time time.Time `json:"time"`
+	// Targets are the preload links of the response.
+	Targets []string `json:"targets"`
+}
+
+// ReadRequests reads requests encoded as one JSON object
+// per line.
+func ReadRequests(r io.Reader) ([]Request, error) {
+	var reqs []Request
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+
+	for s.Scan() {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+
+		var req Request
+		if err := json.Unmarshal(s.Bytes(), &req); err != nil {
+			return nil, err
+		}
+
+		reqs = append(reqs, req)
+	}
+
+	return reqs, s.Err()
+}
+
+// Params are the parameters of a single simulation.
+type Params struct {
+	// M and K are the bloom filter parameters.
+	M, K uint
+	// MaxAge is the lifetime of the cookie. The cookie is
+	// renewed each time a resource is pushed. If zero, the
+	// cookie never expires.
+	MaxAge time.Duration
+}
+
+// Report summarises the result of a simulation.
+type Report struct {
+	Params
+
+	// Requests is the number of requests replayed.
+	Requests int
+	// Clients is the number of distinct clients.
+	Clients int
+	// Pushes is the number of resources pushed.
+	Pushes int
+	// Repushes is the number of pushes of a resource the
+	// client had already been pushed.
+	Repushes int
+	// Filtered is the number of links skipped because they
+	// were found in the bloom filter.
+	Filtered int
+	// FalsePositives is the number of filtered links that
+	// had never been pushed while the cookie was live.
+	FalsePositives int
+	// Expired is the number of times a client's cookie
+	// expired between requests.
+	Expired int
+}
+
+type client struct {
+	filter  *bloom.BloomFilter
+	exact   map[string]struct{}
+	ever    map[string]struct{}
+	lastSet time.Time
+}
+
+// Run replays reqs once for each of params. Requests are
+// replayed in time order.
+func Run(reqs []Request, params ...Params) []Report {
+	sorted := make([]Request, len(reqs))
+	copy(sorted, reqs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	reports := make([]Report, len(params))
+	for i, p := range params {
+		reports[i] = run(sorted, p)
+	}
+
+	return reports
+}
+
+func run(reqs []Request, p Params) Report {
+	rep := Report{
+		Params:   p,
+		Requests: len(reqs),
+	}
+
+	clients := make(map[string]*client)
+
+	for _, req := range reqs {
+		c := clients[req.Client]
+		if c == nil {
+			c = &client{
+				ever: make(map[string]struct{}),
+			}
+			clients[req.Client] = c
+		}
+
+		if c.filter != nil && p.MaxAge != 0 && req.Time.Sub(c.lastSet) > p.MaxAge {
+			c.filter = nil
+			rep.Expired++
+		}
+
+		if c.filter == nil {
+			c.filter = bloom.New(p.M, p.K)
+			c.exact = make(map[string]struct{})
+		}
+
+		var pushed bool
+		for _, target := range req.Targets {
+			if c.filter.TestString(target) {
+				rep.Filtered++
+
+				if _, ok := c.exact[target]; !ok {
+					rep.FalsePositives++
+				}
+
+				continue
+			}
+
+			c.filter.AddString(target)
+			c.exact[target] = struct{}{}
+			pushed = true
+
+			rep.Pushes++
+
+			if _, ok := c.ever[target]; ok {
+				rep.Repushes++
+			}
+
+			c.ever[target] = struct{}{}
+		}
+
+		if pushed {
+			c.lastSet = req.Time
+		}
+	}
+
+	rep.Clients = len(clients)
+	return rep
+}
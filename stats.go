@@ -0,0 +1,291 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Stats aggregates push decisions for each target. It is
+// safe for concurrent use and may be shared between
+// handlers. The zero value is ready to use.
+type Stats struct {
+	mu      sync.Mutex
+	targets map[string]*TargetStats
+	filter  FilterStats
+}
+
+// FilterStats count the loading and saving of bloom filter
+// cookies.
+type FilterStats struct {
+	Loads      uint64 `json:"loads"`
+	LoadErrors uint64 `json:"load_errors"`
+	Saves      uint64 `json:"saves"`
+	SaveErrors uint64 `json:"save_errors"`
+}
+
+// TargetStats are the aggregated push statistics for a
+// single target.
+type TargetStats struct {
+	Target string `json:"target"`
+
+	// Pushes is the number of times the target was pushed.
+	Pushes uint64 `json:"pushes"`
+	// Filtered is the number of times the target was
+	// skipped because it was found in the bloom filter.
+	Filtered uint64 `json:"filtered"`
+	// Errors is the number of times pushing the target
+	// failed.
+	Errors uint64 `json:"errors"`
+	// Observed is the number of times the target would
+	// have been pushed in observe only mode.
+	Observed uint64 `json:"observed"`
+	// OverBudget is the number of times the target was
+	// not pushed as it would have exceeded the push
+	// budget.
+	OverBudget uint64 `json:"over_budget"`
+	// Wasted is the number of times the target was
+	// requested by a client soon after it was pushed to
+	// it. See Options.WasteWindow.
+	Wasted uint64 `json:"wasted"`
+
+	// LastPushed is when the target was last pushed.
+	LastPushed time.Time `json:"last_pushed"`
+}
+
+// ErrorRate returns the fraction of push attempts that
+// failed.
+func (ts *TargetStats) ErrorRate() float64 {
+	attempts := ts.Pushes + ts.Errors
+	if attempts == 0 {
+		return 0
+	}
+
+	return float64(ts.Errors) / float64(attempts)
+}
+
+// WasteRate returns the estimated fraction of pushes of the
+// target that went unused, as the client requested the
+// target anyway. Targets with a high rate are candidates
+// for removal from the manifest.
+func (ts *TargetStats) WasteRate() float64 {
+	if ts.Pushes == 0 {
+		return 0
+	}
+
+	return min(float64(ts.Wasted)/float64(ts.Pushes), 1)
+}
+
+func (s *Stats) record(target string, outcome Outcome, now time.Time) {
+	switch outcome {
+	case Pushed, Filtered, Failed, Observed, OverBudget:
+	default:
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ts := s.target(target)
+
+	switch outcome {
+	case Pushed:
+		ts.Pushes++
+		ts.LastPushed = now
+	case Filtered:
+		ts.Filtered++
+	case Failed:
+		ts.Errors++
+	case Observed:
+		ts.Observed++
+	case OverBudget:
+		ts.OverBudget++
+	}
+}
+
+func (s *Stats) recordWasted(target string) {
+	s.mu.Lock()
+	s.target(target).Wasted++
+	s.mu.Unlock()
+}
+
+// wasteRate returns the WasteRate of target.
+func (s *Stats) wasteRate(target string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ts := s.targets[target]; ts != nil {
+		return ts.WasteRate()
+	}
+
+	return 0
+}
+
+// target returns the statistics of target, creating them
+// if needed. s.mu must be held.
+func (s *Stats) target(target string) *TargetStats {
+	ts := s.targets[target]
+	if ts == nil {
+		if s.targets == nil {
+			s.targets = make(map[string]*TargetStats)
+		}
+
+		ts = &TargetStats{Target: target}
+		s.targets[target] = ts
+	}
+
+	return ts
+}
+
+func (s *Stats) recordLoad(err error) {
+	s.mu.Lock()
+	s.filter.Loads++
+	if err != nil {
+		s.filter.LoadErrors++
+	}
+	s.mu.Unlock()
+}
+
+func (s *Stats) recordSave(err error) {
+	s.mu.Lock()
+	s.filter.Saves++
+	if err != nil {
+		s.filter.SaveErrors++
+	}
+	s.mu.Unlock()
+}
+
+// Filter returns the bloom filter cookie statistics.
+func (s *Stats) Filter() FilterStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filter
+}
+
+// Snapshot returns a copy of the statistics for every
+// target, ordered by descending push count.
+func (s *Stats) Snapshot() []TargetStats {
+	s.mu.Lock()
+	snap := make([]TargetStats, 0, len(s.targets))
+	for _, ts := range s.targets {
+		snap = append(snap, *ts)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(snap, func(i, j int) bool {
+		if snap[i].Pushes != snap[j].Pushes {
+			return snap[i].Pushes > snap[j].Pushes
+		}
+
+		return snap[i].Target < snap[j].Target
+	})
+	return snap
+}
+
+// Totals returns the sum of the statistics of every
+// target. The Target and LastPushed fields of the result
+// are empty.
+func (s *Stats) Totals() TargetStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var t TargetStats
+	for _, ts := range s.targets {
+		t.Pushes += ts.Pushes
+		t.Filtered += ts.Filtered
+		t.Errors += ts.Errors
+		t.Observed += ts.Observed
+		t.OverBudget += ts.OverBudget
+		t.Wasted += ts.Wasted
+	}
+
+	return t
+}
+
+// Reset discards all recorded statistics.
+func (s *Stats) Reset() {
+	s.mu.Lock()
+	s.targets = nil
+	s.filter = FilterStats{}
+	s.mu.Unlock()
+}
+
+// WriteJSON writes a snapshot of the statistics to w as a
+// JSON array.
+func (s *Stats) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s.Snapshot())
+}
+
+type statsResponse struct {
+	Totals  statsTotals   `json:"totals"`
+	Filter  FilterStats   `json:"filter"`
+	Targets []TargetStats `json:"targets"`
+}
+
+type statsTotals struct {
+	Targets    int    `json:"targets"`
+	Pushes     uint64 `json:"pushes"`
+	Filtered   uint64 `json:"filtered"`
+	Errors     uint64 `json:"errors"`
+	Observed   uint64 `json:"observed"`
+	OverBudget uint64 `json:"over_budget"`
+	Wasted     uint64 `json:"wasted"`
+}
+
+// Handler returns an http.Handler that reports the
+// statistics as JSON. The response includes the totals,
+// the bloom filter cookie statistics and the n most pushed
+// targets. The n query parameter overrides n for a single
+// request; n <= 0 reports every target.
+//
+// It is intended to be mounted on an internal port.
+func (s *Stats) Handler(n int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		top := n
+		if v := r.URL.Query().Get("n"); v != "" {
+			var err error
+			if top, err = strconv.Atoi(v); err != nil {
+				http.Error(w, "invalid n parameter", http.StatusBadRequest)
+				return
+			}
+		}
+
+		snap := s.Snapshot()
+
+		resp := statsResponse{
+			Filter: s.Filter(),
+		}
+
+		resp.Totals.Targets = len(snap)
+		for _, ts := range snap {
+			resp.Totals.Pushes += ts.Pushes
+			resp.Totals.Filtered += ts.Filtered
+			resp.Totals.Errors += ts.Errors
+			resp.Totals.Observed += ts.Observed
+			resp.Totals.OverBudget += ts.OverBudget
+			resp.Totals.Wasted += ts.Wasted
+		}
+
+		if top > 0 && top < len(snap) {
+			snap = snap[:top]
+		}
+
+		resp.Targets = snap
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		enc.Encode(&resp)
+	})
+}
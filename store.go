@@ -0,0 +1,156 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// FilterStore keeps the bloom filters of clients on the
+// server. See Options.FilterStore.
+//
+// Implementations must be safe for concurrent use. They
+// may broadcast saved filters to other instances, which
+// merge them into their own with FilterInfo.Union, to keep
+// push state roughly consistent across a cluster without
+// sticky sessions.
+type FilterStore interface {
+	// Load returns the filter stored under key, or nil if
+	// there is none.
+	Load(ctx context.Context, key string) (*FilterInfo, error)
+
+	// Save stores fi under key, replacing any filter that
+	// was stored before. fi must not be modified after it
+	// has been saved.
+	Save(ctx context.Context, key string, fi *FilterInfo) error
+}
+
+// MemoryStore is a FilterStore that keeps filters in
+// memory, forgetting those that have not been saved for
+// longer than its TTL.
+type MemoryStore struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	filters map[string]storedFilter
+	swept   time.Time
+}
+
+type storedFilter struct {
+	fi *FilterInfo
+	at time.Time
+}
+
+// NewMemoryStore returns a MemoryStore that forgets filters
+// that have not been saved for ttl, which should be the
+// MaxAge of the cookie.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{ttl: ttl}
+}
+
+// Load implements FilterStore.
+func (ms *MemoryStore) Load(ctx context.Context, key string) (*FilterInfo, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	sf, ok := ms.filters[key]
+	if !ok || time.Since(sf.at) > ms.ttl {
+		return nil, nil
+	}
+
+	return sf.fi, nil
+}
+
+// Save implements FilterStore.
+func (ms *MemoryStore) Save(ctx context.Context, key string, fi *FilterInfo) error {
+	now := time.Now()
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.filters == nil {
+		ms.filters = make(map[string]storedFilter)
+	}
+
+	if now.Sub(ms.swept) > ms.ttl {
+		for k, sf := range ms.filters {
+			if now.Sub(sf.at) > ms.ttl {
+				delete(ms.filters, k)
+			}
+		}
+
+		ms.swept = now
+	}
+
+	ms.filters[key] = storedFilter{fi, now}
+	return nil
+}
+
+// loadStoredFilter merges the filter kept in the
+// FilterStore for the client into the filter loaded from
+// its cookie. A stored filter with other parameters or of
+// another generation is ignored.
+func (w *pushResponseWriter) loadStoredFilter() {
+	key := w.storeKey()
+	if key == "" {
+		return
+	}
+
+	fi, err := w.opts.filterStore.Load(w.req.Context(), key)
+	if err != nil {
+		w.opts.logError(w.req, "error loading stored bloom filter", err, slog.String("key", key))
+		return
+	}
+
+	if fi == nil || fi.Generation != w.opts.generation() ||
+		fi.f.Cap() != w.bloom.Cap() || fi.f.K() != w.bloom.K() {
+		return
+	}
+
+	w.bloom.Merge(fi.f)
+	if w.opts.ttlBucket > 0 {
+		w.currentBucket().Merge(fi.f)
+	}
+
+	// The exact set does not hold the stored targets.
+	w.exactMode = false
+}
+
+// saveStoredFilter saves a copy of the client's filter to
+// the FilterStore.
+func (w *pushResponseWriter) saveStoredFilter() {
+	key := w.storeKey()
+	if key == "" {
+		return
+	}
+
+	f := w.bloom.Copy()
+	fi := &FilterInfo{
+		M:          f.Cap(),
+		K:          f.K(),
+		FillRatio:  fillRatio(f),
+		Generation: w.opts.generation(),
+
+		f: f,
+	}
+
+	if err := w.opts.filterStore.Save(w.req.Context(), key, fi); err != nil {
+		w.opts.logError(w.req, "error saving stored bloom filter", err, slog.String("key", key))
+	}
+}
+
+// storeKey returns the key of the client's filter in the
+// FilterStore, or an empty string if it has none.
+func (w *pushResponseWriter) storeKey() string {
+	if w.opts.filterStore == nil {
+		return ""
+	}
+
+	return w.opts.storeKey(w.req)
+}
@@ -0,0 +1,120 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// stripResponseWriter removes the headers of the push
+// handler that must not reach the client: X-H2-Pushed, if
+// pushed is set, and that set by NoPushRedirect, which is
+// recorded in result.
+type stripResponseWriter struct {
+	http.ResponseWriter
+
+	pushed bool
+	result *Result
+
+	wroteHeader bool
+}
+
+func (w *stripResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = !isInformational(code)
+
+		if w.pushed {
+			w.Header().Del(pushedHeader)
+		}
+
+		takeNoPushRedirect(w.Header(), w.result)
+	}
+
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *stripResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *stripResponseWriter) WriteString(s string) (n int, err error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return io.WriteString(w.ResponseWriter, s)
+}
+
+func (w *stripResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *stripResponseWriter) Push(target string, opts *http.PushOptions) error {
+	return w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+func (w *stripResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *stripResponseWriter) CloseNotify() <-chan bool {
+	return w.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
+func (w *stripResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		w.wroteHeader = true
+	}
+
+	return conn, brw, err
+}
+
+func (w *stripResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.(io.ReaderFrom).ReadFrom(r)
+}
+
+// Strip wraps the given http.Handler, such as a reverse
+// proxy to an untrusted upstream, so that the sentinel
+// header is removed from requests before they reach it
+// and the X-H2-Pushed header is removed from responses
+// before they reach the client.
+func (s Sentinel) Strip(h http.Handler) Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Header[s.name]; ok {
+			r = r.Clone(r.Context())
+			r.Header.Del(s.name)
+		}
+
+		srw := &stripResponseWriter{ResponseWriter: w, pushed: true}
+		h.ServeHTTP(wrapWriter(srw, w), r)
+	})
+}
+
+// passThrough serves r with the wrapped handler without
+// pushing, removing the header set by NoPushRedirect.
+func (s *PushHandler) passThrough(w http.ResponseWriter, r *http.Request, res *Result) {
+	srw := &stripResponseWriter{ResponseWriter: w, result: res}
+	s.Handler.ServeHTTP(wrapWriter(srw, w), r)
+}
+
+// Strip is like Sentinel.Strip for the default sentinel.
+func Strip(h http.Handler) Handler {
+	return DefaultSentinel.Strip(h)
+}
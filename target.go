@@ -0,0 +1,183 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+var errUnsafeTarget = errors.New("go-server-push: unsafe push target")
+
+// cleanTarget returns the canonical form of a push target,
+// which is either an absolute path or an absolute http or
+// https URL, or false if it must not be pushed.
+//
+// Targets containing backslashes, spaces or control
+// characters, malformed percent-encoding, or userinfo, or
+// whose dot-segments would climb above the root, are
+// rejected. Percent-encoded unreserved characters are
+// decoded and the hex digits of the rest made upper case,
+// before dot-segments are removed, so that equivalent
+// targets are filtered and pushed alike.
+func cleanTarget(target string) (string, bool) {
+	if strings.IndexFunc(target, isUnsafeLocationRune) >= 0 {
+		return "", false
+	}
+
+	var origin string
+	switch {
+	case strings.HasPrefix(target, "//"):
+		return "", false
+	case strings.HasPrefix(target, "/"):
+	default:
+		u, err := url.Parse(target)
+		if err != nil || u.User != nil || u.Host == "" || u.Opaque != "" {
+			return "", false
+		}
+
+		switch strings.ToLower(u.Scheme) {
+		case "http", "https":
+		default:
+			return "", false
+		}
+
+		i := len(u.Scheme) + len("://") + len(u.Host)
+		if !strings.HasPrefix(target[i:], "/") {
+			return "", false
+		}
+
+		origin, target = target[:i], target[i:]
+	}
+
+	target, ok := canonicalPercent(target)
+	if !ok {
+		return "", false
+	}
+
+	path, query := target, ""
+	if i := strings.IndexAny(target, "?#"); i >= 0 {
+		path, query = target[:i], target[i:]
+	}
+
+	if path, ok = removeDotSegments(path); !ok {
+		return "", false
+	}
+
+	return origin + path + query, true
+}
+
+// rewrite applies Options.RewriteTarget to target. It
+// returns target unchanged if there is none, and false if
+// the target must not be pushed.
+func (o *options) rewrite(target string) (string, bool) {
+	if o.rewriteTarget == nil {
+		return target, true
+	}
+
+	rewritten, ok := o.rewriteTarget(target)
+	if !ok {
+		return target, false
+	}
+
+	return rewritten, true
+}
+
+// canonicalPercent decodes percent-encoded unreserved
+// characters in s and upper cases the hex digits of the
+// remaining escapes. It returns s unchanged if there is
+// nothing to do.
+func canonicalPercent(s string) (string, bool) {
+	i := strings.IndexByte(s, '%')
+	if i < 0 {
+		return s, true
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+	b.WriteString(s[:i])
+
+	for ; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		if i+2 >= len(s) || !ishex(s[i+1]) || !ishex(s[i+2]) {
+			return "", false
+		}
+
+		c := unhex(s[i+1])<<4 | unhex(s[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			const hex = "0123456789ABCDEF"
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+
+		i += 2
+	}
+
+	return b.String(), true
+}
+
+// removeDotSegments removes the . and .. segments of the
+// absolute path p, as in RFC 3986, section 5.2.4, but
+// reports false if a .. segment would climb above the
+// root.
+func removeDotSegments(p string) (string, bool) {
+	if !strings.Contains(p, "/.") {
+		return p, true
+	}
+
+	segs := strings.Split(p[1:], "/")
+	out := segs[:0]
+	for i, seg := range segs {
+		last := i == len(segs)-1
+
+		switch seg {
+		case ".":
+		case "..":
+			if len(out) == 0 {
+				return "", false
+			}
+
+			out = out[:len(out)-1]
+		default:
+			out = append(out, seg)
+			continue
+		}
+
+		if last {
+			out = append(out, "")
+		}
+	}
+
+	return "/" + strings.Join(out, "/"), true
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+		'0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0
+}
+
+func ishex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+	"text/template/parse"
+
+	"golang.org/x/net/html"
+)
+
+// TemplateFuncs returns functions for use in html/template
+// templates that keep preload markup and server push in
+// sync. It provides:
+//
+//	preload "style" "/app.css"
+//
+// which renders a <link rel="preload"> element for the
+// resource and pushes it with PusherFor, so it is pushed
+// at most once per client even though the response
+// headers may already have been written. Fonts are marked
+// crossorigin as browsers require.
+//
+// The functions are bound to a single response. Register
+// them when parsing with nil arguments and rebind a clone
+// of the template for each request:
+//
+//	t := template.Must(template.New("").Funcs(serverpush.TemplateFuncs(nil, nil)).Parse(src))
+//
+//	t, _ := t.Clone()
+//	t.Funcs(serverpush.TemplateFuncs(w, r)).Execute(w, data)
+func TemplateFuncs(w http.ResponseWriter, r *http.Request) template.FuncMap {
+	return template.FuncMap{
+		"preload": func(as, target string) template.HTML {
+			if w != nil && r != nil && strings.HasPrefix(target, "/") {
+				if p := PusherFor(w, r); p != nil {
+					// Errors are recorded by the push
+					// handler and the element still lets
+					// the client preload the resource.
+					p.Push(target, nil)
+				}
+			}
+
+			return preloadElement(as, target)
+		},
+	}
+}
+
+func preloadElement(as, target string) template.HTML {
+	var b strings.Builder
+	b.WriteString(`<link rel="preload" href="`)
+	b.WriteString(template.HTMLEscapeString(target))
+	b.WriteString(`" as="`)
+	b.WriteString(template.HTMLEscapeString(as))
+	b.WriteByte('"')
+
+	if as == "font" {
+		b.WriteString(" crossorigin")
+	}
+
+	b.WriteByte('>')
+	return template.HTML(b.String())
+}
+
+// templateAction stands in for the actions of a template
+// when its text is tokenized, so that attributes whose
+// values are computed can be recognised.
+const templateAction = "{{}}"
+
+// TemplateResources returns the resources that t always
+// references: the stylesheets, scripts and preloads in its
+// text whose src or href is a literal absolute path, and
+// the literal targets of preload functions from
+// TemplateFuncs. The templates that t invokes are included.
+//
+// It is intended to be called once templates are parsed,
+// to populate a Manifest without a build tool:
+//
+//	m.Set("/", serverpush.TemplateResources(t.Lookup("index.html"))...)
+func TemplateResources(t *template.Template) []Resource {
+	var ts templateScan
+	ts.walk(t, t.Tree)
+
+	var resources []Resource
+	seen := make(map[string]bool)
+
+	add := func(href, as string) {
+		if !strings.HasPrefix(href, "/") || strings.HasPrefix(href, "//") ||
+			strings.Contains(href, templateAction) || seen[href] {
+			return
+		}
+
+		seen[href] = true
+		resources = append(resources, Resource{Path: href, As: as})
+	}
+
+	z := html.NewTokenizer(strings.NewReader(ts.text.String()))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+
+		if tt == html.StartTagToken || tt == html.SelfClosingTagToken {
+			add(tagResource(z.Token()))
+		}
+	}
+
+	for _, p := range ts.preloads {
+		add(p[1], p[0])
+	}
+
+	return resources
+}
+
+type templateScan struct {
+	text     strings.Builder
+	preloads [][2]string
+	visited  map[string]bool
+}
+
+func (ts *templateScan) walk(t *template.Template, tree *parse.Tree) {
+	if tree == nil || tree.Root == nil {
+		return
+	}
+
+	if ts.visited == nil {
+		ts.visited = make(map[string]bool)
+	}
+
+	if ts.visited[tree.ParseName+"\x00"+tree.Name] {
+		return
+	}
+
+	ts.visited[tree.ParseName+"\x00"+tree.Name] = true
+	ts.node(t, tree.Root)
+}
+
+func (ts *templateScan) node(t *template.Template, n parse.Node) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+
+		for _, c := range n.Nodes {
+			ts.node(t, c)
+		}
+	case *parse.TextNode:
+		ts.text.Write(n.Text)
+	case *parse.ActionNode:
+		ts.text.WriteString(templateAction)
+		ts.pipe(n.Pipe)
+	case *parse.IfNode:
+		ts.branch(t, &n.BranchNode)
+	case *parse.RangeNode:
+		ts.branch(t, &n.BranchNode)
+	case *parse.WithNode:
+		ts.branch(t, &n.BranchNode)
+	case *parse.TemplateNode:
+		ts.text.WriteString(templateAction)
+
+		if tt := t.Lookup(n.Name); tt != nil {
+			ts.walk(t, tt.Tree)
+		}
+	}
+}
+
+func (ts *templateScan) branch(t *template.Template, n *parse.BranchNode) {
+	ts.text.WriteString(templateAction)
+	ts.node(t, n.List)
+
+	if n.ElseList != nil {
+		ts.node(t, n.ElseList)
+	}
+}
+
+// pipe records calls of the form preload "as" "/target".
+func (ts *templateScan) pipe(p *parse.PipeNode) {
+	if p == nil {
+		return
+	}
+
+	for _, cmd := range p.Cmds {
+		if len(cmd.Args) != 3 {
+			continue
+		}
+
+		id, ok := cmd.Args[0].(*parse.IdentifierNode)
+		as, ok1 := cmd.Args[1].(*parse.StringNode)
+		target, ok2 := cmd.Args[2].(*parse.StringNode)
+		if ok && ok1 && ok2 && id.Ident == "preload" {
+			ts.preloads = append(ts.preloads, [2]string{as.Text, target.Text})
+		}
+	}
+}
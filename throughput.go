@@ -0,0 +1,83 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	// minDeliveryBytes is the smallest response that is
+	// timed, as the time to write smaller responses is
+	// dominated by buffering rather than the connection.
+	minDeliveryBytes = 16 << 10
+
+	// minThroughputBytes is the number of bytes that must
+	// have been timed on a connection before its
+	// throughput is reported.
+	minThroughputBytes = 64 << 10
+)
+
+// recordDelivery adds a response of n bytes that took d to
+// write to the throughput of the connection.
+func (cf *connFilters) recordDelivery(n int64, d time.Duration) {
+	if n < minDeliveryBytes || d <= 0 {
+		return
+	}
+
+	cf.deliveredBytes.Add(n)
+	cf.deliveryNanos.Add(int64(d))
+}
+
+func (cf *connFilters) throughput() (bytesPerSecond float64, ok bool) {
+	n, d := cf.deliveredBytes.Load(), cf.deliveryNanos.Load()
+	if n < minThroughputBytes || d <= 0 {
+		return 0, false
+	}
+
+	return float64(n) / time.Duration(d).Seconds(), true
+}
+
+// ConnThroughput returns the rate, in bytes per second, at
+// which the bodies of the responses wrapped by the push
+// handler have been written on the connection r was made
+// on. It reports false unless ConnContext is in use and
+// enough has been written on the connection to judge. It
+// may be used by Options.SupportsPush, and is used by
+// Options.MinThroughput, to avoid pushing to clients on
+// slow connections without relying on client hints.
+func ConnThroughput(r *http.Request) (bytesPerSecond float64, ok bool) {
+	cf := connFiltersFromContext(r.Context())
+	if cf == nil {
+		return 0, false
+	}
+
+	return cf.throughput()
+}
+
+// slowConn reports whether r was made on a connection
+// slower than Options.MinThroughput.
+func (o *options) slowConn(r *http.Request) bool {
+	if o.minThroughput <= 0 {
+		return false
+	}
+
+	bps, ok := ConnThroughput(r)
+	return ok && bps < o.minThroughput
+}
+
+// recordDelivery records the time taken to write the body
+// of the response to the throughput of its connection.
+func (w *pushResponseWriter) recordDelivery() {
+	if w.bodyStart.IsZero() {
+		return
+	}
+
+	if cf := connFiltersFromContext(w.req.Context()); cf != nil {
+		cf.recordDelivery(w.written, w.opts.clock.Now().Sub(w.bodyStart))
+	}
+}
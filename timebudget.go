@@ -0,0 +1,31 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+// overTimeBudget reports whether the pushes made for the
+// response have taken longer than Options.PushTimeBudget.
+// The PushTimeExceeded hook is called the first time they
+// have.
+func (w *pushResponseWriter) overTimeBudget() bool {
+	if w.opts.pushTimeBudget <= 0 || w.pushStart.IsZero() || w.opts.edgePush {
+		return false
+	}
+
+	elapsed := w.opts.clock.Now().Sub(w.pushStart)
+	if elapsed < w.opts.pushTimeBudget {
+		return false
+	}
+
+	if !w.overTime {
+		w.overTime = true
+
+		if hooks := w.opts.hooks; hooks != nil && hooks.PushTimeExceeded != nil {
+			hooks.PushTimeExceeded(w.req, elapsed)
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,53 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import "context"
+
+type pushTraceKey struct{}
+
+// PushTrace is a set of hooks to run at various stages of
+// the push handler for a single request. Any particular
+// hook may be nil.
+//
+// It mirrors net/http/httptrace.ClientTrace and is
+// attached to a request's context with WithPushTrace.
+type PushTrace struct {
+	// GotLinks is called with the Link header values of
+	// the response before any are considered for push.
+	GotLinks func(links []string)
+
+	// FilterLoaded is called after the bloom filter has
+	// been loaded from the request cookie. err is non-nil
+	// if the cookie could not be decoded, in which case an
+	// empty filter is used.
+	FilterLoaded func(err error)
+
+	// PushStart is called before target is pushed.
+	PushStart func(target string)
+
+	// PushDone is called after target has been pushed
+	// with the error returned by Push, if any.
+	PushDone func(target string, err error)
+
+	// FilterSaved is called after the bloom filter has
+	// been saved to the response cookie.
+	FilterSaved func(err error)
+}
+
+// WithPushTrace returns a new context based on the
+// provided parent ctx. Responses served with the returned
+// context will use the provided trace hooks.
+func WithPushTrace(ctx context.Context, trace *PushTrace) context.Context {
+	return context.WithValue(ctx, pushTraceKey{}, trace)
+}
+
+// ContextPushTrace returns the PushTrace associated with
+// the provided context. If none, it returns nil.
+func ContextPushTrace(ctx context.Context) *PushTrace {
+	trace, _ := ctx.Value(pushTraceKey{}).(*PushTrace)
+	return trace
+}
@@ -0,0 +1,186 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/willf/bloom"
+)
+
+// bucketsPrefix marks a cookie value holding a bloom filter
+// for each of the most recent time buckets. It is in the
+// alphabet of neither base64 encoding nor is it
+// compactPrefix or exactPrefix.
+const bucketsPrefix = "^"
+
+// The bucketed encoding is bucketsPrefix followed by the
+// base 36 index of the current bucket, the number of
+// Options.TTLBucket intervals since the Unix epoch, and
+// then, for each bucket from the current one back, a "."
+// and the bucket's filter in the compact encoding, or
+// nothing if the bucket is empty. Trailing empty buckets
+// are omitted.
+
+var errMalformedBuckets = errors.New("go-server-push: malformed bucketed bloom filter")
+
+// bucketIndex returns the index of the bucket holding
+// targets added at t.
+func (o *options) bucketIndex(t time.Time) int64 {
+	return t.UnixNano() / int64(o.ttlBucket)
+}
+
+// encodeBuckets encodes the filters of each bucket, from
+// that with index now back, into a cookie value.
+func encodeBuckets(now int64, buckets []*bloom.BloomFilter) (string, error) {
+	for len(buckets) != 0 && buckets[len(buckets)-1] == nil {
+		buckets = buckets[:len(buckets)-1]
+	}
+
+	var b strings.Builder
+	b.WriteString(bucketsPrefix)
+	b.WriteString(strconv.FormatInt(now, 36))
+
+	for _, f := range buckets {
+		b.WriteByte('.')
+
+		if f == nil {
+			continue
+		}
+
+		v, err := encodeCompact(f)
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(v)
+	}
+
+	return b.String(), nil
+}
+
+// decodeBuckets decodes the filters of each bucket, without
+// bucketsPrefix, shifted so that the first is the bucket
+// with index now, or the current bucket of the cookie if
+// now is negative. Buckets older than the last of keep
+// are dropped. It also returns the union of the buckets, as
+// for decodeFilterPooled. All buckets must have the same
+// parameters, which are those of the union.
+//
+// The index of the cookie's current bucket is chosen by the
+// client, so it is rejected if it is negative or after now.
+func decodeBuckets(value string, m, k uint, now int64, keep int) (buckets []*bloom.BloomFilter, f *bloom.BloomFilter, fw *filterWords, err error) {
+	epoch, value, _ := strings.Cut(value, ".")
+
+	then, err := strconv.ParseInt(epoch, 36, 64)
+	if err != nil || then < 0 || now >= 0 && then > now {
+		return nil, nil, nil, errMalformedBuckets
+	}
+
+	// Both now and then are non-negative here, so now-then
+	// cannot overflow, and the shift is at most keep.
+	shift := 0
+	if now >= 0 {
+		shift = int(min(now-then, int64(keep)))
+	}
+
+	var fm, fk uint
+	for i, v := 0, value; v != ""; i++ {
+		var bucket string
+		bucket, v, _ = strings.Cut(v, ".")
+
+		if i+shift >= keep {
+			break
+		}
+
+		buckets = append(buckets, nil)
+		if bucket == "" {
+			continue
+		}
+
+		compact, ok := strings.CutPrefix(bucket, compactPrefix)
+		if !ok {
+			return nil, nil, nil, errMalformedBuckets
+		}
+
+		// A k of zero keeps the bits of the bucket out of
+		// filterPool, as only the union is released.
+		bf, _, err := decodeCompact(compact, m, 0)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if fm == 0 {
+			fm, fk = bf.Cap(), bf.K()
+		} else if bf.Cap() != fm || bf.K() != fk {
+			return nil, nil, nil, errMalformedBuckets
+		}
+
+		buckets[i] = bf
+	}
+
+	if fm == 0 {
+		fm, fk = m, k
+	}
+
+	if len(buckets) != 0 {
+		buckets = append(make([]*bloom.BloomFilter, shift, shift+len(buckets)), buckets...)
+	}
+
+	f, fw = newFilter(fm, fk)
+	for _, bf := range buckets {
+		if bf != nil {
+			f.Merge(bf)
+		}
+	}
+
+	return buckets, f, fw, nil
+}
+
+// testBuckets reports whether path was added to the client's
+// filter recently enough to still be cached, according to
+// Options.TargetTTL.
+func (w *pushResponseWriter) testBuckets(path string) bool {
+	ttl := w.opts.targetTTL(path)
+	if ttl <= 0 {
+		return w.bloom.TestString(path)
+	}
+
+	n := int((ttl + w.opts.ttlBucket - 1) / w.opts.ttlBucket)
+	for i, f := range w.buckets {
+		if i >= n {
+			break
+		}
+
+		if f != nil && f.TestString(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addBucket adds path to the filter of the current bucket.
+func (w *pushResponseWriter) addBucket(path string) {
+	w.currentBucket().AddString(path)
+}
+
+// currentBucket returns the filter of the current bucket,
+// creating it if it is empty.
+func (w *pushResponseWriter) currentBucket() *bloom.BloomFilter {
+	if len(w.buckets) == 0 {
+		w.buckets = append(w.buckets, nil)
+	}
+
+	if w.buckets[0] == nil {
+		w.buckets[0] = bloom.New(w.bloom.Cap(), w.bloom.K())
+	}
+
+	return w.buckets[0]
+}
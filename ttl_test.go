@@ -0,0 +1,123 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/willf/bloom"
+)
+
+// testBucket returns a bucket filter holding paths.
+func testBucket(m, k uint, paths ...string) *bloom.BloomFilter {
+	f := bloom.New(m, k)
+	for _, p := range paths {
+		f.AddString(p)
+	}
+
+	return f
+}
+
+func TestBucketsRoundTrip(t *testing.T) {
+	a := testBucket(1024, 4, "/a.css")
+	b := testBucket(1024, 4, "/b.js", "/c.js")
+	c := testBucket(1024, 4, "/d.png")
+
+	for _, tc := range []struct {
+		name    string
+		buckets []*bloom.BloomFilter
+		now     int64 // for decoding; encoded at 100
+		keep    int
+		want    []*bloom.BloomFilter
+	}{
+		{"none", nil, 100, 4, nil},
+		{"all empty", []*bloom.BloomFilter{nil, nil}, 100, 4, nil},
+		{"current", []*bloom.BloomFilter{a}, 100, 4, []*bloom.BloomFilter{a}},
+		{"gap", []*bloom.BloomFilter{a, nil, b}, 100, 4, []*bloom.BloomFilter{a, nil, b}},
+		{"trailing empty", []*bloom.BloomFilter{a, b, nil, nil}, 100, 4, []*bloom.BloomFilter{a, b}},
+		{"leading empty", []*bloom.BloomFilter{nil, b}, 100, 4, []*bloom.BloomFilter{nil, b}},
+		{"cookie's own now", []*bloom.BloomFilter{a, b}, -1, 4, []*bloom.BloomFilter{a, b}},
+		{"shifted", []*bloom.BloomFilter{a, b}, 101, 4, []*bloom.BloomFilter{nil, a, b}},
+		{"shifted past keep", []*bloom.BloomFilter{a, b, c}, 102, 4, []*bloom.BloomFilter{nil, nil, a, b}},
+		{"beyond keep", []*bloom.BloomFilter{a, b, c}, 100, 2, []*bloom.BloomFilter{a, b}},
+		{"all expired", []*bloom.BloomFilter{a, b}, 200, 4, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := encodeBuckets(100, tc.buckets)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body, ok := strings.CutPrefix(v, bucketsPrefix)
+			if !ok {
+				t.Fatalf("encodeBuckets = %q, missing %q prefix", v, bucketsPrefix)
+			}
+
+			buckets, union, _, err := decodeBuckets(body, 1024, 4, tc.now, tc.keep)
+			if err != nil {
+				t.Fatalf("decodeBuckets(%q): %v", body, err)
+			}
+
+			// Trailing empty buckets are not significant.
+			for len(buckets) != 0 && buckets[len(buckets)-1] == nil {
+				buckets = buckets[:len(buckets)-1]
+			}
+
+			if len(buckets) != len(tc.want) {
+				t.Fatalf("decoded %d buckets, want %d", len(buckets), len(tc.want))
+			}
+
+			want := bloom.New(1024, 4)
+			for i, f := range tc.want {
+				if (buckets[i] == nil) != (f == nil) || f != nil && !buckets[i].Equal(f) {
+					t.Errorf("bucket %d differs", i)
+				}
+
+				if f != nil {
+					want.Merge(f)
+				}
+			}
+
+			if !union.Equal(want) {
+				t.Error("union differs from the decoded buckets")
+			}
+		})
+	}
+}
+
+func TestBucketsMalformed(t *testing.T) {
+	a, err := encodeCompact(testBucket(1024, 4, "/a.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := encodeCompact(testBucket(2048, 4, "/b.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		value string
+	}{
+		{"empty", ""},
+		{"bad index", "z!." + a},
+		{"negative index", "-1." + a},
+		{"future index", "2t." + a},
+		{"missing compact prefix", "2s." + a[len(compactPrefix):]},
+		{"exact bucket", "2s.!" + a[len(compactPrefix):]},
+		{"malformed bucket", "2s.~*"},
+		{"mismatched buckets", "2s." + a + "." + other},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// 2s is 100 in base 36.
+			if _, _, _, err := decodeBuckets(tc.value, 4096, 4, 100, 4); err == nil {
+				t.Errorf("decodeBuckets(%q) succeeded", tc.value)
+			}
+		})
+	}
+}
@@ -5,12 +5,28 @@
 
 package serverpush
 
-import "net/http"
+import (
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/gddo/httputil/header"
+)
 
 const (
-	sentinelHeader    = "X-H2-Push"
 	pushedHeader      = "X-H2-Pushed"
 	defaultCookieName = "X-H2-Push"
+	serverTimingName  = "h2push"
+
+	// redirectsCookieName names the default cookie of
+	// NewRedirects, which must not be that of New as their
+	// filters are usually of different sizes.
+	redirectsCookieName = "X-H2-Push-Redirects"
+
+	noPushRedirectHeader = "X-H2-Nopush-Redirect"
 )
 
 var proxyHeaders = []string{
@@ -20,23 +36,123 @@ var proxyHeaders = []string{
 	"User-Agent",
 }
 
-func headers(opts *http.PushOptions, r *http.Request) http.Header {
-	h := make(http.Header, len(opts.Header)+len(proxyHeaders)+1)
-	for k, v := range opts.Header {
+// DefaultProxyHeaders returns the request headers that are
+// copied onto pushed requests by default. The returned
+// slice is a copy and may be modified.
+func DefaultProxyHeaders() []string {
+	return append([]string(nil), proxyHeaders...)
+}
+
+// DefaultCookie returns the cookie used to store the bloom
+// filter when Options.Cookie is nil: X-H2-Push with a
+// MaxAge of 90 days, Secure and HttpOnly. A new cookie is
+// returned on each call, so it may be modified and used as
+// Options.Cookie.
+func DefaultCookie() *http.Cookie {
+	return &http.Cookie{
+		Name: defaultCookieName,
+
+		MaxAge:   7776000,
+		Secure:   true,
+		HttpOnly: true,
+	}
+}
+
+// isInformational reports whether code is that of a 1xx
+// response that precedes the final response, such as 103
+// Early Hints relayed from an upstream.
+func isInformational(code int) bool {
+	return code >= 100 && code < 200 && code != http.StatusSwitchingProtocols
+}
+
+func canonicalHeaders(names []string) []string {
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = textproto.CanonicalMIMEHeaderKey(name)
+	}
+
+	return out
+}
+
+// headerPool holds the maps used for the headers of pushed
+// requests, so that building them does not allocate once
+// the pool is warm. The values are shared with the static
+// push options and the request, and are never modified.
+var headerPool = sync.Pool{
+	New: func() any { return make(http.Header, 8) },
+}
+
+// headers returns the header of requests pushed for r: the
+// precomputed header of the push options, overridden by
+// ctx and then by the headers of r that are proxied. If
+// nothing is layered on top, and there is no request ID
+// to add, the precomputed header itself is returned.
+// Otherwise the map is taken from headerPool and pooled is
+// true.
+func (o *options) headers(ctx http.Header, r *http.Request) (h http.Header, pooled bool) {
+	h = o.pushOptions.Header
+	if len(ctx) == 0 && !o.proxiesAny(r) && o.requestIDHeader == "" {
+		return h, false
+	}
+
+	base := h
+	h = headerPool.Get().(http.Header)
+	for k, v := range base {
+		h[k] = v
+	}
+
+	for k, v := range ctx {
 		h[k] = v
 	}
 
-	for _, k := range proxyHeaders {
-		h[k] = r.Header[k]
+	for _, k := range o.proxyHeaders {
+		if v, ok := r.Header[k]; ok {
+			h[k] = v
+		}
+	}
+
+	return h, true
+}
+
+func (o *options) proxiesAny(r *http.Request) bool {
+	for _, k := range o.proxyHeaders {
+		if _, ok := r.Header[k]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// releaseHeader returns the header of the push options to
+// headerPool once the response is complete. The Push
+// methods of net/http and golang.org/x/net/http2 copy the
+// header of a push before returning, so it is not retained.
+func (w *pushResponseWriter) releaseHeader() {
+	h := w.pushOpts.Header
+	if !w.pooled {
+		return
 	}
 
-	h.Set(sentinelHeader, "1")
-	return h
+	w.pushOpts.Header, w.pooled = nil, false
+
+	clear(h)
+	headerPool.Put(h)
 }
 
-// IsPush returns true iff the request was pushed by this
-// package.
-func IsPush(r *http.Request) bool {
-	_, isPush := r.Header[sentinelHeader]
-	return isPush
+func serverTiming(pushed int, d time.Duration) string {
+	ms := strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 1, 64)
+	return serverTimingName + `;desc="` + strconv.Itoa(pushed) + ` pushed";dur=` + ms
+}
+
+// addVary adds name to the Vary header of h, unless it, or
+// *, is already listed.
+func addVary(h http.Header, name string) {
+	for _, v := range header.ParseList(h, "Vary") {
+		if v == "*" || strings.EqualFold(v, name) {
+			return
+		}
+	}
+
+	h.Add("Vary", name)
 }
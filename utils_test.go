@@ -0,0 +1,41 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func BenchmarkHeaders(b *testing.B) {
+	for _, bc := range []struct {
+		name   string
+		header http.Header
+	}{
+		{"static", nil},
+		{"proxied", http.Header{
+			"Accept-Encoding": {"gzip, br"},
+			"Accept-Language": {"en-AU"},
+			"User-Agent":      {"bench"},
+		}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			o := New(1<<16, 4, nil, nil).opts.Load()
+
+			r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+			r.Header = bc.header
+
+			w := &pushResponseWriter{opts: o, req: r}
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				w.pushOpts.Header, w.pooled = o.headers(nil, r)
+				w.releaseHeader()
+			}
+		})
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/textproto"
+	"slices"
+	"strings"
+)
+
+// Validate reports whether the bloom filter parameters and
+// Options describe a handler that is able to push. All of
+// the problems found are returned together.
+//
+// New and Wrapper log the error and construct a handler
+// that passes requests through without pushing, while
+// NewWithConfig, SetOptions and Update return it.
+func Validate(m, k uint, opts *Options) error {
+	var errs []error
+	fail := func(format string, v ...interface{}) {
+		errs = append(errs, fmt.Errorf("go-server-push: "+format, v...))
+	}
+
+	switch {
+	case m == 0:
+		fail("bloom filter must have at least one bit")
+	case k == 0:
+		fail("bloom filter must have at least one hash function")
+	case k > m:
+		fail("bloom filter has more hash functions (%d) than bits (%d), m and k may be swapped", k, m)
+	}
+
+	if opts == nil {
+		return errors.Join(errs...)
+	}
+
+	if c := opts.Cookie; c != nil {
+		if !validHeaderName(c.Name) {
+			fail("invalid cookie name %q", c.Name)
+		}
+
+		if c.MaxAge < 0 {
+			fail("cookie has negative MaxAge and would never be stored")
+		}
+
+		if opts.Cleartext && c.Secure {
+			fail("Cleartext is set but the cookie is Secure and would never be sent over h2c")
+		}
+	}
+
+	if opts.FilterStore != nil && opts.StoreKey == nil {
+		fail("FilterStore is set without StoreKey")
+	}
+
+	if po := opts.PushOptions; po != nil &&
+		po.Method != "" && po.Method != http.MethodGet && po.Method != http.MethodHead {
+		fail("push method %q is neither GET nor HEAD", po.Method)
+	}
+
+	sentinel := DefaultSentinel.name
+	if opts.SentinelHeader != "" {
+		if !validHeaderName(opts.SentinelHeader) {
+			fail("invalid sentinel header %q", opts.SentinelHeader)
+		}
+
+		sentinel = textproto.CanonicalMIMEHeaderKey(opts.SentinelHeader)
+	}
+
+	for _, name := range opts.ProxyHeaders {
+		if !validHeaderName(name) {
+			fail("invalid proxy header %q", name)
+		} else if textproto.CanonicalMIMEHeaderKey(name) == sentinel {
+			fail("proxy header %q is the sentinel header", name)
+		}
+	}
+
+	policy := newHeaderPolicy(opts.AllowHeaders, opts.DenyHeaders)
+	if opts.ForwardCookie && !policy.allowed("Cookie") {
+		fail("ForwardCookie is set but Cookie is not an allowed header")
+	}
+
+	if opts.ForwardAuthorization && !policy.allowed("Authorization") {
+		fail("ForwardAuthorization is set but Authorization is not an allowed header")
+	}
+
+	if opts.PushedCountHeader != "" && !validHeaderName(opts.PushedCountHeader) {
+		fail("invalid pushed count header %q", opts.PushedCountHeader)
+	}
+
+	if opts.RequestIDHeader != "" && !validHeaderName(opts.RequestIDHeader) {
+		fail("invalid request ID header %q", opts.RequestIDHeader)
+	}
+
+	if opts.ServiceWorkerHeader != "" && !validHeaderName(opts.ServiceWorkerHeader) {
+		fail("invalid service worker header %q", opts.ServiceWorkerHeader)
+	}
+
+	if opts.ServiceWorkerCookie != "" && !validHeaderName(opts.ServiceWorkerCookie) {
+		fail("invalid service worker cookie name %q", opts.ServiceWorkerCookie)
+	}
+
+	if (opts.ServiceWorkerHeader != "" || opts.ServiceWorkerCookie != "") && !opts.SkipServiceWorker {
+		fail("ServiceWorkerHeader or ServiceWorkerCookie is set without SkipServiceWorker")
+	}
+
+	if opts.Vary != "" && !validHeaderName(opts.Vary) {
+		fail("invalid Vary header %q", opts.Vary)
+	}
+
+	for _, code := range opts.RedirectCodes {
+		if code < 300 || code >= 400 {
+			fail("redirect code %d is not a 3xx status", code)
+		}
+	}
+
+	if opts.RedirectDepth < 0 {
+		fail("negative RedirectDepth")
+	}
+
+	for _, p := range []VisitPolicy{opts.FirstVisit, opts.RepeatVisit} {
+		if p < VisitDefault || p > VisitPreload {
+			fail("unknown VisitPolicy %d", p)
+		} else if p == VisitPushManifest && opts.Manifest == nil {
+			fail("VisitPushManifest is set but Manifest is nil")
+		}
+	}
+
+	if opts.Fallback == FallbackFunc && opts.FallbackFunc == nil {
+		fail("Fallback is FallbackFunc but FallbackFunc is nil")
+	}
+
+	if opts.CookieRefresh < 0 {
+		fail("negative CookieRefresh")
+	}
+
+	if opts.Shadow != nil {
+		name := DefaultCookie().Name
+		if opts.Cookie != nil {
+			name = opts.Cookie.Name
+		}
+
+		if opts.Shadow.opts.cookie.Name == name {
+			fail("Shadow has the same cookie name %q", name)
+		}
+	}
+
+	if opts.MinThroughput < 0 {
+		fail("negative MinThroughput")
+	}
+
+	if opts.MaxPushes < 0 {
+		fail("negative MaxPushes")
+	} else if opts.SamplePushes && opts.MaxPushes == 0 {
+		fail("SamplePushes is set without MaxPushes")
+	}
+
+	if opts.PushTimeBudget < 0 {
+		fail("negative PushTimeBudget")
+	}
+
+	if opts.PushTimeout < 0 {
+		fail("negative PushTimeout")
+	}
+
+	if opts.ExactThreshold < 0 {
+		fail("negative ExactThreshold")
+	} else if opts.ExactThreshold > 0 && !poolable(m) {
+		fail("ExactThreshold is set but m (%d) is not a multiple of 64", m)
+	}
+
+	for _, pattern := range opts.StripQuery {
+		if pattern == "" || strings.ContainsAny(strings.TrimSuffix(pattern, "*"), "*&=#") {
+			fail("invalid StripQuery pattern %q", pattern)
+		}
+	}
+
+	if opts.TTLBucket < 0 {
+		fail("negative TTLBucket")
+	} else if opts.TTLBucket > 0 && opts.TTLBuckets <= 0 {
+		fail("TTLBucket is set but TTLBuckets is not positive")
+	} else if opts.TTLBucket == 0 && opts.TargetTTL != nil {
+		fail("TargetTTL is set without TTLBucket")
+	}
+
+	if opts.MaxCookieSize < 0 {
+		fail("negative MaxCookieSize")
+	} else if opts.MaxCookieSize > maxCookieSize {
+		fail("MaxCookieSize is larger than the %d bytes browsers store", maxCookieSize)
+	}
+
+	if opts.MetadataCache < 0 {
+		fail("negative MetadataCache")
+	}
+
+	if opts.EdgeAnnotate != nil && !opts.EdgePush {
+		fail("EdgeAnnotate is set but EdgePush is not")
+	}
+
+	if opts.ErrorLogInterval < 0 {
+		fail("negative ErrorLogInterval")
+	}
+
+	return errors.Join(errs...)
+}
+
+// setInvalid logs err, the reason that opts could not be
+// used, and disables the handler, which keeps only the
+// logger of opts.
+func (s *PushHandler) setInvalid(err error, opts *Options) {
+	fallback := Options{Disabled: true}
+	if opts != nil {
+		fallback.Logger = opts.Logger
+	}
+
+	if fallback.Logger != nil {
+		fallback.Logger.Error("invalid options, push disabled", slog.Any("error", err))
+	} else {
+		log.Printf("%v (push disabled)", err)
+	}
+
+	s.setOptions(defaultM, defaultK, &fallback)
+}
+
+func validHeaderName(name string) bool {
+	return name != "" && strings.IndexFunc(name, func(r rune) bool {
+		return !isTokenRune(r)
+	}) < 0
+}
+
+func isTokenRune(r rune) bool {
+	return r < 0x7f && (r >= '0' && r <= '9' ||
+		r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+		strings.ContainsRune("!#$%&'*+-.^_`|~", r))
+}
+
+// maxResourceSize is the size above which Manifest.Validate
+// reports a resource as too large to push.
+const maxResourceSize = 1 << 20
+
+// Validate checks the manifest before it is deployed by
+// serving a GET request for each resource with h, which
+// should be the handler the resources are served by. It
+// reports resources that:
+//
+//   - are not absolute paths on the same origin,
+//   - are listed more than once for a route,
+//   - are not served with a 200 status, or
+//   - are larger than 1 MiB, which is better left for the
+//     client to request.
+//
+// Resource paths containing :name or * parameters of a
+// route pattern are not served. All of the problems found
+// are returned together.
+func (m *Manifest) Validate(h http.Handler) error {
+	routes := m.Routes()
+
+	names := make([]string, 0, len(routes))
+	for route := range routes {
+		names = append(names, route)
+	}
+
+	slices.Sort(names)
+
+	var errs []error
+	fail := func(route, path, format string, v ...interface{}) {
+		errs = append(errs, fmt.Errorf("go-server-push: manifest route %q: resource %q: "+format,
+			append([]interface{}{route, path}, v...)...))
+	}
+
+	served := make(map[string]*discardRecorder)
+	for _, route := range names {
+		seen := make(map[string]bool)
+
+		for _, res := range routes[route] {
+			p := res.Path
+
+			switch {
+			case seen[p]:
+				fail(route, p, "listed more than once")
+				continue
+			case !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//"):
+				fail(route, p, "not an absolute path")
+				continue
+			}
+
+			seen[p] = true
+
+			if isPattern(route) && strings.ContainsAny(p, ":*") {
+				continue
+			}
+
+			rec, ok := served[p]
+			if !ok {
+				rec = serveResource(h, p)
+				served[p] = rec
+			}
+
+			switch {
+			case rec.code != http.StatusOK:
+				fail(route, p, "served with status %d", rec.code)
+			case rec.size > maxResourceSize:
+				fail(route, p, "%d bytes is too large to push", rec.size)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func serveResource(h http.Handler, target string) *discardRecorder {
+	rec := &discardRecorder{header: make(http.Header)}
+
+	r, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		rec.code = http.StatusBadRequest
+		return rec
+	}
+
+	r.RequestURI = target
+	h.ServeHTTP(rec, r)
+
+	if rec.code == 0 {
+		rec.code = http.StatusOK
+	}
+
+	return rec
+}
@@ -0,0 +1,54 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import "net/http"
+
+// VisitPolicy is the behaviour of the handler for a client
+// on its first visit, when it has no bloom filter cookie,
+// or on a repeat visit, when it has one.
+type VisitPolicy int
+
+const (
+	// VisitDefault pushes as the other options of the
+	// handler direct. It is the default.
+	VisitDefault VisitPolicy = iota
+	// VisitPushManifest additionally pushes the Manifest
+	// resources of the page, as if Options.PushManifest
+	// were set.
+	VisitPushManifest
+	// VisitPreload pushes nothing, leaving the Link
+	// headers for the client to preload with the
+	// Fallback, as for a client without push.
+	VisitPreload
+)
+
+var visitPolicyNames = [...]string{
+	VisitDefault:      "default",
+	VisitPushManifest: "push-manifest",
+	VisitPreload:      "preload",
+}
+
+func (p VisitPolicy) String() string {
+	if p < 0 || int(p) >= len(visitPolicyNames) {
+		return "unknown"
+	}
+
+	return visitPolicyNames[p]
+}
+
+// visitPolicy returns the VisitPolicy for r.
+func (o *options) visitPolicy(r *http.Request) VisitPolicy {
+	if o.firstVisit == VisitDefault && o.repeatVisit == VisitDefault {
+		return VisitDefault
+	}
+
+	if c, err := r.Cookie(o.cookie.Name); err != nil || c.Value == "" {
+		return o.firstVisit
+	}
+
+	return o.repeatVisit
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// pushTimeSuffix is appended to the name of the filter
+// cookie to name the cookie recording when resources were
+// last pushed.
+const pushTimeSuffix = "-T"
+
+// savePushTime sets the cookie recording that resources
+// were just pushed, which expires with the waste window.
+func (w *pushResponseWriter) savePushTime() {
+	c := *w.opts.cookie
+	c.Name += pushTimeSuffix
+	c.Value = strconv.FormatInt(w.opts.clock.Now().Unix(), 36)
+	c.MaxAge = int((w.opts.wasteWindow + time.Second - 1) / time.Second)
+	c.Expires = time.Time{}
+	http.SetCookie(w, &c)
+}
+
+// checkWasted reports the target of r as wasted if it was
+// pushed to the client within the waste window.
+func (o *options) checkWasted(r *http.Request) {
+	tc, err := r.Cookie(o.cookie.Name + pushTimeSuffix)
+	if err != nil {
+		return
+	}
+
+	ts, err := strconv.ParseInt(tc.Value, 36, 64)
+	if err != nil || o.clock.Now().Sub(time.Unix(ts, 0)) > o.wasteWindow {
+		return
+	}
+
+	c, err := r.Cookie(o.cookie.Name)
+	if err != nil || c.Value == "" {
+		return
+	}
+
+	gen, value := splitGeneration(c.Value)
+	if gen != o.generation() {
+		return
+	}
+
+	f, err := decodeFilter(value)
+	if err != nil || !f.TestString(r.URL.Path) {
+		return
+	}
+
+	o.add(wastedVar, 1)
+
+	if o.stats != nil {
+		o.stats.recordWasted(r.URL.Path)
+	}
+
+	if o.hooks != nil && o.hooks.Wasted != nil {
+		o.hooks.Wasted(r, r.URL.Path)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+package serverpush
+
+//go:generate go run wrappers_gen.go
+
+import (
+	"io"
+	"net/http"
+)
+
+// writer is implemented by each of the response writer
+// wrappers in this package. The wrappers implement every
+// optional interface, delegating to the writer they wrap,
+// and wrapWriter hides those the wrapped writer lacks.
+type writer interface {
+	http.ResponseWriter
+	http.Flusher
+	io.StringWriter
+	Unwrap() http.ResponseWriter
+
+	http.Pusher
+	http.CloseNotifier
+	http.Hijacker
+	io.ReaderFrom
+}
+
+// The optional interfaces that wrapWriter preserves.
+const (
+	pusherIface = 1 << iota
+	closeNotifierIface
+	hijackerIface
+	readerFromIface
+)
+
+// ifaces returns the set of optional interfaces
+// implemented by w.
+func ifaces(w http.ResponseWriter) int {
+	var set int
+
+	if _, ok := w.(http.Pusher); ok {
+		set |= pusherIface
+	}
+
+	if _, ok := w.(http.CloseNotifier); ok {
+		set |= closeNotifierIface
+	}
+
+	if _, ok := w.(http.Hijacker); ok {
+		set |= hijackerIface
+	}
+
+	if _, ok := w.(io.ReaderFrom); ok {
+		set |= readerFromIface
+	}
+
+	return set
+}
+
+// wrappedWriter is implemented by the values returned from
+// wrapWriter.
+type wrappedWriter interface {
+	http.ResponseWriter
+	writer() writer
+}
+
+// unwrapWriter returns the wrapper within a value returned
+// from wrapWriter, or nil if w was not returned from
+// wrapWriter.
+func unwrapWriter(w http.ResponseWriter) writer {
+	if ww, ok := w.(wrappedWriter); ok {
+		return ww.writer()
+	}
+
+	return nil
+}
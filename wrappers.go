@@ -0,0 +1,371 @@
+// Code generated by wrappers_gen.go; DO NOT EDIT.
+
+package serverpush
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// wrapWriter returns w with the method set restricted to
+// the optional interfaces implemented by orig.
+func wrapWriter(w writer, orig http.ResponseWriter) http.ResponseWriter {
+	switch ifaces(orig) {
+	case 0:
+		return rw{w}
+	case pusherIface:
+		return rwP{w}
+	case closeNotifierIface:
+		return rwC{w}
+	case pusherIface | closeNotifierIface:
+		return rwPC{w}
+	case hijackerIface:
+		return rwH{w}
+	case pusherIface | hijackerIface:
+		return rwPH{w}
+	case closeNotifierIface | hijackerIface:
+		return rwCH{w}
+	case pusherIface | closeNotifierIface | hijackerIface:
+		return rwPCH{w}
+	case readerFromIface:
+		return rwR{w}
+	case pusherIface | readerFromIface:
+		return rwPR{w}
+	case closeNotifierIface | readerFromIface:
+		return rwCR{w}
+	case pusherIface | closeNotifierIface | readerFromIface:
+		return rwPCR{w}
+	case hijackerIface | readerFromIface:
+		return rwHR{w}
+	case pusherIface | hijackerIface | readerFromIface:
+		return rwPHR{w}
+	case closeNotifierIface | hijackerIface | readerFromIface:
+		return rwCHR{w}
+	case pusherIface | closeNotifierIface | hijackerIface | readerFromIface:
+		return rwPCHR{w}
+	default:
+		panic("unreachable")
+	}
+}
+
+type rw struct{ w writer }
+
+func (w rw) writer() writer { return w.w }
+
+func (w rw) Header() http.Header { return w.w.Header() }
+
+func (w rw) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+func (w rw) WriteHeader(code int) { w.w.WriteHeader(code) }
+
+func (w rw) WriteString(s string) (int, error) { return w.w.WriteString(s) }
+
+func (w rw) Flush() { w.w.Flush() }
+
+func (w rw) Unwrap() http.ResponseWriter { return w.w.Unwrap() }
+
+type rwP struct{ w writer }
+
+func (w rwP) writer() writer { return w.w }
+
+func (w rwP) Header() http.Header { return w.w.Header() }
+
+func (w rwP) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+func (w rwP) WriteHeader(code int) { w.w.WriteHeader(code) }
+
+func (w rwP) WriteString(s string) (int, error) { return w.w.WriteString(s) }
+
+func (w rwP) Flush() { w.w.Flush() }
+
+func (w rwP) Unwrap() http.ResponseWriter { return w.w.Unwrap() }
+
+func (w rwP) Push(target string, opts *http.PushOptions) error { return w.w.Push(target, opts) }
+
+type rwC struct{ w writer }
+
+func (w rwC) writer() writer { return w.w }
+
+func (w rwC) Header() http.Header { return w.w.Header() }
+
+func (w rwC) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+func (w rwC) WriteHeader(code int) { w.w.WriteHeader(code) }
+
+func (w rwC) WriteString(s string) (int, error) { return w.w.WriteString(s) }
+
+func (w rwC) Flush() { w.w.Flush() }
+
+func (w rwC) Unwrap() http.ResponseWriter { return w.w.Unwrap() }
+
+func (w rwC) CloseNotify() <-chan bool { return w.w.CloseNotify() }
+
+type rwPC struct{ w writer }
+
+func (w rwPC) writer() writer { return w.w }
+
+func (w rwPC) Header() http.Header { return w.w.Header() }
+
+func (w rwPC) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+func (w rwPC) WriteHeader(code int) { w.w.WriteHeader(code) }
+
+func (w rwPC) WriteString(s string) (int, error) { return w.w.WriteString(s) }
+
+func (w rwPC) Flush() { w.w.Flush() }
+
+func (w rwPC) Unwrap() http.ResponseWriter { return w.w.Unwrap() }
+
+func (w rwPC) Push(target string, opts *http.PushOptions) error { return w.w.Push(target, opts) }
+
+func (w rwPC) CloseNotify() <-chan bool { return w.w.CloseNotify() }
+
+type rwH struct{ w writer }
+
+func (w rwH) writer() writer { return w.w }
+
+func (w rwH) Header() http.Header { return w.w.Header() }
+
+func (w rwH) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+func (w rwH) WriteHeader(code int) { w.w.WriteHeader(code) }
+
+func (w rwH) WriteString(s string) (int, error) { return w.w.WriteString(s) }
+
+func (w rwH) Flush() { w.w.Flush() }
+
+func (w rwH) Unwrap() http.ResponseWriter { return w.w.Unwrap() }
+
+func (w rwH) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.w.Hijack() }
+
+type rwPH struct{ w writer }
+
+func (w rwPH) writer() writer { return w.w }
+
+func (w rwPH) Header() http.Header { return w.w.Header() }
+
+func (w rwPH) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+func (w rwPH) WriteHeader(code int) { w.w.WriteHeader(code) }
+
+func (w rwPH) WriteString(s string) (int, error) { return w.w.WriteString(s) }
+
+func (w rwPH) Flush() { w.w.Flush() }
+
+func (w rwPH) Unwrap() http.ResponseWriter { return w.w.Unwrap() }
+
+func (w rwPH) Push(target string, opts *http.PushOptions) error { return w.w.Push(target, opts) }
+
+func (w rwPH) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.w.Hijack() }
+
+type rwCH struct{ w writer }
+
+func (w rwCH) writer() writer { return w.w }
+
+func (w rwCH) Header() http.Header { return w.w.Header() }
+
+func (w rwCH) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+func (w rwCH) WriteHeader(code int) { w.w.WriteHeader(code) }
+
+func (w rwCH) WriteString(s string) (int, error) { return w.w.WriteString(s) }
+
+func (w rwCH) Flush() { w.w.Flush() }
+
+func (w rwCH) Unwrap() http.ResponseWriter { return w.w.Unwrap() }
+
+func (w rwCH) CloseNotify() <-chan bool { return w.w.CloseNotify() }
+
+func (w rwCH) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.w.Hijack() }
+
+type rwPCH struct{ w writer }
+
+func (w rwPCH) writer() writer { return w.w }
+
+func (w rwPCH) Header() http.Header { return w.w.Header() }
+
+func (w rwPCH) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+func (w rwPCH) WriteHeader(code int) { w.w.WriteHeader(code) }
+
+func (w rwPCH) WriteString(s string) (int, error) { return w.w.WriteString(s) }
+
+func (w rwPCH) Flush() { w.w.Flush() }
+
+func (w rwPCH) Unwrap() http.ResponseWriter { return w.w.Unwrap() }
+
+func (w rwPCH) Push(target string, opts *http.PushOptions) error { return w.w.Push(target, opts) }
+
+func (w rwPCH) CloseNotify() <-chan bool { return w.w.CloseNotify() }
+
+func (w rwPCH) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.w.Hijack() }
+
+type rwR struct{ w writer }
+
+func (w rwR) writer() writer { return w.w }
+
+func (w rwR) Header() http.Header { return w.w.Header() }
+
+func (w rwR) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+func (w rwR) WriteHeader(code int) { w.w.WriteHeader(code) }
+
+func (w rwR) WriteString(s string) (int, error) { return w.w.WriteString(s) }
+
+func (w rwR) Flush() { w.w.Flush() }
+
+func (w rwR) Unwrap() http.ResponseWriter { return w.w.Unwrap() }
+
+func (w rwR) ReadFrom(r io.Reader) (int64, error) { return w.w.ReadFrom(r) }
+
+type rwPR struct{ w writer }
+
+func (w rwPR) writer() writer { return w.w }
+
+func (w rwPR) Header() http.Header { return w.w.Header() }
+
+func (w rwPR) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+func (w rwPR) WriteHeader(code int) { w.w.WriteHeader(code) }
+
+func (w rwPR) WriteString(s string) (int, error) { return w.w.WriteString(s) }
+
+func (w rwPR) Flush() { w.w.Flush() }
+
+func (w rwPR) Unwrap() http.ResponseWriter { return w.w.Unwrap() }
+
+func (w rwPR) Push(target string, opts *http.PushOptions) error { return w.w.Push(target, opts) }
+
+func (w rwPR) ReadFrom(r io.Reader) (int64, error) { return w.w.ReadFrom(r) }
+
+type rwCR struct{ w writer }
+
+func (w rwCR) writer() writer { return w.w }
+
+func (w rwCR) Header() http.Header { return w.w.Header() }
+
+func (w rwCR) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+func (w rwCR) WriteHeader(code int) { w.w.WriteHeader(code) }
+
+func (w rwCR) WriteString(s string) (int, error) { return w.w.WriteString(s) }
+
+func (w rwCR) Flush() { w.w.Flush() }
+
+func (w rwCR) Unwrap() http.ResponseWriter { return w.w.Unwrap() }
+
+func (w rwCR) CloseNotify() <-chan bool { return w.w.CloseNotify() }
+
+func (w rwCR) ReadFrom(r io.Reader) (int64, error) { return w.w.ReadFrom(r) }
+
+type rwPCR struct{ w writer }
+
+func (w rwPCR) writer() writer { return w.w }
+
+func (w rwPCR) Header() http.Header { return w.w.Header() }
+
+func (w rwPCR) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+func (w rwPCR) WriteHeader(code int) { w.w.WriteHeader(code) }
+
+func (w rwPCR) WriteString(s string) (int, error) { return w.w.WriteString(s) }
+
+func (w rwPCR) Flush() { w.w.Flush() }
+
+func (w rwPCR) Unwrap() http.ResponseWriter { return w.w.Unwrap() }
+
+func (w rwPCR) Push(target string, opts *http.PushOptions) error { return w.w.Push(target, opts) }
+
+func (w rwPCR) CloseNotify() <-chan bool { return w.w.CloseNotify() }
+
+func (w rwPCR) ReadFrom(r io.Reader) (int64, error) { return w.w.ReadFrom(r) }
+
+type rwHR struct{ w writer }
+
+func (w rwHR) writer() writer { return w.w }
+
+func (w rwHR) Header() http.Header { return w.w.Header() }
+
+func (w rwHR) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+func (w rwHR) WriteHeader(code int) { w.w.WriteHeader(code) }
+
+func (w rwHR) WriteString(s string) (int, error) { return w.w.WriteString(s) }
+
+func (w rwHR) Flush() { w.w.Flush() }
+
+func (w rwHR) Unwrap() http.ResponseWriter { return w.w.Unwrap() }
+
+func (w rwHR) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.w.Hijack() }
+
+func (w rwHR) ReadFrom(r io.Reader) (int64, error) { return w.w.ReadFrom(r) }
+
+type rwPHR struct{ w writer }
+
+func (w rwPHR) writer() writer { return w.w }
+
+func (w rwPHR) Header() http.Header { return w.w.Header() }
+
+func (w rwPHR) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+func (w rwPHR) WriteHeader(code int) { w.w.WriteHeader(code) }
+
+func (w rwPHR) WriteString(s string) (int, error) { return w.w.WriteString(s) }
+
+func (w rwPHR) Flush() { w.w.Flush() }
+
+func (w rwPHR) Unwrap() http.ResponseWriter { return w.w.Unwrap() }
+
+func (w rwPHR) Push(target string, opts *http.PushOptions) error { return w.w.Push(target, opts) }
+
+func (w rwPHR) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.w.Hijack() }
+
+func (w rwPHR) ReadFrom(r io.Reader) (int64, error) { return w.w.ReadFrom(r) }
+
+type rwCHR struct{ w writer }
+
+func (w rwCHR) writer() writer { return w.w }
+
+func (w rwCHR) Header() http.Header { return w.w.Header() }
+
+func (w rwCHR) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+func (w rwCHR) WriteHeader(code int) { w.w.WriteHeader(code) }
+
+func (w rwCHR) WriteString(s string) (int, error) { return w.w.WriteString(s) }
+
+func (w rwCHR) Flush() { w.w.Flush() }
+
+func (w rwCHR) Unwrap() http.ResponseWriter { return w.w.Unwrap() }
+
+func (w rwCHR) CloseNotify() <-chan bool { return w.w.CloseNotify() }
+
+func (w rwCHR) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.w.Hijack() }
+
+func (w rwCHR) ReadFrom(r io.Reader) (int64, error) { return w.w.ReadFrom(r) }
+
+type rwPCHR struct{ w writer }
+
+func (w rwPCHR) writer() writer { return w.w }
+
+func (w rwPCHR) Header() http.Header { return w.w.Header() }
+
+func (w rwPCHR) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+func (w rwPCHR) WriteHeader(code int) { w.w.WriteHeader(code) }
+
+func (w rwPCHR) WriteString(s string) (int, error) { return w.w.WriteString(s) }
+
+func (w rwPCHR) Flush() { w.w.Flush() }
+
+func (w rwPCHR) Unwrap() http.ResponseWriter { return w.w.Unwrap() }
+
+func (w rwPCHR) Push(target string, opts *http.PushOptions) error { return w.w.Push(target, opts) }
+
+func (w rwPCHR) CloseNotify() <-chan bool { return w.w.CloseNotify() }
+
+func (w rwPCHR) Hijack() (net.Conn, *bufio.ReadWriter, error) { return w.w.Hijack() }
+
+func (w rwPCHR) ReadFrom(r io.Reader) (int64, error) { return w.w.ReadFrom(r) }
@@ -0,0 +1,129 @@
+// Copyright 2017 Tom Thorogood. All rights reserved.
+// Use of this source code is governed by a
+// Modified BSD License license that can be found in
+// the LICENSE file.
+
+//go:build ignore
+
+// This program generates wrappers.go. It can be invoked
+// by running go generate.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"strings"
+)
+
+type iface struct {
+	bit, letter string
+	methods     []string
+}
+
+var ifaces = []iface{
+	{"pusherIface", "P", []string{
+		"Push(target string, opts *http.PushOptions) error",
+		"return w.w.Push(target, opts)",
+	}},
+	{"closeNotifierIface", "C", []string{
+		"CloseNotify() <-chan bool",
+		"return w.w.CloseNotify()",
+	}},
+	{"hijackerIface", "H", []string{
+		"Hijack() (net.Conn, *bufio.ReadWriter, error)",
+		"return w.w.Hijack()",
+	}},
+	{"readerFromIface", "R", []string{
+		"ReadFrom(r io.Reader) (int64, error)",
+		"return w.w.ReadFrom(r)",
+	}},
+}
+
+func main() {
+	var buf bytes.Buffer
+	buf.WriteString(`// Code generated by wrappers_gen.go; DO NOT EDIT.
+
+package serverpush
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// wrapWriter returns w with the method set restricted to
+// the optional interfaces implemented by orig.
+func wrapWriter(w writer, orig http.ResponseWriter) http.ResponseWriter {
+	switch ifaces(orig) {
+`)
+
+	n := 1 << len(ifaces)
+	for set := 0; set < n; set++ {
+		var bits []string
+		for i, f := range ifaces {
+			if set&(1<<i) != 0 {
+				bits = append(bits, f.bit)
+			}
+		}
+
+		if len(bits) == 0 {
+			bits = []string{"0"}
+		}
+
+		fmt.Fprintf(&buf, "\tcase %s:\n\t\treturn %s{w}\n", strings.Join(bits, " | "), typeName(set))
+	}
+
+	buf.WriteString("\tdefault:\n\t\tpanic(\"unreachable\")\n\t}\n}\n")
+
+	for set := 0; set < n; set++ {
+		name := typeName(set)
+
+		fmt.Fprintf(&buf, `
+type %[1]s struct{ w writer }
+
+func (w %[1]s) writer() writer { return w.w }
+
+func (w %[1]s) Header() http.Header { return w.w.Header() }
+
+func (w %[1]s) Write(p []byte) (int, error) { return w.w.Write(p) }
+
+func (w %[1]s) WriteHeader(code int) { w.w.WriteHeader(code) }
+
+func (w %[1]s) WriteString(s string) (int, error) { return w.w.WriteString(s) }
+
+func (w %[1]s) Flush() { w.w.Flush() }
+
+func (w %[1]s) Unwrap() http.ResponseWriter { return w.w.Unwrap() }
+`, name)
+
+		for i, f := range ifaces {
+			if set&(1<<i) != 0 {
+				fmt.Fprintf(&buf, "\nfunc (w %s) %s { %s }\n", name, f.methods[0], f.methods[1])
+			}
+		}
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile("wrappers.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func typeName(set int) string {
+	name := "rw"
+	for i, f := range ifaces {
+		if set&(1<<i) != 0 {
+			name += f.letter
+		}
+	}
+
+	return name
+}